@@ -0,0 +1,578 @@
+package cloudfunction
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 构建状态
+const (
+	BuildPending  = "pending"  // 等待构建
+	BuildBuilding = "building" // 正在构建
+	BuildReady    = "ready"    // 构建成功，可以调用
+	BuildFailed   = "failed"   // 构建失败，调用被拒绝
+)
+
+// maxBuildOutput 构建日志保留的最大长度，超出部分丢弃
+const maxBuildOutput = 1024 * 1024
+
+// maxBuildHistory 每个函数保留的已结束构建记录数，仍被函数或已发布版本使用的构建不计入
+const maxBuildHistory = 20
+
+// Build 一次函数构建。部署、更新代码或发布版本时异步执行：解压代码包、安装依赖、准备层，
+// Go函数还会编译出可执行文件。构建成功前函数的调用被拒绝
+type Build struct {
+	ID          string       `json:"id"`
+	FunctionID  string       `json:"function_id"`
+	Version     int          `json:"version"` // 构建的函数版本，0表示当前代码
+	Runtime     string       `json:"runtime"`
+	Key         string       `json:"key"` // 构建输入（运行时、代码、代码包、入口、层）的哈希，输入不变时不重新构建
+	State       string       `json:"state"`
+	Error       string       `json:"error,omitempty"`
+	Diagnostics []Diagnostic `json:"diagnostics,omitempty"` // 编译失败时的编译器诊断，行列号相对于用户代码
+	Output      string       `json:"output,omitempty"`      // 完整的构建日志，包含编译器和包管理器的输出
+	CreatedAt   time.Time    `json:"created_at"`
+	StartedAt   *time.Time   `json:"started_at,omitempty"`
+	FinishedAt  *time.Time   `json:"finished_at,omitempty"`
+	Duration    int64        `json:"duration,omitempty"` // 构建耗时(毫秒)
+}
+
+// summary 返回不含构建日志的副本
+func (b *Build) summary() *Build {
+	copied := *b
+	copied.Output = ""
+	return &copied
+}
+
+// BuildNotReadyError 函数的构建尚未成功，调用被拒绝
+type BuildNotReadyError struct {
+	Build *Build
+}
+
+func (e *BuildNotReadyError) Error() string {
+	if e.Build.State == BuildFailed {
+		return fmt.Sprintf("函数构建失败（构建 %s），修复后重新部署: %s", e.Build.ID, e.Build.Error)
+	}
+	return fmt.Sprintf("函数尚未构建完成（构建 %s 状态为 %s），请稍后重试", e.Build.ID, e.Build.State)
+}
+
+// buildLog 构建日志，只保留前 maxBuildOutput 字节
+type buildLog struct {
+	mutex     sync.Mutex
+	data      []byte
+	truncated bool
+}
+
+func (l *buildLog) Write(p []byte) (int, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if room := maxBuildOutput - len(l.data); room < len(p) {
+		l.data = append(l.data, p[:max(room, 0)]...)
+		l.truncated = true
+	} else {
+		l.data = append(l.data, p...)
+	}
+	return len(p), nil
+}
+
+// step 记录构建步骤
+func (l *buildLog) step(format string, args ...interface{}) {
+	fmt.Fprintf(l, "==> "+format+"\n", args...)
+}
+
+func (l *buildLog) String() string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.truncated {
+		return string(l.data) + "\n...(构建日志超过 1MB，已截断)\n"
+	}
+	return string(l.data)
+}
+
+// buildKey 计算函数构建输入的哈希，层按规范的 name:version 形式排序后参与计算
+func buildKey(fn *Function) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\x00%s\x00%s\x00", fn.Runtime, fn.Handler, fn.Code)
+	if fn.Package != nil {
+		io.WriteString(hash, fn.Package.SHA256)
+	}
+	layers := make([]string, 0, len(fn.Layers))
+	for _, layer := range fn.Layers {
+		layers = append(layers, layer.String())
+	}
+	sort.Strings(layers)
+	for _, layer := range layers {
+		io.WriteString(hash, "\x00"+layer)
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:32]
+}
+
+// generateBuildID 生成唯一的构建ID
+func generateBuildID() string {
+	return fmt.Sprintf("build_%d", time.Now().UnixNano())
+}
+
+// newBuild 为函数（或函数版本的快照）创建等待中的构建，调用 startBuild 后才会执行
+func newBuild(fn *Function) *Build {
+	return &Build{
+		ID:         generateBuildID(),
+		FunctionID: fn.ID,
+		Version:    fn.version,
+		Runtime:    fn.Runtime,
+		Key:        buildKey(fn),
+		State:      BuildPending,
+		CreatedAt:  time.Now(),
+	}
+}
+
+// needsBuild 判断更新后的函数是否需要重新构建：构建输入变化、从未构建或上次构建失败
+func (p *Platform) needsBuild(existing, updated *Function) bool {
+	build, ok := p.lookupBuild(existing.BuildID)
+	return !ok || build.State == BuildFailed || build.Key != buildKey(updated)
+}
+
+// startBuild 登记构建并在后台执行，函数已持久化后调用
+func (p *Platform) startBuild(fn *Function, build *Build) {
+	p.buildsMutex.Lock()
+	p.builds[build.ID] = build
+	p.buildsMutex.Unlock()
+	if err := p.saveBuild(build); err != nil {
+		Error("保存构建记录失败: %v", err)
+	}
+
+	go p.runBuild(fn, build)
+}
+
+// runBuild 等待构建并发名额后执行构建，记录结果和日志
+func (p *Platform) runBuild(fn *Function, build *Build) {
+	p.buildSlots <- struct{}{}
+	defer func() { <-p.buildSlots }()
+
+	log := &buildLog{}
+	started := time.Now()
+	p.updateBuild(build.ID, func(b *Build) {
+		b.State = BuildBuilding
+		b.StartedAt = &started
+	})
+
+	var err error
+	if !p.isCurrentBuild(build) {
+		err = fmt.Errorf("已被新的构建取代")
+	} else {
+		timeout := time.Duration(p.options.BuildTimeout) * time.Second
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err = p.executeBuild(ctx, fn, build, log)
+		if err != nil && ctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("构建超时（%v）", timeout)
+		}
+		cancel()
+	}
+
+	finished := time.Now()
+	if err != nil {
+		log.step("构建失败: %s", classifyError(err).Message)
+	} else {
+		log.step("构建成功，耗时 %v", finished.Sub(started).Round(time.Millisecond))
+	}
+	p.updateBuild(build.ID, func(b *Build) {
+		b.State = BuildReady
+		if err != nil {
+			b.State = BuildFailed
+			b.Error = classifyError(err).Message
+			var compileErr *compileError
+			if errors.As(err, &compileErr) {
+				b.Diagnostics = compileErr.diagnostics
+			}
+		}
+		b.Output = log.String()
+		b.FinishedAt = &finished
+		b.Duration = finished.Sub(started).Milliseconds()
+	})
+
+	if err == nil && p.isCurrentBuild(build) {
+		p.removeOldArtifacts(fn, build.ID)
+	}
+	p.pruneBuilds(build.FunctionID)
+}
+
+// executeBuild 执行构建步骤，命令输出写入构建日志
+func (p *Platform) executeBuild(ctx context.Context, fn *Function, build *Build, log *buildLog) error {
+	fnDir := p.functionDir(fn)
+	if err := os.MkdirAll(fnDir, 0755); err != nil {
+		return fmt.Errorf("创建函数目录失败: %v", err)
+	}
+
+	log.step("准备代码（%s 运行时）", fn.Runtime)
+	if fn.Package != nil {
+		fmt.Fprintf(log, "代码包 %s（%s，%d 字节）\n", fn.Package.SHA256[:16], fn.Package.Format, fn.Package.Size)
+	}
+	for _, layer := range fn.Layers {
+		fmt.Fprintf(log, "层 %s\n", layer)
+	}
+	inv := &invocation{}
+	defer inv.release(p)
+	buildDir, err := p.prepareCode(ctx, fn, inv)
+	if err != nil {
+		return err
+	}
+	if inv.deps != nil {
+		fmt.Fprintf(log, "依赖 %s\n", inv.deps.Dir)
+	}
+	if fn.Runtime != "go" {
+		return nil
+	}
+
+	// 每次构建在独立的临时目录中生成入口程序并编译，并发的构建不共享源码和输出文件
+	workDir, err := os.MkdirTemp(fnDir, ".build-")
+	if err != nil {
+		return fmt.Errorf("创建构建目录失败: %v", err)
+	}
+	defer os.RemoveAll(workDir)
+	output := filepath.Join(workDir, "function")
+
+	if prebuiltBinary(fn) {
+		err = installPrebuiltBinary(fn, buildDir, output, log)
+	} else {
+		err = p.compileGoFunction(ctx, fn, filepath.Join(workDir, "src"), output, inv.layers, log)
+	}
+	if err != nil {
+		return err
+	}
+
+	// 编译期间函数可能已被再次更新，只有仍是当前构建时才发布构建产物
+	if !p.isCurrentBuild(build) {
+		return fmt.Errorf("已被新的构建取代")
+	}
+	artifact := p.buildArtifact(fn, build.ID)
+	if err := os.MkdirAll(filepath.Dir(artifact), 0755); err != nil {
+		return fmt.Errorf("创建构建目录失败: %v", err)
+	}
+	if err := os.Rename(output, artifact); err != nil {
+		return fmt.Errorf("保存构建产物失败: %v", err)
+	}
+	return nil
+}
+
+// compileGoFunction 在 workDir 中生成Go入口程序并编译为 output，编译失败时返回带诊断信息的 *compileError
+func (p *Platform) compileGoFunction(ctx context.Context, fn *Function, workDir, output string, layers []*preparedLayer, log *buildLog) error {
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		return fmt.Errorf("创建构建目录失败: %v", err)
+	}
+
+	log.step("生成Go入口程序")
+	target := "main.go"
+	if fn.Package != nil {
+		if err := p.extractStoredPackage(fn.Package, workDir); err != nil {
+			return err
+		}
+		if err := p.ensureGoModule(ctx, workDir); err != nil {
+			return err
+		}
+		if err := writeGoPackageMain(workDir, fn.Handler); err != nil {
+			return err
+		}
+		target = "./" + goPackageMainDir
+	} else {
+		source, err := goMainSource(fn)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(workDir, "main.go"), []byte(source), 0644); err != nil {
+			return fmt.Errorf("写入main.go失败: %v", err)
+		}
+	}
+	if err := p.useGoLayers(ctx, workDir, layers); err != nil {
+		return err
+	}
+
+	log.step("编译: go build %s", target)
+	cmd := exec.CommandContext(ctx, runtimeBinary("go"), "build", "-o", output, target)
+	cmd.Dir = workDir
+	cmd.Env = p.goBuildEnv(workDir)
+	// 编译器输出完整写入构建日志，错误信息中保留开头部分
+	compilerOutput := &bytes.Buffer{}
+	cmd.Stdout = io.MultiWriter(log, compilerOutput)
+	cmd.Stderr = cmd.Stdout
+	wait, err := startCommand(cmd)
+	if err == nil {
+		err = wait()
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		return &compileError{
+			err:         buildError(compilerOutput.Bytes(), err),
+			diagnostics: parseGoDiagnostics(compilerOutput.Bytes(), SeverityError),
+		}
+	}
+	return nil
+}
+
+// compileError 编译失败，diagnostics 为相对于用户代码的编译器诊断，记录在构建记录中
+type compileError struct {
+	err         error
+	diagnostics []Diagnostic
+}
+
+func (e *compileError) Error() string {
+	return e.err.Error()
+}
+
+func (e *compileError) Unwrap() error {
+	return e.err
+}
+
+// buildArtifact 返回Go函数构建产出的可执行文件路径，每次构建使用独立的文件，
+// 新构建不会覆盖正在执行的旧文件
+func (p *Platform) buildArtifact(fn *Function, buildID string) string {
+	return filepath.Join(p.functionDir(fn), "bin", buildID)
+}
+
+// removeOldArtifacts 删除函数（或版本）目录中旧构建的可执行文件
+func (p *Platform) removeOldArtifacts(fn *Function, buildID string) {
+	dir := filepath.Dir(p.buildArtifact(fn, buildID))
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if entry.Name() != buildID {
+			os.Remove(filepath.Join(dir, entry.Name()))
+		}
+	}
+}
+
+// isCurrentBuild 判断构建是否仍是函数当前代码或对应版本使用的构建
+func (p *Platform) isCurrentBuild(build *Build) bool {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	fn, exists := p.functions[build.FunctionID]
+	if !exists {
+		return false
+	}
+	if build.Version == 0 {
+		return fn.BuildID == build.ID
+	}
+	v, err := fn.findVersion(build.Version)
+	return err == nil && v.BuildID == build.ID
+}
+
+// readyBuild 返回函数可用于执行的构建，构建未完成或失败时返回 *BuildNotReadyError
+func (p *Platform) readyBuild(fn *Function) (*Build, error) {
+	build, ok := p.lookupBuild(fn.BuildID)
+	if !ok {
+		return nil, &BuildNotReadyError{Build: &Build{ID: fn.BuildID, FunctionID: fn.ID, Version: fn.version, State: BuildPending}}
+	}
+	if build.State != BuildReady {
+		return nil, &BuildNotReadyError{Build: build.summary()}
+	}
+	return build, nil
+}
+
+// lookupBuild 返回构建记录的副本
+func (p *Platform) lookupBuild(id string) (*Build, bool) {
+	p.buildsMutex.Lock()
+	defer p.buildsMutex.Unlock()
+
+	build, ok := p.builds[id]
+	if !ok {
+		return nil, false
+	}
+	copied := *build
+	return &copied, true
+}
+
+// updateBuild 修改构建记录并持久化
+func (p *Platform) updateBuild(id string, update func(*Build)) {
+	p.buildsMutex.Lock()
+	build, ok := p.builds[id]
+	if !ok {
+		p.buildsMutex.Unlock()
+		return
+	}
+	updated := *build
+	update(&updated)
+	p.builds[id] = &updated
+	p.buildsMutex.Unlock()
+
+	if err := p.saveBuild(&updated); err != nil {
+		Error("保存构建记录失败: %v", err)
+	}
+}
+
+// GetBuild 获取函数的构建记录，包含完整的构建日志
+func (p *Platform) GetBuild(functionID, buildID string) (*Build, error) {
+	build, ok := p.lookupBuild(buildID)
+	if !ok || build.FunctionID != functionID {
+		return nil, fmt.Errorf("构建不存在: %s", buildID)
+	}
+	return build, nil
+}
+
+// ListBuilds 按创建时间倒序列出函数的构建记录，不含构建日志
+func (p *Platform) ListBuilds(functionID string) []*Build {
+	p.buildsMutex.Lock()
+	defer p.buildsMutex.Unlock()
+
+	builds := make([]*Build, 0)
+	for _, build := range p.builds {
+		if build.FunctionID == functionID {
+			builds = append(builds, build.summary())
+		}
+	}
+	sort.Slice(builds, func(i, j int) bool { return builds[i].CreatedAt.After(builds[j].CreatedAt) })
+	return builds
+}
+
+// buildsDir 返回函数构建记录的保存目录
+func (p *Platform) buildsDir(functionID string) string {
+	return filepath.Join(p.workDir, functionID, "builds")
+}
+
+// saveBuild 将构建记录保存到函数目录下
+func (p *Platform) saveBuild(build *Build) error {
+	dir := p.buildsDir(build.FunctionID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(build, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, "."+build.ID+".tmp")
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, build.ID+".json"))
+}
+
+// pruneBuilds 删除超出保留数量的已结束构建记录
+func (p *Platform) pruneBuilds(functionID string) {
+	used := make(map[string]bool)
+	p.mutex.RLock()
+	if fn, exists := p.functions[functionID]; exists {
+		used[fn.BuildID] = true
+		for _, v := range fn.Versions {
+			used[v.BuildID] = true
+		}
+	}
+	p.mutex.RUnlock()
+
+	kept := 0
+	for _, build := range p.ListBuilds(functionID) {
+		if used[build.ID] || build.State == BuildPending || build.State == BuildBuilding {
+			continue
+		}
+		if kept++; kept <= maxBuildHistory {
+			continue
+		}
+		p.buildsMutex.Lock()
+		delete(p.builds, build.ID)
+		p.buildsMutex.Unlock()
+		os.Remove(filepath.Join(p.buildsDir(functionID), build.ID+".json"))
+	}
+}
+
+// forgetBuilds 删除函数时移除其构建记录
+func (p *Platform) forgetBuilds(functionID string) {
+	p.buildsMutex.Lock()
+	defer p.buildsMutex.Unlock()
+	for id, build := range p.builds {
+		if build.FunctionID == functionID {
+			delete(p.builds, id)
+		}
+	}
+}
+
+// loadBuilds 加载所有函数的构建记录，并为没有可用构建的函数和版本重新构建：
+// 服务重启时中断的构建、升级前部署的函数、以及可执行文件丢失的Go函数
+func (p *Platform) loadBuilds() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for id := range p.functions {
+		files, _ := filepath.Glob(filepath.Join(p.buildsDir(id), "*.json"))
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				continue
+			}
+			var build Build
+			if err := json.Unmarshal(data, &build); err != nil {
+				Error("解析构建记录 %s 失败: %v", file, err)
+				continue
+			}
+			p.builds[build.ID] = &build
+		}
+	}
+
+	type pending struct {
+		fn    *Function
+		build *Build
+	}
+	var resumed []pending
+	for id, fn := range p.functions {
+		updated := *fn
+		changed := false
+		if build := p.resumeBuild(fn); build != nil {
+			updated.BuildID = build.ID
+			resumed = append(resumed, pending{&updated, build})
+			changed = true
+		}
+		updated.Versions = append([]*FunctionVersion(nil), fn.Versions...)
+		for i, v := range fn.Versions {
+			if build := p.resumeBuild(fn.atVersion(v)); build != nil {
+				version := *v
+				version.BuildID = build.ID
+				updated.Versions[i] = &version
+				resumed = append(resumed, pending{updated.atVersion(&version), build})
+				changed = true
+			}
+		}
+		if changed {
+			p.functions[id] = &updated
+		}
+	}
+	if len(resumed) == 0 {
+		return
+	}
+	if err := p.saveToFile(); err != nil {
+		Error("保存函数构建信息失败: %v", err)
+	}
+
+	for _, item := range resumed {
+		p.builds[item.build.ID] = item.build
+		if err := p.saveBuild(item.build); err != nil {
+			Error("保存构建记录失败: %v", err)
+		}
+	}
+	for _, item := range resumed {
+		go p.runBuild(item.fn, item.build)
+	}
+}
+
+// resumeBuild 函数（或版本快照）没有可用的构建时返回新的构建，调用方需持有 p.mutex
+func (p *Platform) resumeBuild(fn *Function) *Build {
+	build, ok := p.builds[fn.BuildID]
+	if ok && build.State == BuildFailed {
+		return nil
+	}
+	if ok && build.State == BuildReady && (fn.Runtime != "go" || fileExists(p.buildArtifact(fn, build.ID))) {
+		return nil
+	}
+	return newBuild(fn)
+}
@@ -0,0 +1,147 @@
+package cloudfunction
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestPlatform 创建测试用的平台，测试结束前等待后台构建完成，避免构建写入已删除的临时目录
+func newTestPlatform(t *testing.T) *Platform {
+	return newTestPlatformWithOptions(t, DefaultOptions())
+}
+
+func newTestPlatformWithOptions(t *testing.T, options Options) *Platform {
+	t.Helper()
+	p := NewPlatformWithOptions(t.TempDir(), options)
+	t.Cleanup(func() { waitForBuilds(t, p) })
+	return p
+}
+
+// waitForBuilds 等待平台上所有已登记的构建结束
+func waitForBuilds(t *testing.T, p *Platform) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Minute)
+	for {
+		running := 0
+		p.buildsMutex.Lock()
+		for _, build := range p.builds {
+			if build.State == BuildPending || build.State == BuildBuilding {
+				running++
+			}
+		}
+		p.buildsMutex.Unlock()
+		if running == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("仍有 %d 个构建未结束", running)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestBuildStatusAndReuse(t *testing.T) {
+	requireTool(t, "node")
+	p := newTestPlatform(t)
+	fn := newNodeFunction("built", "function handler() { return 1; }")
+	if err := p.CreateFunction(fn); err != nil {
+		t.Fatal(err)
+	}
+	first := fn.BuildID
+	waitForBuilds(t, p)
+
+	build, err := p.GetBuild(fn.ID, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if build.State != BuildReady || build.FinishedAt == nil || !strings.Contains(build.Output, "构建成功") {
+		t.Fatalf("build = %+v", build)
+	}
+	if _, err := p.GetBuild("fn_other", first); err == nil {
+		t.Fatal("不应能通过其他函数读取构建记录")
+	}
+
+	// 只修改配置时沿用原来的构建
+	update := newNodeFunction("built", "function handler() { return 1; }")
+	update.Environment = map[string]string{"MODE": "test"}
+	if err := p.UpdateFunction(fn.ID, update); err != nil {
+		t.Fatal(err)
+	}
+	if update.BuildID != first {
+		t.Fatalf("只修改环境变量不应重新构建: %s -> %s", first, update.BuildID)
+	}
+
+	update = newNodeFunction("built", "function handler() { return 2; }")
+	if err := p.UpdateFunction(fn.ID, update); err != nil {
+		t.Fatal(err)
+	}
+	if update.BuildID == first {
+		t.Fatal("修改代码后应重新构建")
+	}
+	waitForBuilds(t, p)
+
+	builds := p.ListBuilds(fn.ID)
+	if len(builds) != 2 || builds[0].ID != update.BuildID || builds[0].Output != "" {
+		t.Fatalf("ListBuilds = %+v", builds)
+	}
+}
+
+func TestExecuteRejectedUntilBuildSucceeds(t *testing.T) {
+	requireTool(t, "python3")
+	options := DefaultOptions()
+	options.BuildConcurrency = 1
+	p := newTestPlatformWithOptions(t, options)
+	fn := &Function{Name: "queued", Runtime: "python", Handler: "handler", Code: "def handler(e, c):\n    return 0\n", Timeout: 10, Memory: 128}
+	if err := p.CreateFunction(fn); err != nil {
+		t.Fatal(err)
+	}
+	waitForBuilds(t, p)
+
+	// 占用唯一的构建名额，新的构建停留在 pending 状态
+	p.buildSlots <- struct{}{}
+	data := buildZip(t, []packageEntry{{name: "main.py", body: "def handler(e, c):\n    return 1\n"}})
+	if _, err := p.UploadPackage(fn.ID, data, "main.handler"); err != nil {
+		t.Fatal(err)
+	}
+	_, err := p.ExecuteFunction(fn.ID, &ExecuteRequest{})
+	var notReady *BuildNotReadyError
+	if !errors.As(err, &notReady) || notReady.Build.State != BuildPending {
+		t.Fatalf("err = %v, want 构建 pending", err)
+	}
+
+	// 构建开始前代码包丢失，构建失败后调用继续被拒绝
+	archive, _, err := p.PackageArchive(fn.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(archive); err != nil {
+		t.Fatal(err)
+	}
+	<-p.buildSlots
+	waitForBuilds(t, p)
+
+	_, err = p.ExecuteFunction(fn.ID, &ExecuteRequest{})
+	if !errors.As(err, &notReady) || notReady.Build.State != BuildFailed {
+		t.Fatalf("err = %v, want 构建失败", err)
+	}
+	build, err := p.GetBuild(fn.ID, notReady.Build.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if build.Error == "" || !strings.Contains(build.Output, "构建失败") {
+		t.Fatalf("构建记录 = error %q output %q", build.Error, build.Output)
+	}
+
+	// 重新上传后构建成功
+	if _, err := p.UploadPackage(fn.ID, data, "main.handler"); err != nil {
+		t.Fatal(err)
+	}
+	waitForBuilds(t, p)
+	resp, err := p.ExecuteFunction(fn.ID, &ExecuteRequest{})
+	if err != nil || !resp.Success {
+		t.Fatalf("resp = %+v, err = %v", resp, err)
+	}
+}
@@ -0,0 +1,117 @@
+package cloudfunction
+
+import (
+	"bytes"
+	"context"
+	"debug/elf"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// custom 运行时：代码包根目录中的可执行文件 bootstrap 按平台的标准输入输出协议处理调用。
+// 每个调用请求是标准输入中的一行JSON（与常驻实例相同的 warmRequest），
+// 每个结果信封占标准输出的一行；bootstrap 逐行处理请求，直到标准输入关闭后退出
+
+// customBootstrapFile custom 运行时代码包中的启动程序
+const customBootstrapFile = "bootstrap"
+
+// customHandlerPattern custom 运行时的入口只通过 FC_HANDLER 传给 bootstrap，由 bootstrap 自行解释
+var customHandlerPattern = regexp.MustCompile(`^[A-Za-z0-9_.:/@-]{1,256}$`)
+
+// executeCustomFunction 执行 custom 函数：可以使用常驻实例时复用 bootstrap 进程，
+// 否则启动新进程，写入一行调用请求后关闭标准输入
+func (p *Platform) executeCustomFunction(fn *Function, inv *invocation) (interface{}, error) {
+	timeout := time.Duration(fn.Timeout) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	dir, err := p.prepareCode(ctx, fn, inv)
+	if err != nil {
+		return nil, err
+	}
+	bootstrap := filepath.Join(dir, customBootstrapFile)
+
+	if p.warmEnabled(fn) {
+		return p.invokeWarm(ctx, fn, inv, timeout, bootstrap)
+	}
+
+	request, err := json.Marshal(&warmRequest{Event: inv.req.Event, Context: inv.req.Context, Invocation: inv.context})
+	if err != nil {
+		return nil, newExecutionError(ErrorTypeValidation, "序列化调用请求失败: %v", err)
+	}
+	cmd, err := p.newCommand(ctx, fn, inv, bootstrap)
+	if err != nil {
+		return nil, newExecutionError(ErrorTypePlatform, "创建执行命令失败: %v", err)
+	}
+	cmd.Stdin = bytes.NewReader(append(request, '\n'))
+
+	// 解析结果
+	return parseFunctionOutput(runCommand(ctx, cmd, timeout))
+}
+
+// checkBootstrap 检查代码包根目录中的 bootstrap：必须是可执行的普通文件，程序的架构与平台相同，脚本的解释器必须存在
+func checkBootstrap(dir string) []Diagnostic {
+	path := filepath.Join(dir, customBootstrapFile)
+	info, err := os.Stat(path)
+	switch {
+	case err != nil:
+		return bootstrapDiagnostics(0, "代码包根目录中没有启动程序 %s", customBootstrapFile)
+	case !info.Mode().IsRegular():
+		return bootstrapDiagnostics(0, "%s 不是普通文件", customBootstrapFile)
+	case info.Mode().Perm()&0111 == 0:
+		return bootstrapDiagnostics(0, "%s 没有可执行权限，打包前请执行 chmod +x %[1]s", customBootstrapFile)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return bootstrapDiagnostics(0, "读取 %s 失败: %v", customBootstrapFile, err)
+	}
+	defer file.Close()
+	head := make([]byte, 256)
+	n, _ := file.Read(head)
+	head = head[:n]
+
+	if bytes.HasPrefix(head, []byte(elf.ELFMAG)) {
+		return checkELF(path, customBootstrapFile, false)
+	}
+	if !bytes.HasPrefix(head, []byte("#!")) {
+		return nil
+	}
+	line, _, _ := bytes.Cut(head[2:], []byte("\n"))
+	fields := strings.Fields(string(line))
+	if len(fields) == 0 {
+		return bootstrapDiagnostics(1, "脚本的 #! 行没有指定解释器")
+	}
+	interpreter := fields[0]
+	if filepath.Base(interpreter) == "env" && len(fields) > 1 {
+		// 函数进程的 PATH 只包含基础目录
+		if interpreter = findInPath(fields[1], defaultPath); interpreter == "" {
+			return bootstrapDiagnostics(1, "在 %s 中找不到脚本的解释器 %s", defaultPath, fields[1])
+		}
+	}
+	if info, err := os.Stat(interpreter); err != nil || info.IsDir() || info.Mode().Perm()&0111 == 0 {
+		return bootstrapDiagnostics(1, "脚本的解释器 %s 不存在或不可执行", interpreter)
+	}
+	return nil
+}
+
+// findInPath 在 PATH 格式的目录列表中查找可执行文件
+func findInPath(name, path string) string {
+	for _, dir := range filepath.SplitList(path) {
+		candidate := filepath.Join(dir, name)
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() && info.Mode().Perm()&0111 != 0 {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// bootstrapDiagnostics 创建指向 bootstrap 的错误诊断
+func bootstrapDiagnostics(line int, format string, args ...interface{}) []Diagnostic {
+	return []Diagnostic{{File: customBootstrapFile, Line: line, Severity: SeverityError, Message: fmt.Sprintf(format, args...)}}
+}
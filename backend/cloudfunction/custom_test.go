@@ -0,0 +1,143 @@
+package cloudfunction
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// customBootstrap 逐行处理请求的 bootstrap，calls 在常驻实例的多次调用之间累加
+const customBootstrap = `#!/usr/bin/env python3
+import json, os, sys
+
+calls = 0
+for line in sys.stdin:
+    request = json.loads(line)
+    calls += 1
+    mode = request["event"].get("mode")
+    if mode == "fail":
+        print(json.dumps({"success": False, "error": "order rejected", "stack": "at bootstrap"}), flush=True)
+    elif mode == "exit":
+        print("crashed while handling", file=sys.stderr, flush=True)
+        sys.exit(4)
+    else:
+        print("not a result line", flush=True)
+        print(json.dumps({"success": True, "result": {
+            "calls": calls,
+            "handler": os.environ["FC_HANDLER"],
+            "request": request["invocation"]["request_id"],
+        }}), flush=True)
+`
+
+// createCustomFunction 以包含 bootstrap 的代码包部署 custom 函数
+func createCustomFunction(t *testing.T, p *Platform, name string) *Function {
+	t.Helper()
+	pkg, err := p.StorePackage(buildZip(t, []packageEntry{{name: customBootstrapFile, body: customBootstrap, mode: 0755}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := &Function{Name: name, Runtime: "custom", Handler: "app.handler", Package: pkg, Timeout: 10, Memory: 128}
+	if err := p.CreateFunction(fn); err != nil {
+		t.Fatal(err)
+	}
+	waitForBuilds(t, p)
+	return fn
+}
+
+func TestCustomRuntimeProtocol(t *testing.T) {
+	requireTool(t, "python3")
+	p := newTestPlatform(t)
+	fn := createCustomFunction(t, p, "custom-warm")
+
+	for want := 1.0; want <= 2; want++ {
+		resp, err := p.ExecuteFunction(fn.ID, &ExecuteRequest{Event: map[string]interface{}{}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, _ := resp.Result.(map[string]interface{})
+		if !resp.Success || result["calls"] != want || result["handler"] != "app.handler" || result["request"] != resp.RequestID {
+			t.Fatalf("第%v次调用: resp = %+v", want, resp)
+		}
+	}
+
+	resp, err := p.ExecuteFunction(fn.ID, &ExecuteRequest{Event: map[string]interface{}{"mode": "fail"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Success || resp.ErrorType != ErrorTypeHandler || resp.Error != "order rejected" || resp.Stack != "at bootstrap" {
+		t.Fatalf("resp = %+v", resp)
+	}
+
+	// 没有输出结果就退出的实例被丢弃，标准错误作为错误栈
+	resp, err = p.ExecuteFunction(fn.ID, &ExecuteRequest{Event: map[string]interface{}{"mode": "exit"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Success || resp.ErrorType != ErrorTypeHandler || !strings.Contains(resp.Stack, "crashed while handling") {
+		t.Fatalf("resp = %+v", resp)
+	}
+	resp, err = p.ExecuteFunction(fn.ID, &ExecuteRequest{Event: map[string]interface{}{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result, _ := resp.Result.(map[string]interface{}); !resp.Success || result["calls"] != 1.0 {
+		t.Fatalf("退出后应启动新实例: resp = %+v", resp)
+	}
+}
+
+func TestCustomRuntimeWithoutWarmInstances(t *testing.T) {
+	requireTool(t, "python3")
+	options := DefaultOptions()
+	options.WarmIdleTimeout = 0
+	p := newTestPlatformWithOptions(t, options)
+	fn := createCustomFunction(t, p, "custom-cold")
+
+	for i := 0; i < 2; i++ {
+		resp, err := p.ExecuteFunction(fn.ID, &ExecuteRequest{Event: map[string]interface{}{}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result, _ := resp.Result.(map[string]interface{}); !resp.Success || result["calls"] != 1.0 {
+			t.Fatalf("resp = %+v, want 每次调用启动新进程", resp)
+		}
+	}
+}
+
+func TestCheckBootstrap(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		mode    os.FileMode
+		message string // 为空表示检查通过
+	}{
+		{name: "损坏的二进制程序", content: "\x7fELF", mode: 0755, message: "不是有效的 ELF"},
+		{name: "env查找解释器", content: "#!/usr/bin/env sh\necho", mode: 0755},
+		{name: "没有可执行权限", content: "#!/bin/sh\n", mode: 0644, message: "没有可执行权限"},
+		{name: "解释器不存在", content: "#!/opt/missing/ruby\n", mode: 0755, message: "/opt/missing/ruby 不存在"},
+		{name: "PATH中没有解释器", content: "#!/usr/bin/env fc-missing-interpreter\n", mode: 0755, message: "找不到脚本的解释器"},
+		{name: "空的#!行", content: "#!\n", mode: 0755, message: "没有指定解释器"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, customBootstrapFile), []byte(tt.content), tt.mode); err != nil {
+				t.Fatal(err)
+			}
+			diagnostics := checkBootstrap(dir)
+			if tt.message == "" {
+				if len(diagnostics) != 0 {
+					t.Fatalf("diagnostics = %+v", diagnostics)
+				}
+				return
+			}
+			if len(diagnostics) != 1 || !strings.Contains(diagnostics[0].Message, tt.message) {
+				t.Fatalf("diagnostics = %+v, want %q", diagnostics, tt.message)
+			}
+		})
+	}
+
+	if diagnostics := checkBootstrap(t.TempDir()); len(diagnostics) != 1 {
+		t.Fatalf("缺少 bootstrap 时 diagnostics = %+v", diagnostics)
+	}
+}
@@ -0,0 +1,302 @@
+package cloudfunction
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// dependencyTimeout 安装一次依赖的超时时间，与函数的超时时间无关
+const dependencyTimeout = 5 * time.Minute
+
+// dependencyReadyFile 依赖安装完成后写入的标记文件，没有标记的缓存目录会被重新安装
+const dependencyReadyFile = ".ready"
+
+// nodeModulesTarball Node.js 代码包中预先打包的依赖，解压后应包含 node_modules 目录
+const nodeModulesTarball = "node_modules.tar.gz"
+
+// runtimeDeps 代码包函数执行时使用的已安装依赖
+type runtimeDeps struct {
+	Dir    string            // 依赖缓存目录，沙箱中只读挂载
+	Env    map[string]string // 函数进程额外的环境变量
+	Python string            // Python 虚拟环境中的解释器
+}
+
+// prepareDependencies 按运行时安装代码包声明的依赖，安装结果按依赖文件的哈希缓存在 workDir/deps 下，
+// 依赖文件不变的代码包和版本共用同一份依赖。没有依赖时返回 nil
+func (p *Platform) prepareDependencies(ctx context.Context, fn *Function, codeDir string) (*runtimeDeps, error) {
+	ctx, cancel := context.WithTimeout(ctx, dependencyTimeout)
+	defer cancel()
+
+	switch fn.Runtime {
+	case "go":
+		return nil, p.prepareGoDependencies(ctx, codeDir)
+	case "nodejs":
+		return p.prepareNodeDependencies(ctx, codeDir)
+	case "python":
+		return p.preparePythonDependencies(ctx, codeDir)
+	}
+	return nil, nil
+}
+
+// prepareGoDependencies 检查 go.mod 中的依赖能否从 vendor 目录或配置的本地模块代理/缓存获得。
+// 带 vendor 目录时编译只使用其中的模块；否则执行一次 go mod download 预先填充模块缓存
+func (p *Platform) prepareGoDependencies(ctx context.Context, codeDir string) error {
+	if !fileExists(filepath.Join(codeDir, "go.mod")) || fileExists(filepath.Join(codeDir, "vendor", "modules.txt")) {
+		return nil
+	}
+
+	hash, err := dependencyHash("go", codeDir, "go.mod", "go.sum")
+	if err != nil {
+		return err
+	}
+	return p.cachedDependency(p.dependencyDir("go", hash), func(dir string) error {
+		cmd := exec.CommandContext(ctx, runtimeBinary("go"), "mod", "download")
+		cmd.Dir = codeDir
+		cmd.Env = p.goBuildEnv(codeDir)
+		_, stderr, err := runCommand(ctx, cmd, dependencyTimeout)
+		return dependencyError("下载Go模块失败", stderr, err)
+	})
+}
+
+// prepareNodeDependencies 准备 package.json 声明的依赖：代码包自带 node_modules 时直接使用；
+// 带 node_modules.tar.gz 时解压到缓存目录；否则从配置的 npm 离线缓存安装。依赖通过 NODE_PATH 加载
+func (p *Platform) prepareNodeDependencies(ctx context.Context, codeDir string) (*runtimeDeps, error) {
+	manifest, err := os.ReadFile(filepath.Join(codeDir, "package.json"))
+	if err != nil || fileExists(filepath.Join(codeDir, "node_modules")) {
+		return nil, nil
+	}
+
+	var pkg struct {
+		Dependencies map[string]string `json:"dependencies"`
+	}
+	if err := json.Unmarshal(manifest, &pkg); err != nil {
+		return nil, newExecutionError(ErrorTypeBuild, "解析package.json失败: %v", err)
+	}
+	hasTarball := fileExists(filepath.Join(codeDir, nodeModulesTarball))
+	if len(pkg.Dependencies) == 0 && !hasTarball {
+		return nil, nil
+	}
+	if !hasTarball && p.options.NpmCache == "" {
+		return nil, newExecutionError(ErrorTypeBuild,
+			"package.json 声明了依赖，但代码包中没有 node_modules 或 %s，平台也未配置 npm 离线缓存", nodeModulesTarball)
+	}
+
+	hash, err := dependencyHash("nodejs", codeDir, "package.json", "package-lock.json", nodeModulesTarball)
+	if err != nil {
+		return nil, err
+	}
+	depsDir := p.dependencyDir("nodejs", hash)
+	err = p.cachedDependency(depsDir, func(dir string) error {
+		if hasTarball {
+			return p.extractNodeModules(filepath.Join(codeDir, nodeModulesTarball), dir)
+		}
+		return p.npmInstall(ctx, codeDir, dir)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &runtimeDeps{
+		Dir: depsDir,
+		Env: map[string]string{"NODE_PATH": filepath.Join(depsDir, "node_modules")},
+	}, nil
+}
+
+// extractNodeModules 解压预先打包的 node_modules
+func (p *Platform) extractNodeModules(tarball, dir string) error {
+	file, err := os.Open(tarball)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	limits := p.packageLimits()
+	limits.skipLinks = true
+	if _, _, err := extractPackage(file, info.Size(), PackageFormatTarGz, dir, limits); err != nil {
+		return newExecutionError(ErrorTypeBuild, "解压%s失败: %v", nodeModulesTarball, err)
+	}
+	if !fileExists(filepath.Join(dir, "node_modules")) {
+		return newExecutionError(ErrorTypeBuild, "%s 中没有 node_modules 目录", nodeModulesTarball)
+	}
+	return nil
+}
+
+// npmInstall 从 npm 离线缓存安装依赖，不执行依赖的安装脚本
+func (p *Platform) npmInstall(ctx context.Context, codeDir, dir string) error {
+	args := []string{"install", "--no-package-lock"}
+	for _, name := range []string{"package.json", "package-lock.json"} {
+		data, err := os.ReadFile(filepath.Join(codeDir, name))
+		if err != nil {
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			return err
+		}
+		if name == "package-lock.json" {
+			args = []string{"ci"}
+		}
+	}
+	args = append(args, "--offline", "--ignore-scripts", "--no-audit", "--no-fund", "--omit=dev", "--cache", p.options.NpmCache)
+
+	cmd := exec.CommandContext(ctx, runtimeBinary("npm"), args...)
+	cmd.Dir = dir
+	cmd.Env = envList(baseEnv(dir, "npm", "node"))
+	_, stderr, err := runCommand(ctx, cmd, dependencyTimeout)
+	return dependencyError("安装npm依赖失败", stderr, err)
+}
+
+// preparePythonDependencies 将 requirements.txt 中的依赖从本地 wheel 目录安装到独立的虚拟环境，
+// 函数使用虚拟环境中的解释器执行。wheel 来自平台配置的目录和代码包中的 wheelhouse 目录
+func (p *Platform) preparePythonDependencies(ctx context.Context, codeDir string) (*runtimeDeps, error) {
+	requirements := filepath.Join(codeDir, "requirements.txt")
+	if !hasRequirements(requirements) {
+		return nil, nil
+	}
+
+	var wheelhouses []string
+	if p.options.PythonWheelhouse != "" {
+		wheelhouses = append(wheelhouses, p.options.PythonWheelhouse)
+	}
+	if fileExists(filepath.Join(codeDir, "wheelhouse")) {
+		wheelhouses = append(wheelhouses, filepath.Join(codeDir, "wheelhouse"))
+	}
+	if len(wheelhouses) == 0 {
+		return nil, newExecutionError(ErrorTypeBuild, "requirements.txt 声明了依赖，但代码包中没有 wheelhouse 目录，平台也未配置本地 wheel 目录")
+	}
+
+	// 虚拟环境链接到宿主解释器，解释器和 wheel 来源变化时重新安装
+	files := []string{"requirements.txt"}
+	if entries, err := os.ReadDir(filepath.Join(codeDir, "wheelhouse")); err == nil {
+		for _, entry := range entries {
+			files = append(files, filepath.Join("wheelhouse", entry.Name()))
+		}
+	}
+	hash, err := dependencyHash("python\x00"+runtimeBinary("python3")+"\x00"+p.options.PythonWheelhouse, codeDir, files...)
+	if err != nil {
+		return nil, err
+	}
+
+	depsDir := p.dependencyDir("python", hash)
+	venv := filepath.Join(depsDir, "venv")
+	err = p.cachedDependency(depsDir, func(dir string) error {
+		env := envList(baseEnv(dir, "python3"))
+
+		cmd := exec.CommandContext(ctx, runtimeBinary("python3"), "-m", "venv", venv)
+		cmd.Env = env
+		if _, stderr, err := runCommand(ctx, cmd, dependencyTimeout); err != nil {
+			return dependencyError("创建Python虚拟环境失败", stderr, err)
+		}
+
+		args := []string{"-m", "pip", "install", "--no-index", "--no-cache-dir", "--disable-pip-version-check", "-r", requirements}
+		for _, wheelhouse := range wheelhouses {
+			args = append(args, "--find-links", wheelhouse)
+		}
+		cmd = exec.CommandContext(ctx, filepath.Join(venv, "bin", "python3"), args...)
+		cmd.Dir = codeDir
+		cmd.Env = env
+		_, stderr, err := runCommand(ctx, cmd, dependencyTimeout)
+		return dependencyError("安装Python依赖失败", stderr, err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &runtimeDeps{Dir: depsDir, Python: filepath.Join(venv, "bin", "python3")}, nil
+}
+
+// hasRequirements 判断 requirements.txt 是否声明了依赖（忽略空行和注释）
+func hasRequirements(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			return true
+		}
+	}
+	return false
+}
+
+// dependencyDir 返回依赖缓存目录
+func (p *Platform) dependencyDir(runtime, hash string) string {
+	return filepath.Join(p.workDir, "deps", runtime, hash)
+}
+
+// cachedDependency 缓存目录没有安装完成的标记时调用 install 安装依赖，
+// 安装失败时删除目录，下次调用重新安装。安装过程串行执行，已安装的缓存不加锁
+func (p *Platform) cachedDependency(dir string, install func(dir string) error) error {
+	ready := filepath.Join(dir, dependencyReadyFile)
+	if fileExists(ready) {
+		return nil
+	}
+
+	p.depsMutex.Lock()
+	defer p.depsMutex.Unlock()
+	if fileExists(ready) {
+		return nil
+	}
+
+	os.RemoveAll(dir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("创建依赖目录失败: %v", err)
+	}
+	if err := install(dir); err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+	if err := os.WriteFile(ready, []byte(time.Now().Format(time.RFC3339)), 0644); err != nil {
+		return fmt.Errorf("写入依赖标记失败: %v", err)
+	}
+	return nil
+}
+
+// dependencyHash 计算依赖文件的哈希，不存在的文件视为空
+func dependencyHash(prefix, dir string, files ...string) (string, error) {
+	hash := sha256.New()
+	io.WriteString(hash, prefix)
+	for _, name := range files {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil && !os.IsNotExist(err) {
+			return "", fmt.Errorf("读取依赖文件 %s 失败: %v", name, err)
+		}
+		fmt.Fprintf(hash, "\x00%s\x00%d\x00", name, len(data))
+		hash.Write(data)
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:32], nil
+}
+
+// dependencyError 将安装命令的错误转换为 build 类型的执行错误，消息中包含命令输出
+func dependencyError(message string, stderr []byte, err error) error {
+	var typed *ExecutionError
+	if err == nil || errors.As(err, &typed) {
+		return err
+	}
+	if output := bytes.TrimSpace(stderr); len(output) > 0 {
+		return &ExecutionError{Type: ErrorTypeBuild, Message: message + ":\n" + truncateStack(string(output))}
+	}
+	return newExecutionError(ErrorTypeBuild, "%s: %v", message, err)
+}
+
+// fileExists 判断文件或目录是否存在
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
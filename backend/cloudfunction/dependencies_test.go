@@ -0,0 +1,241 @@
+package cloudfunction
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDependencyHash(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hash := func(prefix string) string {
+		h, err := dependencyHash(prefix, dir, "requirements.txt", "constraints.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+
+	write("requirements.txt", "requests==2.31.0\n")
+	first := hash("python")
+	if hash("python") != first {
+		t.Fatal("相同的依赖文件应得到相同的哈希")
+	}
+	if hash("python\x00/usr/bin/python3.12") == first {
+		t.Fatal("前缀不同时哈希应不同")
+	}
+
+	// 不存在的文件视为空
+	write("constraints.txt", "")
+	if hash("python") != first {
+		t.Fatal("空文件和不存在的文件应得到相同的哈希")
+	}
+	write("requirements.txt", "requests==2.32.0\n")
+	if hash("python") == first {
+		t.Fatal("依赖文件变化后哈希应变化")
+	}
+}
+
+func TestHasRequirements(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "requirements.txt")
+	if hasRequirements(path) {
+		t.Fatal("不存在的文件不应视为有依赖")
+	}
+	os.WriteFile(path, []byte("# 只有注释\n\n   \n"), 0644)
+	if hasRequirements(path) {
+		t.Fatal("只有注释和空行时不应视为有依赖")
+	}
+	os.WriteFile(path, []byte("# pinned\nsix==1.16.0\n"), 0644)
+	if !hasRequirements(path) {
+		t.Fatal("声明了依赖时应返回 true")
+	}
+}
+
+func TestCachedDependencyRetriesFailedInstall(t *testing.T) {
+	p := newTestPlatform(t)
+	dir := p.dependencyDir("python", "abc")
+
+	installs := 0
+	failing := func(dir string) error {
+		installs++
+		os.WriteFile(filepath.Join(dir, "partial"), nil, 0644)
+		return errors.New("pip 失败")
+	}
+	if err := p.cachedDependency(dir, failing); err == nil {
+		t.Fatal("安装失败应返回错误")
+	}
+	if fileExists(dir) {
+		t.Fatal("安装失败后应删除缓存目录")
+	}
+
+	ok := func(dir string) error {
+		installs++
+		return nil
+	}
+	for i := 0; i < 2; i++ {
+		if err := p.cachedDependency(dir, ok); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 失败后重新安装一次，之后使用缓存
+	if installs != 2 || !fileExists(filepath.Join(dir, dependencyReadyFile)) {
+		t.Fatalf("installs = %d", installs)
+	}
+}
+
+// wheel 构造只包含一个纯 Python 模块的 wheel 文件
+func wheel(t *testing.T, name, module string) string {
+	t.Helper()
+	info := name + "-1.0.dist-info/"
+	return string(buildZip(t, []packageEntry{
+		{name: name + ".py", body: module},
+		{name: info + "METADATA", body: "Metadata-Version: 2.1\nName: " + name + "\nVersion: 1.0\n"},
+		{name: info + "WHEEL", body: "Wheel-Version: 1.0\nGenerator: test\nRoot-Is-Purelib: true\nTag: py3-none-any\n"},
+		{name: info + "RECORD", body: name + ".py,,\n" + info + "METADATA,,\n" + info + "WHEEL,,\n" + info + "RECORD,,\n"},
+	}))
+}
+
+func TestPythonDependenciesInstalledFromWheelhouse(t *testing.T) {
+	requireTool(t, "python3")
+	p := newTestPlatform(t)
+
+	data := buildZip(t, []packageEntry{
+		{name: "requirements.txt", body: "greet==1.0\n"},
+		{name: "wheelhouse/greet-1.0-py3-none-any.whl", body: wheel(t, "greet", "def hello(name):\n    return 'hello ' + name\n")},
+		{name: "main.py", body: "import greet\n\ndef handler(event, context):\n    return greet.hello(event['name'])\n"},
+	})
+
+	var ids []string
+	for _, name := range []string{"deps-a", "deps-b"} {
+		fn := &Function{Name: name, Runtime: "python", Handler: "handler", Code: "def handler(e, c):\n    return 0\n", Timeout: 30, Memory: 128}
+		if err := p.CreateFunction(fn); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := p.UploadPackage(fn.ID, data, "main.handler"); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, fn.ID)
+	}
+
+	for _, id := range ids {
+		waitForBuilds(t, p)
+		resp, err := p.ExecuteFunction(id, &ExecuteRequest{Event: map[string]interface{}{"name": "deps"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := json.Marshal(resp.Result); !resp.Success || string(got) != `"hello deps"` {
+			t.Fatalf("resp = %+v", resp)
+		}
+	}
+
+	// 依赖文件相同的函数共用同一份虚拟环境
+	entries, err := os.ReadDir(filepath.Join(p.workDir, "deps", "python"))
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("依赖缓存目录 = %v, %v; want 1个", entries, err)
+	}
+}
+
+func TestNodeModulesTarball(t *testing.T) {
+	requireTool(t, "node")
+	p := newTestPlatform(t)
+	fn := newNodeFunction("node-deps", "function handler() { return 0; }")
+	if err := p.CreateFunction(fn); err != nil {
+		t.Fatal(err)
+	}
+
+	modules := buildTarGz(t, []packageEntry{
+		{name: "node_modules/pad/index.js", body: "module.exports = (s, n) => s.padStart(n, '0');"},
+		{name: "node_modules/pad/link", symlink: "/etc/passwd"},
+	})
+	data := buildZip(t, []packageEntry{
+		{name: "package.json", body: `{"dependencies": {"pad": "1.0.0"}}`},
+		{name: nodeModulesTarball, body: string(modules)},
+		{name: "index.js", body: "const pad = require('pad');\nexports.handler = async (event) => pad(event.n, 4);\n"},
+	})
+	if _, err := p.UploadPackage(fn.ID, data, "index.handler"); err != nil {
+		t.Fatal(err)
+	}
+
+	waitForBuilds(t, p)
+	resp, err := p.ExecuteFunction(fn.ID, &ExecuteRequest{Event: map[string]interface{}{"n": "7"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := json.Marshal(resp.Result); !resp.Success || string(got) != `"0007"` {
+		t.Fatalf("resp = %+v", resp)
+	}
+}
+
+func TestDependencyInstallCountsTowardsTimeout(t *testing.T) {
+	requireTool(t, "python3")
+	p := newTestPlatform(t)
+	data := buildZip(t, []packageEntry{
+		{name: "requirements.txt", body: "greet==1.0\n"},
+		{name: "wheelhouse/greet-1.0-py3-none-any.whl", body: wheel(t, "greet", "def hello(name):\n    return 'hello ' + name\n")},
+		{name: "main.py", body: "import greet\n\ndef handler(event, context):\n    return greet.hello(event['name'])\n"},
+	})
+	fn := &Function{Name: "slow-deps", Runtime: "python", Handler: "handler", Code: "def handler(e, c):\n    return 0\n", Timeout: 1, Memory: 128}
+	if err := p.CreateFunction(fn); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.UploadPackage(fn.ID, data, "main.handler"); err != nil {
+		t.Fatal(err)
+	}
+	waitForBuilds(t, p)
+
+	// 删除部署时安装的依赖，调用时重新创建虚拟环境（通常超过1秒）
+	if err := os.RemoveAll(filepath.Join(p.workDir, "deps")); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	resp, err := p.ExecuteFunction(fn.ID, &ExecuteRequest{Event: map[string]interface{}{"name": "deps"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Success {
+		t.Skip("依赖安装在1秒内完成")
+	}
+	if resp.ErrorType != ErrorTypeTimeout || resp.Error != "执行超时（1s）" {
+		t.Fatalf("resp = %+v", resp)
+	}
+	if elapsed := time.Since(start); elapsed > 1*time.Second+processGracePeriod+time.Second {
+		t.Fatalf("安装依赖超时后 %v 才返回", elapsed)
+	}
+}
+
+func TestDeployDependencyInstallTimeout(t *testing.T) {
+	requireTool(t, "python3")
+	options := DefaultOptions()
+	options.BuildTimeout = 1
+	p := newTestPlatformWithOptions(t, options)
+	fn := &Function{Name: "deploy-deps", Runtime: "python", Handler: "handler", Code: "def handler(e, c):\n    return 0\n", Timeout: 10, Memory: 128}
+	if err := p.CreateFunction(fn); err != nil {
+		t.Fatal(err)
+	}
+
+	data := buildZip(t, []packageEntry{
+		{name: "requirements.txt", body: "greet==1.0\n"},
+		{name: "wheelhouse/greet-1.0-py3-none-any.whl", body: wheel(t, "greet", "def hello(name):\n    return 'hello ' + name\n")},
+		{name: "main.py", body: "import greet\n\ndef handler(event, context):\n    return greet.hello(event['name'])\n"},
+	})
+	start := time.Now()
+	_, err := p.UploadPackage(fn.ID, data, "main.handler")
+	if err == nil {
+		t.Skip("依赖安装在1秒内完成")
+	}
+	if !strings.Contains(err.Error(), "安装依赖超时（1s）") {
+		t.Fatalf("err = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 1*time.Second+processGracePeriod+time.Second {
+		t.Fatalf("安装依赖超时后 %v 才返回", elapsed)
+	}
+}
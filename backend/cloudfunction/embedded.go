@@ -0,0 +1,588 @@
+package cloudfunction
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/dop251/goja/parser"
+)
+
+// js-embedded 运行时：在平台进程内用纯Go实现的 JavaScript 引擎（goja）执行函数，
+// 不启动子进程，宿主机也不需要安装 Node.js。每次调用使用独立的虚拟机，调用之间不共享状态
+
+// embeddedJSFile 诊断信息和堆栈中用户代码的文件名
+const embeddedJSFile = "index.js"
+
+const (
+	embeddedMaxCallStack = 10000    // 虚拟机的最大调用深度
+	embeddedValueSize    = 16       // 数组元素计入内存预算的大小
+	maxFetchBodySize     = 10 << 20 // fetch 响应体的大小上限
+	maxFetchRedirects    = 10
+)
+
+var (
+	errEmbeddedTimeout = errors.New("执行超时")
+	errEmbeddedMemory  = errors.New("内存超限")
+)
+
+// embeddedRuntime 判断运行时是否在平台进程内执行：不启动子进程，不使用沙箱
+func embeddedRuntime(runtime string) bool {
+	return runtime == "js-embedded" || runtime == "wasm"
+}
+
+// embeddedHost 一次调用的虚拟机和提供给用户代码的宿主API
+type embeddedHost struct {
+	fn     *Function
+	inv    *invocation
+	ctx    context.Context
+	vm     *goja.Runtime
+	budget *embeddedBudget
+
+	parse     goja.Callable // 原始的 JSON.parse，不计入预算
+	stringify goja.Callable // 原始的 JSON.stringify，不计入预算
+}
+
+// embeddedBudget 一次调用的内存预算。引擎不提供单个虚拟机的内存统计，预算按宿主API
+// （事件、JSON、fetch、console）和会产生大块数据的内置函数分配的数据量累计，不受同一进程中其他调用的影响
+type embeddedBudget struct {
+	vm    *goja.Runtime
+	limit int64
+	used  int64
+}
+
+// reserve 计入 n 字节，超过预算时中断虚拟机并返回错误
+func (b *embeddedBudget) reserve(n int64) error {
+	if n > b.limit-b.used {
+		b.used = b.limit + 1
+		b.vm.Interrupt(errEmbeddedMemory)
+		return errEmbeddedMemory
+	}
+	b.used += n
+	return nil
+}
+
+// charge 在宿主函数中计入 n 字节，超过预算时抛出异常，宿主函数不再继续分配。
+// 用户代码捕获异常后，虚拟机在执行下一条指令时中断
+func (b *embeddedBudget) charge(n int64) {
+	if err := b.reserve(n); err != nil {
+		panic(b.vm.NewGoError(err))
+	}
+}
+
+// exceeded 判断调用是否超过了预算
+func (b *embeddedBudget) exceeded() bool {
+	return b.used > b.limit
+}
+
+// executeEmbeddedJSFunction 在新的虚拟机中执行 js-embedded 函数。超时或超过内存预算时中断虚拟机
+func (p *Platform) executeEmbeddedJSFunction(fn *Function, inv *invocation) (interface{}, error) {
+	program, err := goja.Compile(embeddedJSFile, fn.Code, false)
+	if err != nil {
+		return nil, newExecutionError(ErrorTypeHandler, "%v", err)
+	}
+
+	timeout := time.Duration(fn.Timeout) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	vm := goja.New()
+	vm.SetMaxCallStackSize(embeddedMaxCallStack)
+	host := &embeddedHost{fn: fn, inv: inv, ctx: ctx, vm: vm, budget: &embeddedBudget{vm: vm, limit: int64(fn.Memory) << 20}}
+	host.install(p.functionEnv(fn, inv))
+
+	stop := context.AfterFunc(ctx, func() { vm.Interrupt(errEmbeddedTimeout) })
+	defer stop()
+
+	result, err := host.run(program)
+	if err != nil {
+		// 超过预算时抛出的异常可能在虚拟机中断前结束执行
+		if host.budget.exceeded() {
+			err = errEmbeddedMemory
+		}
+		return nil, embeddedError(err, timeout, fn.Memory)
+	}
+	return result, nil
+}
+
+// embeddedError 将虚拟机返回的错误转换为执行错误
+func embeddedError(err error, timeout time.Duration, memoryMB int) error {
+	var interrupted *goja.InterruptedError
+	var exception *goja.Exception
+	var overflow *goja.StackOverflowError
+	switch {
+	case errors.As(err, &interrupted) && interrupted.Value() == errEmbeddedTimeout:
+		return &ExecutionError{Type: ErrorTypeTimeout, Message: fmt.Sprintf("执行超时（%v）", timeout)}
+	case err == errEmbeddedMemory, errors.As(err, &interrupted) && interrupted.Value() == errEmbeddedMemory:
+		return newExecutionError(ErrorTypeOOM, "函数内存不足: 分配的数据超过 %dMB", memoryMB)
+	case errors.As(err, &exception):
+		return &ExecutionError{Type: ErrorTypeHandler, Message: exception.Value().String(), Stack: truncateStack(exception.String())}
+	case errors.As(err, &overflow):
+		return newExecutionError(ErrorTypeHandler, "RangeError: 超过最大调用深度 %d", embeddedMaxCallStack)
+	}
+	return err
+}
+
+// install 注册宿主API：console、process.env、module/exports 和 fetch；JSON 为引擎内置
+func (h *embeddedHost) install(env []string) {
+	vm := h.vm
+	jsonObject := vm.Get("JSON").ToObject(vm)
+	h.parse, _ = goja.AssertFunction(jsonObject.Get("parse"))
+	h.stringify, _ = goja.AssertFunction(jsonObject.Get("stringify"))
+	h.limitBuiltins()
+
+	// 输出与其他运行时的结果一样对密钥值脱敏
+	console := vm.NewObject()
+	for _, level := range []string{"log", "info", "debug", "warn", "error"} {
+		logf := GlobalLogger.Debug
+		if level == "warn" || level == "error" {
+			logf = GlobalLogger.Warn
+		}
+		console.Set(level, h.native(level, func(call goja.FunctionCall) goja.Value {
+			message := h.format(call.Arguments)
+			h.budget.charge(int64(len(message)))
+			logf("函数 %s 的调用 %s 输出: %s", h.fn.ID, h.inv.requestID, redactString(message, h.inv.secrets))
+			return goja.Undefined()
+		}))
+	}
+	vm.Set("console", console)
+
+	envObject := vm.NewObject()
+	for _, entry := range env {
+		if key, value, ok := strings.Cut(entry, "="); ok {
+			envObject.Set(key, value)
+		}
+	}
+	process := vm.NewObject()
+	process.Set("env", envObject)
+	vm.Set("process", process)
+
+	module := vm.NewObject()
+	exports := vm.NewObject()
+	module.Set("exports", exports)
+	vm.Set("module", module)
+	vm.Set("exports", exports)
+
+	vm.Set("fetch", h.native("fetch", h.fetch))
+}
+
+// limitBuiltins 替换会产生大块数据的内置函数，按结果的大小计入内存预算。
+// 结果大小能事先算出的函数在分配前检查，其余在返回后计入
+func (h *embeddedHost) limitBuiltins() {
+	vm := h.vm
+	prototype := func(name string) *goja.Object {
+		return vm.Get(name).ToObject(vm).Get("prototype").ToObject(vm)
+	}
+	stringProto, arrayProto := prototype("String"), prototype("Array")
+	jsonObject := vm.Get("JSON").ToObject(vm)
+	arrayObject := vm.Get("Array").ToObject(vm)
+
+	thisLength := func(call goja.FunctionCall) int64 {
+		return call.This.ToObject(vm).Get("length").ToInteger()
+	}
+	h.wrapBuiltin(stringProto, "repeat", func(call goja.FunctionCall) int64 {
+		return saturatingMul(int64(len(call.This.String())), call.Argument(0).ToInteger()) * 2
+	})
+	for _, name := range []string{"padStart", "padEnd"} {
+		h.wrapBuiltin(stringProto, name, func(call goja.FunctionCall) int64 {
+			return saturatingMul(call.Argument(0).ToInteger(), 2)
+		})
+	}
+	h.wrapBuiltin(arrayProto, "fill", func(call goja.FunctionCall) int64 {
+		return saturatingMul(thisLength(call), embeddedValueSize)
+	})
+	h.wrapBuiltin(arrayProto, "push", func(call goja.FunctionCall) int64 {
+		return int64(len(call.Arguments)) * embeddedValueSize
+	})
+	h.wrapBuiltin(jsonObject, "parse", func(call goja.FunctionCall) int64 {
+		return int64(len(call.Argument(0).String())) * 2
+	})
+	for _, name := range []string{"concat", "replace", "replaceAll", "split"} {
+		h.wrapBuiltin(stringProto, name, nil)
+	}
+	for _, name := range []string{"concat", "slice", "map", "filter", "flat", "flatMap", "join", "splice"} {
+		h.wrapBuiltin(arrayProto, name, nil)
+	}
+	h.wrapBuiltin(arrayObject, "from", nil)
+	h.wrapBuiltin(jsonObject, "stringify", nil)
+}
+
+// wrapBuiltin 替换对象上的内置函数：before 返回调用前计入预算的字节数，
+// before 为空时按返回值的大小计入
+func (h *embeddedHost) wrapBuiltin(object *goja.Object, name string, before func(goja.FunctionCall) int64) {
+	original, ok := goja.AssertFunction(object.Get(name))
+	if !ok {
+		return
+	}
+	wrapped := h.native(name, func(call goja.FunctionCall) goja.Value {
+		if before != nil {
+			h.budget.charge(before(call))
+		}
+		result, err := original(call.This, call.Arguments...)
+		if err != nil {
+			panic(err)
+		}
+		if before == nil {
+			h.budget.charge(embeddedSize(result))
+		}
+		return result
+	})
+	object.DefineDataProperty(name, wrapped, goja.FLAG_TRUE, goja.FLAG_TRUE, goja.FLAG_FALSE)
+}
+
+// embeddedSize 估算值占用的内存：字符串按 UTF-16 编码计算，数组按元素个数计算
+func embeddedSize(value goja.Value) int64 {
+	switch v := value.(type) {
+	case goja.String:
+		return int64(v.Length()) * 2
+	case *goja.Object:
+		if v.ClassName() == "Array" {
+			return v.Get("length").ToInteger() * embeddedValueSize
+		}
+	}
+	return 0
+}
+
+// saturatingMul 计算非负数的乘积，溢出时返回最大值
+func saturatingMul(a, b int64) int64 {
+	if a <= 0 || b <= 0 {
+		return 0
+	}
+	if a > math.MaxInt64/b {
+		return math.MaxInt64
+	}
+	return a * b
+}
+
+// native 创建宿主函数并设置函数名，避免堆栈中出现平台内部的Go函数名
+func (h *embeddedHost) native(name string, fn interface{}) goja.Value {
+	value := h.vm.ToValue(fn)
+	value.(*goja.Object).DefineDataProperty("name", h.vm.ToValue(name), goja.FLAG_FALSE, goja.FLAG_TRUE, goja.FLAG_FALSE)
+	return value
+}
+
+// run 执行用户代码并调用入口函数，入口函数可以返回值或 Promise，
+// 也可以是 (event, context, callback) 形式的回调函数
+func (h *embeddedHost) run(program *goja.Program) (interface{}, error) {
+	vm := h.vm
+	if _, err := vm.RunProgram(program); err != nil {
+		return nil, err
+	}
+
+	handlerValue := vm.Get("module").ToObject(vm).Get("exports").ToObject(vm).Get(h.fn.Handler)
+	if handlerValue == nil || goja.IsUndefined(handlerValue) {
+		handlerValue = vm.Get(h.fn.Handler)
+	}
+	handler, ok := goja.AssertFunction(handlerValue)
+	if !ok {
+		return nil, newExecutionError(ErrorTypeHandler, "找不到入口函数: %s", h.fn.Handler)
+	}
+
+	event, err := h.parseJSON(h.inv.req.Event)
+	if err != nil {
+		return nil, newExecutionError(ErrorTypeValidation, "事件无法传给函数: %v", err)
+	}
+	invocationContext, err := h.invocationContext()
+	if err != nil {
+		return nil, err
+	}
+
+	var result goja.Value
+	if handlerValue.ToObject(vm).Get("length").ToInteger() >= 3 {
+		promise, resolve, reject := vm.NewPromise()
+		callback := func(call goja.FunctionCall) goja.Value {
+			if reason := call.Argument(0); !goja.IsUndefined(reason) && !goja.IsNull(reason) {
+				reject(reason)
+			} else {
+				resolve(call.Argument(1))
+			}
+			return goja.Undefined()
+		}
+		if _, err := handler(goja.Undefined(), event, invocationContext, h.native("callback", callback)); err != nil {
+			return nil, err
+		}
+		result = vm.ToValue(promise)
+	} else if result, err = handler(goja.Undefined(), event, invocationContext); err != nil {
+		return nil, err
+	}
+
+	// 虚拟机没有事件循环和定时器，Promise 必须在入口函数返回时已经完成
+	if promise, ok := result.Export().(*goja.Promise); ok {
+		switch promise.State() {
+		case goja.PromiseStateFulfilled:
+			result = promise.Result()
+		case goja.PromiseStateRejected:
+			return nil, rejectionError(promise.Result())
+		default:
+			return nil, newExecutionError(ErrorTypeHandler, "入口函数返回的 Promise 没有完成（js-embedded 运行时不支持定时器和事件循环）")
+		}
+	}
+
+	output, err := h.stringify(goja.Undefined(), result)
+	if err != nil {
+		var exception *goja.Exception
+		if errors.As(err, &exception) {
+			return nil, newExecutionError(ErrorTypeBadOutput, "返回值无法序列化为JSON: %s", exception.Value().String())
+		}
+		return nil, err
+	}
+	if goja.IsUndefined(output) {
+		return nil, nil
+	}
+	if err := h.budget.reserve(embeddedSize(output)); err != nil {
+		return nil, err
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(output.String()), &value); err != nil {
+		return nil, newExecutionError(ErrorTypeBadOutput, "解析函数返回值失败: %v", err)
+	}
+	return value, nil
+}
+
+// rejectionError 将 Promise 的拒绝原因转换为执行错误，Error 对象带堆栈
+func rejectionError(reason goja.Value) error {
+	typed := &ExecutionError{Type: ErrorTypeHandler, Message: reason.String()}
+	if obj, ok := reason.(*goja.Object); ok {
+		if stack := obj.Get("stack"); stack != nil && !goja.IsUndefined(stack) {
+			typed.Stack = truncateStack(stack.String())
+		}
+	}
+	return typed
+}
+
+// invocationContext 创建与 Node.js 运行时相同的 context 对象：调用请求中的 context 字段加平台的调用信息
+func (h *embeddedHost) invocationContext() (goja.Value, error) {
+	vm := h.vm
+	clientContext := h.inv.req.Context
+	if clientContext == nil {
+		clientContext = map[string]string{}
+	}
+	client, err := h.parseJSON(clientContext)
+	if err != nil {
+		return nil, newExecutionError(ErrorTypeValidation, "调用上下文无法传给函数: %v", err)
+	}
+
+	object := vm.NewObject()
+	for key, value := range clientContext {
+		object.Set(key, value)
+	}
+	info := h.inv.context
+	object.Set("requestId", info.RequestID)
+	object.Set("functionId", info.FunctionID)
+	object.Set("functionName", info.FunctionName)
+	object.Set("functionVersion", info.FunctionVersion)
+	object.Set("namespace", info.Namespace)
+	object.Set("memoryLimitInMB", info.MemoryLimitMB)
+	object.Set("deadlineMs", info.Deadline)
+	object.Set("clientContext", client)
+	object.Set("getRemainingTimeMs", h.native("getRemainingTimeMs", func() int64 {
+		return max(0, time.Until(h.inv.deadline).Milliseconds())
+	}))
+	return object, nil
+}
+
+// parseJSON 经JSON转换为虚拟机中的普通对象
+func (h *embeddedHost) parseJSON(value interface{}) (goja.Value, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.budget.reserve(int64(len(data)) * 2); err != nil {
+		return nil, err
+	}
+	return h.parse(goja.Undefined(), h.vm.ToValue(string(data)))
+}
+
+// format 按 console.log 的习惯拼接参数，对象输出为JSON
+func (h *embeddedHost) format(args []goja.Value) string {
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		parts[i] = arg.String()
+		if obj, ok := arg.(*goja.Object); ok && obj.ClassName() != "Error" && obj.ClassName() != "Function" {
+			if out, err := h.stringify(goja.Undefined(), obj); err == nil && !goja.IsUndefined(out) {
+				parts[i] = out.String()
+			}
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// fetch 实现 fetch(url, {method, headers, body})，只能访问函数 allowlist 网络策略中的目标；
+// 请求在调用的超时时间内同步完成，返回已完成的 Promise
+func (h *embeddedHost) fetch(call goja.FunctionCall) goja.Value {
+	vm := h.vm
+	promise, resolve, reject := vm.NewPromise()
+	if response, err := h.doFetch(call.Argument(0).String(), call.Argument(1)); err != nil {
+		reject(vm.NewTypeError("fetch 失败: %v", err))
+	} else {
+		resolve(response)
+	}
+	return vm.ToValue(promise)
+}
+
+func (h *embeddedHost) doFetch(rawURL string, init goja.Value) (goja.Value, error) {
+	target, err := url.Parse(rawURL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, fmt.Errorf("无效的URL: %s", rawURL)
+	}
+	if err := h.allowTarget(target); err != nil {
+		return nil, err
+	}
+
+	method, body := http.MethodGet, ""
+	headers := map[string]string{}
+	if init != nil && !goja.IsUndefined(init) && !goja.IsNull(init) {
+		options := init.ToObject(h.vm)
+		if v := options.Get("method"); v != nil && !goja.IsUndefined(v) {
+			method = strings.ToUpper(v.String())
+		}
+		if v := options.Get("body"); v != nil && !goja.IsUndefined(v) && !goja.IsNull(v) {
+			body = v.String()
+		}
+		if v := options.Get("headers"); v != nil && !goja.IsUndefined(v) && !goja.IsNull(v) {
+			object := v.ToObject(h.vm)
+			for _, key := range object.Keys() {
+				headers[key] = object.Get(key).String()
+			}
+		}
+	}
+
+	h.budget.charge(int64(len(body)))
+	req, err := http.NewRequestWithContext(h.ctx, method, target.String(), strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxFetchRedirects {
+				return fmt.Errorf("重定向次数超过 %d", maxFetchRedirects)
+			}
+			return h.allowTarget(req.URL)
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxFetchBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxFetchBodySize {
+		return nil, fmt.Errorf("响应体超过 %dMB", maxFetchBodySize>>20)
+	}
+	h.budget.charge(int64(len(data)) * 2)
+	return h.response(resp, string(data)), nil
+}
+
+// allowTarget 检查请求目标是否在函数的网络白名单内，拒绝的目标记录到本次调用
+func (h *embeddedHost) allowTarget(target *url.URL) error {
+	host, port := target.Hostname(), target.Port()
+	if port == "" {
+		port = "80"
+		if target.Scheme == "https" {
+			port = "443"
+		}
+	}
+	network := h.fn.Network
+	if network != nil && network.Mode == NetworkAllowlist && network.allows(host, port) {
+		return nil
+	}
+
+	address := net.JoinHostPort(host, port)
+	h.inv.addNetworkViolation(address)
+	GlobalLogger.Warn("函数 %s 的调用 %s 访问 %s 被网络策略拒绝", h.fn.ID, h.inv.requestID, address)
+	return fmt.Errorf("目标不在函数的网络白名单内: %s", address)
+}
+
+// response 创建 fetch 返回的响应对象，text() 和 json() 返回 Promise
+func (h *embeddedHost) response(resp *http.Response, body string) goja.Value {
+	vm := h.vm
+	headers := vm.NewObject()
+	for key, values := range resp.Header {
+		headers.Set(strings.ToLower(key), strings.Join(values, ", "))
+	}
+
+	response := vm.NewObject()
+	response.Set("status", resp.StatusCode)
+	response.Set("statusText", http.StatusText(resp.StatusCode))
+	response.Set("ok", resp.StatusCode >= 200 && resp.StatusCode < 300)
+	response.Set("url", resp.Request.URL.String())
+	response.Set("headers", headers)
+	response.Set("text", h.native("text", func() goja.Value {
+		promise, resolve, _ := vm.NewPromise()
+		resolve(body)
+		return vm.ToValue(promise)
+	}))
+	response.Set("json", h.native("json", func() goja.Value {
+		promise, resolve, reject := vm.NewPromise()
+		h.budget.charge(int64(len(body)) * 2)
+		if value, err := h.parse(goja.Undefined(), vm.ToValue(body)); err != nil {
+			var exception *goja.Exception
+			if errors.As(err, &exception) {
+				reject(exception.Value())
+			} else {
+				reject(vm.NewGoError(err))
+			}
+		} else {
+			resolve(value)
+		}
+		return vm.ToValue(promise)
+	}))
+	return response
+}
+
+// checkEmbeddedJSCode 使用引擎的解析器和编译器检查语法
+func checkEmbeddedJSCode(fn *Function) ([]Diagnostic, error) {
+	program, err := parser.ParseFile(nil, embeddedJSFile, fn.Code, 0)
+	if err != nil {
+		var list parser.ErrorList
+		if !errors.As(err, &list) {
+			return []Diagnostic{{File: embeddedJSFile, Severity: SeverityError, Message: err.Error()}}, nil
+		}
+		// 解析器从同一位置恢复时会重复报告错误
+		var diagnostics []Diagnostic
+		seen := map[string]bool{}
+		for _, e := range list {
+			key := fmt.Sprintf("%d:%d:%s", e.Position.Line, e.Position.Column, e.Message)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			diagnostics = append(diagnostics, Diagnostic{
+				File:     embeddedJSFile,
+				Line:     e.Position.Line,
+				Column:   e.Position.Column,
+				Severity: SeverityError,
+				Message:  e.Message,
+			})
+		}
+		return diagnostics, nil
+	}
+
+	if _, err := goja.CompileAST(program, false); err != nil {
+		diagnostic := Diagnostic{File: embeddedJSFile, Severity: SeverityError, Message: err.Error()}
+		var syntaxErr *goja.CompilerSyntaxError
+		if errors.As(err, &syntaxErr) && syntaxErr.File != nil {
+			position := syntaxErr.File.Position(syntaxErr.Offset)
+			diagnostic.Line, diagnostic.Column, diagnostic.Message = position.Line, position.Column, syntaxErr.Message
+		}
+		return []Diagnostic{diagnostic}, nil
+	}
+	return nil, nil
+}
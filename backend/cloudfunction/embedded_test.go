@@ -0,0 +1,215 @@
+package cloudfunction
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newEmbeddedFunction(name, code string) *Function {
+	return &Function{Name: name, Runtime: "js-embedded", Handler: "handler", Code: code, Timeout: 2, Memory: 64}
+}
+
+// executeEmbedded 部署 js-embedded 函数并执行一次
+func executeEmbedded(t *testing.T, p *Platform, fn *Function, event interface{}) *ExecuteResponse {
+	t.Helper()
+	if err := p.CreateFunction(fn); err != nil {
+		t.Fatal(err)
+	}
+	waitForBuilds(t, p)
+	resp, err := p.ExecuteFunction(fn.ID, &ExecuteRequest{Event: event})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestEmbeddedJSHandlers(t *testing.T) {
+	p := newTestPlatform(t)
+
+	resp := executeEmbedded(t, p, newEmbeddedFunction("embedded-async", `
+exports.handler = async (event, context) => {
+  const doubled = await Promise.resolve(event.items.map(n => n * 2));
+  return {doubled, request: context.requestId, env: process.env.FC_FUNCTION_NAME};
+};`), map[string]interface{}{"items": []int{1, 2}})
+	result, _ := resp.Result.(map[string]interface{})
+	if got, _ := json.Marshal(result["doubled"]); !resp.Success || string(got) != "[2,4]" {
+		t.Fatalf("resp = %+v", resp)
+	}
+	if result["request"] != resp.RequestID || result["env"] != "embedded-async" {
+		t.Fatalf("调用上下文 = %v", result)
+	}
+
+	resp = executeEmbedded(t, p, newEmbeddedFunction("embedded-callback",
+		"function handler(event, context, callback) { callback(new Error('bad input: ' + event.id)); }"),
+		map[string]interface{}{"id": 7})
+	if resp.Success || resp.ErrorType != ErrorTypeHandler || !strings.Contains(resp.Error, "bad input: 7") {
+		t.Fatalf("resp = %+v", resp)
+	}
+
+	// 没有事件循环，未完成的 Promise 直接报错而不是等到超时
+	resp = executeEmbedded(t, p, newEmbeddedFunction("embedded-pending",
+		"exports.handler = () => new Promise(() => {});"), nil)
+	if resp.Success || resp.ErrorType != ErrorTypeHandler || !strings.Contains(resp.Error, "Promise 没有完成") {
+		t.Fatalf("resp = %+v", resp)
+	}
+}
+
+func TestEmbeddedJSTimeout(t *testing.T) {
+	p := newTestPlatform(t)
+	fn := newEmbeddedFunction("embedded-loop", "function handler() { for (;;) {} }")
+	fn.Timeout = 1
+
+	start := time.Now()
+	resp := executeEmbedded(t, p, fn, nil)
+	if resp.Success || resp.ErrorType != ErrorTypeTimeout {
+		t.Fatalf("resp = %+v, want timeout", resp)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Fatalf("死循环在 %v 后才被中断", elapsed)
+	}
+}
+
+func TestEmbeddedJSMemoryLimit(t *testing.T) {
+	p := newTestPlatform(t)
+	fn := newEmbeddedFunction("embedded-alloc", `function handler() {
+  const chunks = [];
+  for (let i = 0; ; i++) {
+    chunks.push(new Array(1 << 16).fill(i));
+  }
+}`)
+	fn.Timeout = 10
+
+	resp := executeEmbedded(t, p, fn, nil)
+	if resp.Success || resp.ErrorType != ErrorTypeOOM {
+		t.Fatalf("resp = %+v, want oom", resp)
+	}
+
+	// 超限的虚拟机不影响之后的调用
+	small := executeEmbedded(t, p, newEmbeddedFunction("embedded-small", "function handler() { return new Array(1000).fill(1).length; }"), nil)
+	if !small.Success || small.Result != float64(1000) {
+		t.Fatalf("resp = %+v", small)
+	}
+}
+
+func TestEmbeddedJSMemoryBudget(t *testing.T) {
+	p := newTestPlatform(t)
+	tests := []struct {
+		name string
+		code string
+	}{
+		// 结果大小能事先算出的内置函数在分配前拒绝
+		{name: "repeat", code: `function handler() { return 'x'.repeat(1e9).length; }`},
+		{name: "catch", code: `function handler() {
+  try { 'x'.padEnd(1e9); } catch (e) {}
+  return 1;
+}`},
+		{name: "join", code: `function handler() {
+  let s = 'x';
+  for (let i = 0; i < 40; i++) { s = [s, s].join(''); }
+  return s.length;
+}`},
+		{name: "json", code: `function handler() {
+  const parts = [];
+  for (let i = 0; ; i++) { parts.push(JSON.stringify({i: i, pad: 'y'.repeat(4096)})); }
+}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			resp := executeEmbedded(t, p, newEmbeddedFunction("budget-"+tt.name, tt.code), nil)
+			if resp.Success || resp.ErrorType != ErrorTypeOOM {
+				t.Fatalf("resp = %+v, want oom", resp)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Fatalf("超过预算后 %v 才中断", elapsed)
+			}
+		})
+	}
+}
+
+func TestEmbeddedJSBudgetIgnoresOtherAllocations(t *testing.T) {
+	p := newTestPlatform(t)
+	fn := newEmbeddedFunction("embedded-steady", `function handler() {
+  const start = Date.now();
+  let total = 0;
+  while (Date.now() - start < 500) { total++; }
+  return total > 0;
+}`)
+
+	if err := p.CreateFunction(fn); err != nil {
+		t.Fatal(err)
+	}
+	waitForBuilds(t, p)
+
+	// 函数执行期间平台进程中其他代码分配的内存远超函数的 memory，不计入函数的预算
+	finished := make(chan struct{})
+	allocated := make(chan [][]byte)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		var keep [][]byte
+		for len(keep) < 160 {
+			keep = append(keep, bytes.Repeat([]byte{1}, 1<<20))
+		}
+		<-finished
+		allocated <- keep
+	}()
+	resp, err := p.ExecuteFunction(fn.ID, &ExecuteRequest{})
+	close(finished)
+	<-allocated
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Success || resp.Result != true {
+		t.Fatalf("resp = %+v", resp)
+	}
+}
+
+func TestEmbeddedJSConsoleRedactsSecrets(t *testing.T) {
+	options := DefaultOptions()
+	options.SecretsMasterKey = "test-master-key"
+	p := newTestPlatformWithOptions(t, options)
+	if _, err := p.Secrets().Put("API_TOKEN", "tok-9f8e7d"); err != nil {
+		t.Fatal(err)
+	}
+	fn := newEmbeddedFunction("embedded-secret", `function handler() {
+  console.warn('token', process.env.TOKEN);
+  return 1;
+}`)
+	fn.Environment = map[string]string{"TOKEN": "${secret:API_TOKEN}"}
+	if err := p.CreateFunction(fn); err != nil {
+		t.Fatal(err)
+	}
+	waitForBuilds(t, p)
+
+	var output bytes.Buffer
+	logger := GlobalLogger
+	GlobalLogger = &Logger{level: LogLevelDebug, logger: log.New(&output, "", 0)}
+	resp, err := p.ExecuteFunction(fn.ID, &ExecuteRequest{})
+	GlobalLogger = logger
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Success {
+		t.Fatalf("resp = %+v", resp)
+	}
+	if logged := output.String(); strings.Contains(logged, "tok-9f8e7d") || !strings.Contains(logged, "token "+RedactedValue) {
+		t.Fatalf("console 输出没有脱敏: %s", logged)
+	}
+}
+
+func TestCheckEmbeddedJSCode(t *testing.T) {
+	diagnostics, err := checkEmbeddedJSCode(&Function{Code: "function handler() {\n  var x = ;\n}\n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diagnostics) == 0 || diagnostics[0].Line != 2 || diagnostics[0].File != embeddedJSFile {
+		t.Fatalf("diagnostics = %+v", diagnostics)
+	}
+	if diagnostics, _ := checkEmbeddedJSCode(&Function{Code: "exports.handler = async () => 1;"}); len(diagnostics) != 0 {
+		t.Fatalf("有效代码的诊断 = %+v", diagnostics)
+	}
+}
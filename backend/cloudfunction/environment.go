@@ -0,0 +1,344 @@
+package cloudfunction
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 平台注入给函数的环境变量，用户不能覆盖
+const (
+	EnvFunctionID        = "FC_FUNCTION_ID"
+	EnvFunctionName      = "FC_FUNCTION_NAME"
+	EnvFunctionNamespace = "FC_FUNCTION_NAMESPACE"
+	EnvFunctionVersion   = "FC_FUNCTION_VERSION"
+	EnvFunctionMemory    = "FC_FUNCTION_MEMORY_MB"
+	EnvFunctionTimeout   = "FC_FUNCTION_TIMEOUT"
+	EnvRuntime           = "FC_RUNTIME"
+	EnvHandler           = "FC_HANDLER"
+	EnvRequestID         = "FC_REQUEST_ID"
+	EnvInvocationContext = "FC_INVOCATION_CONTEXT"
+	EnvFunctionEvent     = "FUNCTION_EVENT"
+	EnvFunctionContext   = "FUNCTION_CONTEXT"
+	EnvWorker            = "FC_WORKER" // 常驻实例模式，调用请求从标准输入逐行读取
+)
+
+// deniedHostEnv 平台自身的敏感配置，即使匹配白名单也不会传给函数
+var deniedHostEnv = map[string]bool{
+	"SECRETS_MASTER_KEY":    true,
+	"SECRETS_PREVIOUS_KEYS": true,
+}
+
+// reservedEnvPrefix 平台保留的环境变量前缀
+const reservedEnvPrefix = "FC_"
+
+// defaultPath 函数进程的基础 PATH，运行时所在目录会被追加在前面
+const defaultPath = "/usr/local/bin:/usr/bin:/bin"
+
+// goToolchainEnv 编译Go函数时从宿主进程继承的工具链变量
+var goToolchainEnv = []string{
+	"GOROOT", "GOPATH", "GOCACHE", "GOMODCACHE", "GOPROXY", "GOFLAGS",
+	"GOSUMDB", "GONOSUMDB", "GOPRIVATE", "GONOPROXY", "GOTOOLCHAIN", "CGO_ENABLED",
+}
+
+// InvocationContext 传给入口函数的调用上下文，以JSON形式通过 FC_INVOCATION_CONTEXT 传入函数进程
+type InvocationContext struct {
+	RequestID       string            `json:"request_id"`
+	FunctionID      string            `json:"function_id"`
+	FunctionName    string            `json:"function_name"`
+	Namespace       string            `json:"namespace"`
+	FunctionVersion string            `json:"function_version"` // 版本号，当前代码为 $LATEST
+	Alias           string            `json:"alias,omitempty"`
+	MemoryLimitMB   int               `json:"memory_limit_mb"`
+	Timeout         int               `json:"timeout"`
+	Deadline        int64             `json:"deadline_ms"`              // 截止时间（Unix毫秒）
+	ClientContext   map[string]string `json:"client_context,omitempty"` // 调用请求中的 context
+}
+
+// invocation 单次调用的上下文
+type invocation struct {
+	req       *ExecuteRequest
+	requestID string
+	startTime time.Time
+	deadline  time.Time
+	context   *InvocationContext
+
+	build      *Build           // 执行使用的构建
+	deps       *runtimeDeps     // 代码包函数已安装的依赖
+	layers     []*preparedLayer // 函数引用的已解压的层
+	packageDir string           // 使用中的代码包解压目录，调用结束时释放
+
+	secrets []string // 注入的密钥值，在平台进程内执行的函数写日志前脱敏
+
+	mutex      sync.Mutex
+	violations []string // 被网络策略拒绝的访问目标
+}
+
+// release 释放调用使用的代码包解压目录
+func (inv *invocation) release(p *Platform) {
+	if inv.packageDir != "" {
+		p.packageDirs.release(inv.packageDir)
+		inv.packageDir = ""
+	}
+}
+
+// newInvocation 为一次调用生成请求ID并计算截止时间
+func newInvocation(fn *Function, req *ExecuteRequest) *invocation {
+	now := time.Now()
+	inv := &invocation{
+		req:       req,
+		requestID: generateRequestID(),
+		startTime: now,
+		deadline:  now.Add(time.Duration(fn.Timeout) * time.Second),
+	}
+	inv.context = &InvocationContext{
+		RequestID:       inv.requestID,
+		FunctionID:      fn.ID,
+		FunctionName:    fn.Name,
+		Namespace:       fn.Namespace,
+		FunctionVersion: fn.versionQualifier(),
+		Alias:           fn.alias,
+		MemoryLimitMB:   fn.Memory,
+		Timeout:         fn.Timeout,
+		Deadline:        inv.deadline.UnixMilli(),
+		ClientContext:   req.Context,
+	}
+	return inv
+}
+
+// addNetworkViolation 记录一次被网络策略拒绝的访问
+func (inv *invocation) addNetworkViolation(target string) {
+	inv.mutex.Lock()
+	defer inv.mutex.Unlock()
+	inv.violations = append(inv.violations, target)
+}
+
+// networkViolations 返回本次调用中被网络策略拒绝的访问目标
+func (inv *invocation) networkViolations() []string {
+	inv.mutex.Lock()
+	defer inv.mutex.Unlock()
+	return append([]string(nil), inv.violations...)
+}
+
+// generateRequestID 生成随机的请求ID
+func generateRequestID() string {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return "req_" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return "req_" + hex.EncodeToString(buf)
+}
+
+// runtimeBinaries 缓存解析后的运行时可执行文件路径
+var runtimeBinaries struct {
+	sync.Mutex
+	paths map[string]string
+}
+
+// runtimeBinary 解析运行时可执行文件的真实路径。
+// 函数进程不继承宿主环境，因此需要绕过 pyenv 等依赖环境变量的 shim 脚本
+func runtimeBinary(name string) string {
+	runtimeBinaries.Lock()
+	defer runtimeBinaries.Unlock()
+
+	if path, ok := runtimeBinaries.paths[name]; ok {
+		return path
+	}
+	if runtimeBinaries.paths == nil {
+		runtimeBinaries.paths = make(map[string]string)
+	}
+
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return name
+	}
+	if name == "python3" {
+		if output, err := exec.Command(path, "-c", "import sys; print(sys.executable)").Output(); err == nil {
+			if executable := string(bytes.TrimSpace(output)); executable != "" {
+				path = executable
+			}
+		}
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+
+	runtimeBinaries.paths[name] = path
+	return path
+}
+
+// runtimePath 生成包含运行时所在目录的 PATH
+func runtimePath(binaries ...string) string {
+	var dirs []string
+	for _, name := range binaries {
+		if path := runtimeBinary(name); filepath.IsAbs(path) {
+			dirs = append(dirs, filepath.Dir(path))
+		}
+	}
+	return strings.Join(append(dirs, defaultPath), string(os.PathListSeparator))
+}
+
+// baseEnv 所有函数进程共有的最小环境
+func baseEnv(dir string, binaries ...string) map[string]string {
+	return map[string]string{
+		"PATH":   runtimePath(binaries...),
+		"HOME":   dir,
+		"TMPDIR": os.TempDir(),
+		"LANG":   "C.UTF-8",
+		"LC_ALL": "C.UTF-8",
+	}
+}
+
+// runtimeEnv 各运行时需要的额外变量
+func runtimeEnv(runtime string) map[string]string {
+	switch runtime {
+	case "nodejs":
+		return map[string]string{"NODE_ENV": "production"}
+	case "python":
+		return map[string]string{
+			"PYTHONUNBUFFERED":        "1",
+			"PYTHONDONTWRITEBYTECODE": "1",
+			"PYTHONIOENCODING":        "utf-8",
+		}
+	}
+	return nil
+}
+
+// runtimeBinaryNames 运行时执行函数时需要的可执行文件
+func runtimeBinaryNames(runtime string) []string {
+	switch runtime {
+	case "nodejs":
+		return []string{"node"}
+	case "python":
+		return []string{"python3"}
+	}
+	return nil
+}
+
+// functionEnv 生成函数进程的完整环境：最小基础环境、白名单内的宿主变量、
+// 运行时变量、函数配置的环境变量，最后是平台注入的变量
+func (p *Platform) functionEnv(fn *Function, inv *invocation) []string {
+	env := baseEnv(p.functionDir(fn), runtimeBinaryNames(fn.Runtime)...)
+
+	for key, value := range p.allowedHostEnv() {
+		env[key] = value
+	}
+	for key, value := range runtimeEnv(fn.Runtime) {
+		env[key] = value
+	}
+	if inv.deps != nil {
+		for key, value := range inv.deps.Env {
+			env[key] = value
+		}
+	}
+	layerPathEnv(env, fn.Runtime, inv.layers)
+	for key, value := range fn.Environment {
+		env[key] = value
+	}
+
+	env[EnvFunctionID] = fn.ID
+	env[EnvFunctionName] = fn.Name
+	env[EnvFunctionNamespace] = fn.Namespace
+	env[EnvFunctionVersion] = fn.versionQualifier()
+	env[EnvFunctionMemory] = strconv.Itoa(fn.Memory)
+	env[EnvFunctionTimeout] = strconv.Itoa(fn.Timeout)
+	env[EnvRuntime] = fn.Runtime
+	env[EnvHandler] = fn.Handler
+	env[EnvRequestID] = inv.requestID
+
+	if inv.req.Event != nil {
+		eventBytes, _ := json.Marshal(inv.req.Event)
+		env[EnvFunctionEvent] = string(eventBytes)
+	}
+	if inv.req.Context != nil {
+		contextBytes, _ := json.Marshal(inv.req.Context)
+		env[EnvFunctionContext] = string(contextBytes)
+	}
+	invocationBytes, _ := json.Marshal(inv.context)
+	env[EnvInvocationContext] = string(invocationBytes)
+
+	return envList(env)
+}
+
+// goBuildEnv 编译Go函数使用的环境：最小基础环境加宿主的Go工具链配置，不包含函数的环境变量。
+// 配置了 GoProxy/GoModCache 时覆盖宿主配置；代码包带 vendor 目录时只使用其中的模块；
+// 引用了Go模块层时使用生成的工作区文件
+func (p *Platform) goBuildEnv(dir string) []string {
+	env := baseEnv(dir, "go")
+	// 未显式配置 GOCACHE/GOPATH 时，go 命令根据宿主 HOME 计算默认位置
+	if home, err := os.UserHomeDir(); err == nil {
+		env["HOME"] = home
+	}
+	for _, key := range goToolchainEnv {
+		if value, ok := os.LookupEnv(key); ok {
+			env[key] = value
+		}
+	}
+
+	if p.options.GoProxy != "" {
+		env["GOPROXY"] = p.options.GoProxy
+		// 本地代理或离线时无法访问校验数据库，依赖 go.sum 校验
+		if !strings.HasPrefix(p.options.GoProxy, "https://") {
+			env["GOSUMDB"] = "off"
+		}
+	}
+	if p.options.GoModCache != "" {
+		env["GOMODCACHE"] = p.options.GoModCache
+	}
+	if workFile := filepath.Join(dir, goLayersWorkFile); fileExists(workFile) {
+		// 工作区模式不允许 -mod=mod
+		env["GOWORK"] = workFile
+		env["GOFLAGS"] = ""
+	} else if fileExists(filepath.Join(dir, "vendor", "modules.txt")) {
+		env["GOFLAGS"] = "-mod=vendor"
+	} else if fileExists(filepath.Join(dir, "go.mod")) {
+		env["GOFLAGS"] = "-mod=mod"
+	}
+	return envList(env)
+}
+
+// allowedHostEnv 返回白名单内的宿主环境变量，支持 "PREFIX_*" 形式的前缀匹配
+func (p *Platform) allowedHostEnv() map[string]string {
+	allowed := make(map[string]string)
+	if len(p.options.HostEnvAllowlist) == 0 {
+		return allowed
+	}
+
+	for _, entry := range os.Environ() {
+		key, value, _ := strings.Cut(entry, "=")
+		if deniedHostEnv[key] {
+			continue
+		}
+		for _, pattern := range p.options.HostEnvAllowlist {
+			if pattern == key || (strings.HasSuffix(pattern, "*") && strings.HasPrefix(key, strings.TrimSuffix(pattern, "*"))) {
+				allowed[key] = value
+				break
+			}
+		}
+	}
+	return allowed
+}
+
+// isReservedEnv 检查环境变量名是否为平台保留
+func isReservedEnv(key string) bool {
+	return strings.HasPrefix(key, reservedEnvPrefix) || key == EnvFunctionEvent || key == EnvFunctionContext
+}
+
+// envList 将环境变量映射转换为排序后的 KEY=VALUE 列表
+func envList(env map[string]string) []string {
+	list := make([]string, 0, len(env))
+	for key, value := range env {
+		list = append(list, key+"="+value)
+	}
+	sort.Strings(list)
+	return list
+}
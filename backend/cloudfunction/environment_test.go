@@ -0,0 +1,160 @@
+package cloudfunction
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestIsReservedEnv(t *testing.T) {
+	tests := []struct {
+		key      string
+		reserved bool
+	}{
+		{EnvFunctionID, true},
+		{EnvRequestID, true},
+		{"FC_CUSTOM", true},
+		{EnvFunctionEvent, true},
+		{EnvFunctionContext, true},
+		{"FC", false},
+		{"fc_lowercase", false},
+		{"MY_FC_VALUE", false},
+		{"FUNCTION_EVENTS", false},
+		{"DB_PASSWORD", false},
+	}
+	for _, tt := range tests {
+		if got := isReservedEnv(tt.key); got != tt.reserved {
+			t.Errorf("isReservedEnv(%q) = %v, want %v", tt.key, got, tt.reserved)
+		}
+	}
+}
+
+func TestValidateConfigReservedEnv(t *testing.T) {
+	p := newTestPlatform(t)
+	tests := []struct {
+		key     string
+		wantErr string
+	}{
+		{key: "API_URL"},
+		{key: "FC_FUNCTION_ID", wantErr: "为平台保留"},
+		{key: "FC_ANYTHING", wantErr: "为平台保留"},
+		{key: EnvFunctionEvent, wantErr: "为平台保留"},
+		{key: EnvFunctionContext, wantErr: "为平台保留"},
+		{key: "1INVALID", wantErr: "无效的环境变量名"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			fn := &Function{
+				Runtime:     "python",
+				Handler:     "handler",
+				Code:        "def handler(event, context):\n    return event\n",
+				Timeout:     10,
+				Memory:      128,
+				Environment: map[string]string{tt.key: "value"},
+			}
+			err := p.validateConfig(fn)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validateConfig: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("validateConfig err = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFunctionEnv(t *testing.T) {
+	t.Setenv("FCTEST_ALLOWED", "yes")
+	t.Setenv("FCTEST_PREFIX_A", "a")
+	t.Setenv("FCTEST_HIDDEN", "leak")
+	t.Setenv("SECRETS_MASTER_KEY", "master")
+
+	p := &Platform{workDir: t.TempDir(), options: Options{
+		HostEnvAllowlist: []string{"FCTEST_ALLOWED", "FCTEST_PREFIX_*", "SECRETS_*"},
+	}}
+	fn := &Function{
+		ID:        "fn_1",
+		Name:      "hello",
+		Namespace: DefaultNamespace,
+		Runtime:   "python",
+		Handler:   "handler",
+		Memory:    128,
+		Timeout:   10,
+		// 配置校验会拒绝保留变量，这里模拟绕过校验的旧数据
+		Environment: map[string]string{
+			"API_URL":        "https://example.com",
+			"FCTEST_ALLOWED": "overridden",
+			EnvFunctionID:    "fn_fake",
+			EnvRequestID:     "fake",
+		},
+	}
+	inv := newInvocation(fn, &ExecuteRequest{Event: map[string]interface{}{"a": 1}})
+
+	env := make(map[string]string)
+	for _, entry := range p.functionEnv(fn, inv) {
+		key, value, _ := strings.Cut(entry, "=")
+		env[key] = value
+	}
+
+	tests := []struct {
+		key   string
+		want  string
+		unset bool
+	}{
+		{key: "API_URL", want: "https://example.com"},
+		{key: "FCTEST_ALLOWED", want: "overridden"},
+		{key: "FCTEST_PREFIX_A", want: "a"},
+		{key: "FCTEST_HIDDEN", unset: true},
+		{key: "SECRETS_MASTER_KEY", unset: true},
+		{key: EnvFunctionID, want: "fn_1"},
+		{key: EnvFunctionName, want: "hello"},
+		{key: EnvRequestID, want: inv.requestID},
+		{key: EnvFunctionVersion, want: LatestQualifier},
+		{key: EnvFunctionEvent, want: `{"a":1}`},
+	}
+	for _, tt := range tests {
+		value, ok := env[tt.key]
+		if tt.unset {
+			if ok {
+				t.Errorf("%s 不应传给函数, got %q", tt.key, value)
+			}
+			continue
+		}
+		if value != tt.want {
+			t.Errorf("%s = %q, want %q", tt.key, value, tt.want)
+		}
+	}
+}
+
+func TestFunctionProcessDoesNotInheritHostEnv(t *testing.T) {
+	requireTool(t, "python3")
+	t.Setenv("FCTEST_HOST_ONLY", "should-not-leak")
+
+	p := newTestPlatform(t)
+	fn := &Function{Name: "env", Runtime: "python", Handler: "handler", Timeout: 10, Memory: 128,
+		Code:        "import os\n\ndef handler(event, context):\n    return sorted(os.environ.keys())\n",
+		Environment: map[string]string{"APP_MODE": "test"}}
+	if err := p.CreateFunction(fn); err != nil {
+		t.Fatal(err)
+	}
+	waitForBuilds(t, p)
+	resp, err := p.ExecuteFunction(fn.ID, &ExecuteRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Success {
+		t.Fatalf("执行失败: %s", resp.Error)
+	}
+	keys := fmt.Sprint(resp.Result)
+	if strings.Contains(keys, "FCTEST_HOST_ONLY") {
+		t.Fatalf("宿主环境变量被传给了函数: %s", keys)
+	}
+	for _, key := range []string{"APP_MODE", "PATH", EnvFunctionID, EnvRequestID} {
+		if !strings.Contains(keys, key) {
+			t.Errorf("函数环境中缺少 %s: %s", key, keys)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package cloudfunction
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// 函数执行的错误类型，作为 ExecuteResponse.ErrorType 返回并计入 Metrics.ErrorsByType
+const (
+	ErrorTypeValidation = "validation" // 函数配置或调用参数无效，函数没有执行（如引用的密钥不存在）
+	ErrorTypeBuild      = "build"      // 编译失败
+	ErrorTypeTimeout    = "timeout"    // 执行超过函数的超时时间，整个进程组已被终止
+	ErrorTypeOOM        = "oom"        // 内存不足
+	ErrorTypeHandler    = "handler"    // 用户代码抛出异常、panic 或异常退出
+	ErrorTypeBadOutput  = "bad_output" // 函数返回值无法序列化，或输出中没有有效的结果
+	ErrorTypePlatform   = "platform"   // 平台内部错误
+)
+
+// maxErrorStackSize 错误堆栈和进程错误输出保留的最大长度
+const maxErrorStackSize = 8 * 1024
+
+// ExecutionError 带类型的函数执行错误
+type ExecutionError struct {
+	Type    string
+	Message string
+	Stack   string // 用户代码的异常堆栈或进程的错误输出
+}
+
+func (e *ExecutionError) Error() string {
+	return e.Message
+}
+
+// newExecutionError 创建指定类型的执行错误
+func newExecutionError(errorType, format string, args ...interface{}) *ExecutionError {
+	return &ExecutionError{Type: errorType, Message: fmt.Sprintf(format, args...)}
+}
+
+// classifyError 返回错误的类型信息，未分类的错误视为平台错误
+func classifyError(err error) *ExecutionError {
+	var typed *ExecutionError
+	if errors.As(err, &typed) {
+		return typed
+	}
+	return &ExecutionError{Type: ErrorTypePlatform, Message: err.Error()}
+}
+
+// wrapperOutput 各运行时包装代码输出的结果信封：
+// 成功时为 {"success":true,"result":...}，失败时为 {"success":false,"error":...,"error_type":...,"stack":...}
+type wrapperOutput struct {
+	Success   *bool           `json:"success"`
+	Result    json.RawMessage `json:"result"`
+	Error     string          `json:"error"`
+	ErrorType string          `json:"error_type"`
+	Stack     string          `json:"stack"`
+}
+
+// parseFunctionOutput 解析函数进程的输出并拆开结果信封，返回用户函数的返回值。
+// 包装代码把信封作为最后一行 JSON 输出，之前的内容是用户代码打印的日志；
+// 包装代码报告的失败（Node.js 输出在 stderr 中）或进程异常退出都作为带类型的错误返回
+func parseFunctionOutput(output, stderr []byte, runErr error) (interface{}, error) {
+	var typed *ExecutionError
+	if errors.As(runErr, &typed) {
+		return nil, runErr
+	}
+
+	var exitErr *exec.ExitError
+	if runErr != nil && !errors.As(runErr, &exitErr) {
+		return nil, newExecutionError(ErrorTypePlatform, "启动函数进程失败: %v", runErr)
+	}
+
+	envelope, ok := parseEnvelope(output)
+	for _, stream := range [][]byte{output, stderr} {
+		if reported, found := parseEnvelope(stream); found && !*reported.Success {
+			errorType := reported.ErrorType
+			if errorType == "" {
+				errorType = ErrorTypeHandler
+			}
+			return nil, &ExecutionError{Type: errorType, Message: reported.Error, Stack: truncateStack(reported.Stack)}
+		}
+	}
+
+	if exitErr != nil {
+		return nil, classifyExit(exitErr, stderr)
+	}
+	if !ok {
+		return nil, &ExecutionError{
+			Type:    ErrorTypeBadOutput,
+			Message: "函数输出中没有有效的结果",
+			Stack:   truncateStack(string(output)),
+		}
+	}
+
+	// 返回 undefined/None 时信封中没有 result
+	var result interface{}
+	if len(envelope.Result) > 0 {
+		if err := json.Unmarshal(envelope.Result, &result); err != nil {
+			return nil, newExecutionError(ErrorTypeBadOutput, "解析函数返回值失败: %v", err)
+		}
+	}
+	return result, nil
+}
+
+// parseEnvelope 从输出的最后一行解析结果信封
+func parseEnvelope(output []byte) (*wrapperOutput, bool) {
+	var envelope wrapperOutput
+	if json.Unmarshal(lastLine(output), &envelope) != nil || envelope.Success == nil {
+		return nil, false
+	}
+	return &envelope, true
+}
+
+// classifyExit 根据进程的退出状态和错误输出对没有报告错误的异常退出分类
+func classifyExit(exitErr *exec.ExitError, stderr []byte) *ExecutionError {
+	stack := truncateStack(string(stderr))
+
+	if exitErr.ExitCode() == sandboxInitExitCode && bytes.Contains(stderr, []byte("沙箱初始化失败")) {
+		return &ExecutionError{Type: ErrorTypePlatform, Message: strings.TrimSpace(string(stderr))}
+	}
+
+	for _, marker := range []string{"JavaScript heap out of memory", "runtime: out of memory", "MemoryError"} {
+		if bytes.Contains(stderr, []byte(marker)) {
+			return &ExecutionError{Type: ErrorTypeOOM, Message: "函数内存不足: " + marker, Stack: stack}
+		}
+	}
+
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		if status.Signal() == syscall.SIGKILL {
+			// 不是平台超时终止的 SIGKILL 通常来自内核的 OOM killer
+			return &ExecutionError{Type: ErrorTypeOOM, Message: "函数进程被 SIGKILL 终止，可能超过了内存限制", Stack: stack}
+		}
+		return &ExecutionError{Type: ErrorTypeHandler, Message: fmt.Sprintf("函数进程被信号终止: %v", status.Signal()), Stack: stack}
+	}
+
+	return &ExecutionError{Type: ErrorTypeHandler, Message: fmt.Sprintf("函数进程异常退出: %v", exitErr), Stack: stack}
+}
+
+// lastLine 返回输出中最后一个非空行
+func lastLine(output []byte) []byte {
+	output = bytes.TrimSpace(output)
+	if idx := bytes.LastIndexByte(output, '\n'); idx >= 0 {
+		return output[idx+1:]
+	}
+	return output
+}
+
+// truncateStack 截断过长的堆栈，保留末尾（最接近错误发生处）的内容
+func truncateStack(stack string) string {
+	stack = strings.TrimSpace(stack)
+	if len(stack) > maxErrorStackSize {
+		return "..." + stack[len(stack)-maxErrorStackSize:]
+	}
+	return stack
+}
+
+// buildError 将编译命令的错误转换为 build 类型的执行错误，消息中包含编译器输出
+func buildError(stderr []byte, err error) error {
+	var typed *ExecutionError
+	if errors.As(err, &typed) {
+		return err
+	}
+	if len(stderr) > 0 {
+		return &ExecutionError{Type: ErrorTypeBuild, Message: "编译失败:\n" + truncateStack(string(stderr))}
+	}
+	return newExecutionError(ErrorTypeBuild, "编译失败: %v", err)
+}
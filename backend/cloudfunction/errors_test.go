@@ -0,0 +1,227 @@
+package cloudfunction
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// exitError 运行 shell 脚本并返回其 *exec.ExitError
+func exitError(t *testing.T, script string) *exec.ExitError {
+	t.Helper()
+	err := exec.Command("sh", "-c", script).Run()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("sh -c %q: err = %v, want *exec.ExitError", script, err)
+	}
+	return exitErr
+}
+
+func TestClassifyExit(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		stderr string
+		want   string
+	}{
+		{"非零退出码", "exit 3", "boom", ErrorTypeHandler},
+		{"Node.js内存不足", "exit 134", "FATAL ERROR: JavaScript heap out of memory", ErrorTypeOOM},
+		{"Go内存不足", "exit 2", "fatal error: runtime: out of memory", ErrorTypeOOM},
+		{"Python内存不足", "exit 1", "MemoryError", ErrorTypeOOM},
+		{"SIGKILL", "kill -9 $$", "", ErrorTypeOOM},
+		{"其他信号", "kill -15 $$", "", ErrorTypeHandler},
+		{"沙箱初始化失败", fmt.Sprintf("exit %d", sandboxInitExitCode), "沙箱初始化失败: seccomp", ErrorTypePlatform},
+		{"退出码125但不是沙箱错误", fmt.Sprintf("exit %d", sandboxInitExitCode), "other", ErrorTypeHandler},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := classifyExit(exitError(t, tt.script), []byte(tt.stderr))
+			if got.Type != tt.want {
+				t.Fatalf("Type = %q (%s), want %q", got.Type, got.Message, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	typed := newExecutionError(ErrorTypeTimeout, "函数执行超时")
+	if got := classifyError(fmt.Errorf("执行失败: %w", typed)); got != typed {
+		t.Fatalf("包装后的带类型错误应保留原类型, got %+v", got)
+	}
+	if got := classifyError(errors.New("disk full")); got.Type != ErrorTypePlatform || got.Message != "disk full" {
+		t.Fatalf("未分类的错误应视为平台错误, got %+v", got)
+	}
+}
+
+func TestBuildError(t *testing.T) {
+	got := classifyError(buildError([]byte("./main.go:3:1: syntax error"), errors.New("exit status 1")))
+	if got.Type != ErrorTypeBuild || !strings.Contains(got.Message, "syntax error") {
+		t.Fatalf("buildError = %+v", got)
+	}
+	timeout := newExecutionError(ErrorTypeTimeout, "编译超时")
+	if err := buildError([]byte("partial"), timeout); err != timeout {
+		t.Fatalf("buildError 应保留带类型的错误, got %v", err)
+	}
+}
+
+func TestTruncateStack(t *testing.T) {
+	short := "  Error: boom\n    at handler  "
+	if got := truncateStack(short); got != strings.TrimSpace(short) {
+		t.Fatalf("truncateStack = %q", got)
+	}
+	long := strings.Repeat("a", maxErrorStackSize) + "TAIL"
+	got := truncateStack(long)
+	if !strings.HasPrefix(got, "...") || !strings.HasSuffix(got, "TAIL") || len(got) != maxErrorStackSize+3 {
+		t.Fatalf("truncateStack 应保留末尾 %d 字节, got len %d", maxErrorStackSize, len(got))
+	}
+}
+
+func TestExecuteFunctionReportsErrorType(t *testing.T) {
+	requireTool(t, "node")
+	p := newTestPlatform(t)
+	fn := newNodeFunction("thrower", "function handler() { throw new Error('boom'); }")
+	if err := p.CreateFunction(fn); err != nil {
+		t.Fatal(err)
+	}
+
+	GlobalMetrics.mu.RLock()
+	before := GlobalMetrics.ErrorsByType[ErrorTypeHandler]
+	GlobalMetrics.mu.RUnlock()
+
+	waitForBuilds(t, p)
+	resp, err := p.ExecuteFunction(fn.ID, &ExecuteRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Success || resp.ErrorType != ErrorTypeHandler || !strings.Contains(resp.Error, "boom") {
+		t.Fatalf("resp = %+v, want handler 错误", resp)
+	}
+
+	GlobalMetrics.mu.RLock()
+	after := GlobalMetrics.ErrorsByType[ErrorTypeHandler]
+	GlobalMetrics.mu.RUnlock()
+	if after != before+1 {
+		t.Fatalf("ErrorsByType[handler] = %d, want %d", after, before+1)
+	}
+}
+
+func TestParseFunctionOutput(t *testing.T) {
+	tests := []struct {
+		name     string
+		stdout   string
+		stderr   string
+		script   string // 不为空时模拟进程以该脚本的退出状态结束
+		want     string // 期望的返回值 JSON
+		wantType string
+	}{
+		{
+			name:   "只有信封",
+			stdout: `{"success":true,"result":{"a":1}}`,
+			want:   `{"a":1}`,
+		},
+		{
+			name:   "信封前有日志",
+			stdout: "hello\n{\"success\":false}\n{\"not\":\"envelope\"}\n" + `{"success":true,"result":[1,2]}` + "\n",
+			want:   `[1,2]`,
+		},
+		{
+			name:   "返回undefined",
+			stdout: "log line\n" + `{"success":true}`,
+			want:   `null`,
+		},
+		{
+			name:     "信封报告失败",
+			stdout:   "log\n" + `{"success":false,"error":"boom","stack":"at handler"}`,
+			wantType: ErrorTypeHandler,
+		},
+		{
+			name:     "失败信封带错误类型",
+			stdout:   `{"success":false,"error":"cannot serialize","error_type":"bad_output"}`,
+			wantType: ErrorTypeBadOutput,
+		},
+		{
+			name:     "stderr中的失败信封",
+			stdout:   "partial output",
+			stderr:   "warning\n" + `{"success":false,"error":"boom"}`,
+			script:   "exit 1",
+			wantType: ErrorTypeHandler,
+		},
+		{
+			name:     "最后一行是日志",
+			stdout:   `{"success":true,"result":1}` + "\nprinted after",
+			wantType: ErrorTypeBadOutput,
+		},
+		{
+			name:     "没有输出",
+			stdout:   "",
+			wantType: ErrorTypeBadOutput,
+		},
+		{
+			name:     "异常退出且没有信封",
+			stdout:   "log",
+			stderr:   "MemoryError",
+			script:   "exit 1",
+			wantType: ErrorTypeOOM,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var runErr error
+			if tt.script != "" {
+				runErr = exitError(t, tt.script)
+			}
+			result, err := parseFunctionOutput([]byte(tt.stdout), []byte(tt.stderr), runErr)
+			if tt.wantType != "" {
+				if err == nil {
+					t.Fatalf("应返回错误, got result %v", result)
+				}
+				if got := classifyError(err).Type; got != tt.wantType {
+					t.Fatalf("Type = %q (%v), want %q", got, err, tt.wantType)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got, _ := json.Marshal(result); string(got) != tt.want {
+				t.Fatalf("result = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFunctionOutputPassesTypedErrors(t *testing.T) {
+	timeout := newExecutionError(ErrorTypeTimeout, "函数执行超时")
+	if _, err := parseFunctionOutput([]byte(`{"success":true}`), nil, timeout); err != timeout {
+		t.Fatalf("err = %v, want 原样返回超时错误", err)
+	}
+	_, err := parseFunctionOutput(nil, nil, errors.New("exec: not found"))
+	if got := classifyError(err).Type; got != ErrorTypePlatform {
+		t.Fatalf("启动失败的 Type = %q, want %q", got, ErrorTypePlatform)
+	}
+}
+
+func TestExecuteFunctionReturnsHandlerValue(t *testing.T) {
+	requireTool(t, "node")
+	p := newTestPlatform(t)
+	fn := newNodeFunction("plain", `function handler(event) {
+  console.log('{"success":false,"error":"user log"}');
+  return {sum: event.a + event.b};
+}`)
+	if err := p.CreateFunction(fn); err != nil {
+		t.Fatal(err)
+	}
+
+	waitForBuilds(t, p)
+	resp, err := p.ExecuteFunction(fn.ID, &ExecuteRequest{Event: map[string]interface{}{"a": 1, "b": 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 用户打印的类似信封的日志不影响结果，返回值不再包装
+	if got, _ := json.Marshal(resp.Result); !resp.Success || string(got) != `{"sum":3}` {
+		t.Fatalf("resp = %+v, result = %s", resp, got)
+	}
+}
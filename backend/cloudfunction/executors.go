@@ -1,345 +1,588 @@
 package cloudfunction
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
-	"syscall"
 	"time"
 )
 
-// executeGoFunction 执行Go函数
-func (p *Platform) executeGoFunction(fn *Function, req *ExecuteRequest) (interface{}, error) {
-	fnDir := filepath.Join(p.workDir, fn.ID)
+// prepareCode 准备函数进程的工作目录并返回：代码包函数解压代码包并安装依赖，
+// 引用了层的函数解压层并在工作目录的 layers 下创建链接。ctx 带有调用的超时时间，
+// 准备过程计入函数的执行时间，超时返回 timeout 错误
+func (p *Platform) prepareCode(ctx context.Context, fn *Function, inv *invocation) (string, error) {
+	dir := p.functionDir(fn)
+	if fn.Package != nil {
+		var err error
+		if dir, err = p.preparePackage(ctx, fn); err != nil {
+			return "", prepareError(ctx, fn, newExecutionError(ErrorTypePlatform, "%v", err))
+		}
+		inv.packageDir = dir
+		if inv.deps, err = p.prepareDependencies(ctx, fn, dir); err != nil {
+			return "", prepareError(ctx, fn, err)
+		}
+	}
 
-	// 分析用户代码，检查是否已包含package和import
-	userCode := fn.Code
-	hasPackage := false
-	hasImports := false
+	layers, err := p.prepareLayers(fn, dir)
+	if err != nil {
+		return "", err
+	}
+	inv.layers = layers
+	return dir, nil
+}
 
-	// 检查是否已有package声明
-	if strings.Contains(userCode, "package ") {
-		hasPackage = true
+// prepareError 调用超时导致的准备失败返回与执行超时相同的错误
+func prepareError(ctx context.Context, fn *Function, err error) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return &ExecutionError{Type: ErrorTypeTimeout, Message: fmt.Sprintf("执行超时（%v）", time.Duration(fn.Timeout)*time.Second)}
 	}
+	return err
+}
 
-	// 检查是否已有import声明
-	if strings.Contains(userCode, "import ") {
-		hasImports = true
+// executeGoFunction 执行Go函数
+func (p *Platform) executeGoFunction(fn *Function, inv *invocation) (interface{}, error) {
+	timeout := time.Duration(fn.Timeout) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// 可执行文件由部署时的构建生成，这里只准备依赖和层
+	if _, err := p.prepareCode(ctx, fn, inv); err != nil {
+		return nil, err
 	}
 
-	// 调试输出
-	fmt.Printf("用户代码包含package: %v, 包含import: %v\n", hasPackage, hasImports)
-	fmt.Printf("用户代码内容: %s\n", userCode)
+	// 执行：环境变量不继承宿主进程，只包含平台提供的最小环境
+	runCmd, err := p.newCommand(ctx, fn, inv, p.buildArtifact(fn, inv.build.ID))
+	if err != nil {
+		return nil, newExecutionError(ErrorTypePlatform, "创建执行命令失败: %v", err)
+	}
+	// 解析结果
+	return parseFunctionOutput(runCommand(ctx, runCmd, timeout))
+}
 
-	// 生成完整的Go程序
-	mainCode := fmt.Sprintf(`
+// goWrapperSource 生成读取输入、调用入口函数并输出结果的 main 程序；
+// imports 为额外的导入项，userCode 为内嵌的用户代码，call 为入口函数表达式。
+// 入口程序使用的包和声明以 fc 为前缀，不与用户代码的导入和声明冲突
+func goWrapperSource(imports, userCode, call string) string {
+	return fmt.Sprintf(`
 package main
 
 import (
-	"context"
-	"encoding/json"
-	"fmt"
-	"os"
-)
+	fccontext "context"
+	fcjson "encoding/json"
+	fcfmt "fmt"
+	fcos "os"
+	fcsignal "os/signal"
+	fcreflect "reflect"
+	fcdebug "runtime/debug"
+	fcsyscall "syscall"
+	fctime "time"
+%s)
 
 %s
 
+// fcFail 输出失败结果并退出
+func fcFail(errorType, message, stack string) {
+	failure := map[string]interface{}{
+		"success": false,
+		"error": message,
+		"error_type": errorType,
+	}
+	if stack != "" {
+		failure["stack"] = stack
+	}
+	output, _ := fcjson.Marshal(failure)
+	fcfmt.Println(string(output))
+	fcos.Exit(1)
+}
+
+// fcInvoke 按入口函数的签名传参并调用：可选的 context.Context、解码为参数类型的事件、
+// map[string]string 调用上下文；返回值中最后一个 error 作为调用失败
+func fcInvoke(handler interface{}, ctx fccontext.Context, event []byte, contextMap map[string]string) (interface{}, error) {
+	fn := fcreflect.ValueOf(handler)
+	fnType := fn.Type()
+	contextType := fcreflect.TypeOf((*fccontext.Context)(nil)).Elem()
+	errorType := fcreflect.TypeOf((*error)(nil)).Elem()
+
+	var args []fcreflect.Value
+	params := fnType.NumIn()
+	if params > 0 && fnType.In(0) == contextType {
+		args = append(args, fcreflect.ValueOf(&ctx).Elem())
+	}
+	if len(args) < params {
+		eventValue := fcreflect.New(fnType.In(len(args)))
+		if len(event) > 0 {
+			if err := fcjson.Unmarshal(event, eventValue.Interface()); err != nil {
+				fcFail("validation", fcfmt.Sprintf("事件无法解析为 %%s: %%v", fnType.In(len(args)), err), "")
+			}
+		}
+		args = append(args, eventValue.Elem())
+	}
+	if len(args) < params {
+		args = append(args, fcreflect.ValueOf(contextMap))
+	}
+
+	results := fn.Call(args)
+	if n := len(results); n > 0 && fnType.Out(n-1) == errorType {
+		if !results[n-1].IsNil() {
+			return nil, results[n-1].Interface().(error)
+		}
+		results = results[:n-1]
+	}
+	if len(results) == 0 {
+		return nil, nil
+	}
+	return results[0].Interface(), nil
+}
+
 func main() {
+	handler := %s
+
 	// 从环境变量读取输入
-	eventStr := os.Getenv("FUNCTION_EVENT")
-	contextStr := os.Getenv("FUNCTION_CONTEXT")
-	
-	var eventData interface{}
 	var contextMap map[string]string
-	ctx := context.Background()
-	
-	if eventStr != "" {
-		json.Unmarshal([]byte(eventStr), &eventData)
+	if contextStr := fcos.Getenv("FUNCTION_CONTEXT"); contextStr != "" {
+		fcjson.Unmarshal([]byte(contextStr), &contextMap)
 	}
-	if contextStr != "" {
-		json.Unmarshal([]byte(contextStr), &contextMap)
+
+	// 入口函数的 context 在调用截止时间到达或平台超时终止进程(SIGTERM)时取消
+	ctx, stop := fcsignal.NotifyContext(fccontext.Background(), fcsyscall.SIGTERM)
+	defer stop()
+	var invocation map[string]interface{}
+	fcjson.Unmarshal([]byte(fcos.Getenv("FC_INVOCATION_CONTEXT")), &invocation)
+	if deadline, ok := invocation["deadline_ms"].(float64); ok && deadline > 0 {
+		var cancel fccontext.CancelFunc
+		ctx, cancel = fccontext.WithDeadline(ctx, fctime.UnixMilli(int64(deadline)))
+		defer cancel()
 	}
-	
-	// 调用用户函数
+
+	// 调用用户函数，panic 作为 handler 错误报告
 	defer func() {
 		if r := recover(); r != nil {
-			errorResult := map[string]interface{}{
-				"success": false,
-				"error": fmt.Sprintf("函数执行出错: %%v", r),
-			}
-			resultBytes, _ := json.Marshal(errorResult)
-			fmt.Print(string(resultBytes))
+			fcFail("handler", fcfmt.Sprintf("函数执行出错: %%v", r), string(fcdebug.Stack()))
 		}
 	}()
-	
-	// 直接调用用户的Handler函数
-	result := %s(ctx, eventData)
-	
-	// 包装结果
-	finalResult := map[string]interface{}{
+	result, err := fcInvoke(handler, ctx, []byte(fcos.Getenv("FUNCTION_EVENT")), contextMap)
+	if err != nil {
+		fcFail("handler", err.Error(), "")
+	}
+
+	// 输出结果，返回值无法序列化时报告 bad_output
+	output, err := fcjson.Marshal(map[string]interface{}{
 		"success": true,
 		"result": result,
+	})
+	if err != nil {
+		fcFail("bad_output", fcfmt.Sprintf("返回值无法序列化为JSON: %%v", err), "")
 	}
-	
-	// 输出结果
-	resultBytes, _ := json.Marshal(finalResult)
-	fmt.Print(string(resultBytes))
+	fcfmt.Println(string(output))
+}
+`, imports, userCode, call)
 }
-`, userCode, fn.Handler)
-
-	mainPath := filepath.Join(fnDir, "main.go")
-	if err := os.WriteFile(mainPath, []byte(mainCode), 0644); err != nil {
-		return nil, fmt.Errorf("写入main.go失败: %v", err)
-	}
 
-	// 准备环境变量
-	env := os.Environ()
-	if req.Event != nil {
-		eventBytes, _ := json.Marshal(req.Event)
-		env = append(env, "FUNCTION_EVENT="+string(eventBytes))
-	}
-	if req.Context != nil {
-		contextBytes, _ := json.Marshal(req.Context)
-		env = append(env, "FUNCTION_CONTEXT="+string(contextBytes))
+// nodeModuleFile 返回内联Node.js代码的模块文件名：使用 import/export 语法的代码作为 ES 模块(.mjs)
+func nodeModuleFile(code string) string {
+	if nodeESMPattern.MatchString(code) {
+		return "handler.mjs"
 	}
+	return "handler.js"
+}
 
-	// 设置函数的环境变量
-	for k, v := range fn.Environment {
-		env = append(env, k+"="+v)
+// nodeModuleSource 生成内联Node.js代码的模块内容：CommonJS 代码中以顶层函数声明、
+// 没有导出的入口函数会被补充到 module.exports，兼容旧的写法
+func nodeModuleSource(code, handler string) string {
+	if nodeModuleFile(code) == "handler.mjs" {
+		return code
 	}
+	return fmt.Sprintf("%s\n;if (typeof %[2]s !== 'undefined' && module.exports.%[2]s === undefined) module.exports.%[2]s = %[2]s;\n", code, handler)
+}
 
-	// 编译并执行
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(fn.Timeout)*time.Second)
+// executeNodeJSFunction 执行Node.js函数
+func (p *Platform) executeNodeJSFunction(fn *Function, inv *invocation) (interface{}, error) {
+	fnDir := p.functionDir(fn)
+	timeout := time.Duration(fn.Timeout) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
-	// 编译
-	buildCmd := exec.CommandContext(ctx, "go", "build", "-o", "function", "main.go")
-	buildCmd.Dir = fnDir
-	buildCmd.Env = env
-	if err := buildCmd.Run(); err != nil {
-		return nil, fmt.Errorf("编译失败: %v", err)
-	}
-
-	// 执行
-	runCmd := exec.CommandContext(ctx, "./function")
-	runCmd.Dir = fnDir
-	runCmd.Env = env
-	output, err := runCmd.Output()
+	dir, err := p.prepareCode(ctx, fn, inv)
 	if err != nil {
-		return nil, fmt.Errorf("执行失败: %v", err)
+		return nil, err
 	}
 
-	// 解析结果
-	var result interface{}
-	if err := json.Unmarshal(output, &result); err != nil {
-		return string(output), nil // 如果不是JSON，返回原始字符串
+	// 用户代码作为独立的模块加载：内联代码写入函数目录，代码包函数按 require 规则查找入口文件
+	var entry, export string
+	if fn.Package != nil {
+		var file string
+		file, export = splitHandler(fn.Handler)
+		if entry = findNodeEntry(dir, file); entry == "" {
+			return nil, newExecutionError(ErrorTypeValidation, "代码包中找不到入口文件: %s", file)
+		}
+		entry = filepath.Join(dir, filepath.FromSlash(entry))
+	} else {
+		export = fn.Handler
+		entry = filepath.Join(fnDir, nodeModuleFile(fn.Code))
+		if err := writeFileAtomic(entry, []byte(nodeModuleSource(fn.Code, fn.Handler))); err != nil {
+			return nil, fmt.Errorf("写入%s失败: %v", filepath.Base(entry), err)
+		}
 	}
 
-	return result, nil
-}
-
-// executeNodeJSFunction 执行Node.js函数
-func (p *Platform) executeNodeJSFunction(fn *Function, req *ExecuteRequest) (interface{}, error) {
-	fnDir := filepath.Join(p.workDir, fn.ID)
-
 	// 创建Node.js执行文件
 	nodeCode := fmt.Sprintf(`
-%s
+const { pathToFileURL } = require('url');
+
+// 输出失败结果并退出
+function fail(errorType, error) {
+    const isError = error instanceof Error;
+    console.error(JSON.stringify({
+        success: false,
+        error: isError ? error.name + ": " + error.message : String(error),
+        error_type: errorType,
+        stack: isError ? error.stack : undefined
+    }));
+    process.exit(1);
+}
+
+// 入口函数之外抛出的异常和未处理的 Promise 拒绝同样作为调用失败
+process.on('uncaughtException', (error) => fail('handler', error));
+process.on('unhandledRejection', (reason) => fail('handler', reason));
 
 // 从环境变量读取输入
 const eventStr = process.env.FUNCTION_EVENT || '{}';
 const contextStr = process.env.FUNCTION_CONTEXT || '{}';
 
-let event, context;
+let event, clientContext, invocation;
 
 try {
     event = JSON.parse(eventStr);
-    context = JSON.parse(contextStr);
+    clientContext = JSON.parse(contextStr);
+    invocation = JSON.parse(process.env.FC_INVOCATION_CONTEXT || '{}');
 } catch (e) {
-    console.error(JSON.stringify({error: "解析输入数据失败: " + e.message}));
-    process.exit(1);
+    fail('platform', "解析输入数据失败: " + e.message);
+}
+
+// 调用上下文：调用请求中的 context 字段保留在顶层，另外提供平台的调用信息
+const context = Object.assign({}, clientContext, {
+    requestId: invocation.request_id,
+    functionId: invocation.function_id,
+    functionName: invocation.function_name,
+    functionVersion: invocation.function_version,
+    namespace: invocation.namespace,
+    memoryLimitInMB: invocation.memory_limit_mb,
+    deadlineMs: invocation.deadline_ms,
+    clientContext: clientContext,
+    getRemainingTimeMs() {
+        return Math.max(0, invocation.deadline_ms - Date.now());
+    }
+});
+
+// 加载入口模块：.mjs 和 "type": "module" 包中的 .js 作为 ES 模块导入，其余按 CommonJS 加载
+async function loadModule(file) {
+    if (file.endsWith('.mjs')) {
+        return import(pathToFileURL(file).href);
+    }
+    try {
+        return require(file);
+    } catch (error) {
+        if (error.code === 'ERR_REQUIRE_ESM' || error.code === 'ERR_REQUIRE_ASYNC_MODULE') {
+            return import(pathToFileURL(file).href);
+        }
+        throw error;
+    }
+}
+
+// 调用入口函数：返回 Promise 的函数等待其完成，
+// (event, context, callback) 形式的函数等待 callback(error, result) 被调用
+function invoke(handler) {
+    return new Promise((resolve, reject) => {
+        const callback = (error, result) => error ? reject(error) : resolve(result);
+        const returned = handler(event, context, callback);
+        if (handler.length < 3 || (returned && typeof returned.then === 'function')) {
+            Promise.resolve(returned).then(resolve, reject);
+        }
+    });
 }
 
-// 执行用户函数
 async function execute() {
+    let result;
     try {
-        const userFunction = %s;
-        
-        let result;
-        
-        // 尝试不同的函数调用方式
-        if (typeof userFunction === 'function') {
-            if (userFunction.constructor.name === 'AsyncFunction') {
-                result = await userFunction(event, context);
-            } else {
-                result = userFunction(event, context);
-            }
-        } else {
-            throw new Error('Handler不是一个有效的函数');
+        const mod = await loadModule(%s);
+        let handler = mod[%[2]s];
+        if (handler === undefined && mod.default) {
+            handler = mod.default[%[2]s];
         }
-        
-        console.log(JSON.stringify({
+        if (typeof handler !== 'function') {
+            throw new Error('入口模块没有导出函数 ' + %[2]s);
+        }
+        result = await invoke(handler);
+    } catch (error) {
+        fail('handler', error);
+    }
+
+    let output;
+    try {
+        output = JSON.stringify({
             success: true,
             result: result
-        }));
+        });
     } catch (error) {
-        console.error(JSON.stringify({
-            success: false,
-            error: error.message,
-            stack: error.stack
-        }));
-        process.exit(1);
+        fail('bad_output', "返回值无法序列化为JSON: " + error.message);
     }
+    console.log(output);
+    // 不等待入口函数遗留的定时器和连接
+    process.exit(0);
 }
 
 execute();
-`, fn.Code, fn.Handler)
+`, jsonString(entry), jsonString(export))
 
-	indexPath := filepath.Join(fnDir, "index.js")
-	if err := os.WriteFile(indexPath, []byte(nodeCode), 0644); err != nil {
+	indexPath, err := writeWrapper(fnDir, "index.js", nodeCode)
+	if err != nil {
 		return nil, fmt.Errorf("写入index.js失败: %v", err)
 	}
 
-	// 准备环境变量
-	env := os.Environ()
-	if req.Event != nil {
-		eventBytes, _ := json.Marshal(req.Event)
-		env = append(env, "FUNCTION_EVENT="+string(eventBytes))
-	}
-	if req.Context != nil {
-		contextBytes, _ := json.Marshal(req.Context)
-		env = append(env, "FUNCTION_CONTEXT="+string(contextBytes))
-	}
-
-	// 设置函数的环境变量
-	for k, v := range fn.Environment {
-		env = append(env, k+"="+v)
+	// 执行Node.js：环境变量不继承宿主进程，只包含平台提供的最小环境
+	cmd, err := p.newCommand(ctx, fn, inv, runtimeBinary("node"), indexPath)
+	if err != nil {
+		return nil, newExecutionError(ErrorTypePlatform, "创建执行命令失败: %v", err)
 	}
+	// 解析结果
+	return parseFunctionOutput(runCommand(ctx, cmd, timeout))
+}
 
-	// 执行Node.js
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(fn.Timeout)*time.Second)
+// executePythonFunction 执行Python函数：入口模块由入口程序导入，入口为模块中的属性路径；
+// 可以使用常驻实例时，模块级代码只在实例第一次处理调用时执行
+func (p *Platform) executePythonFunction(fn *Function, inv *invocation) (interface{}, error) {
+	fnDir := p.functionDir(fn)
+	timeout := time.Duration(fn.Timeout) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, "node", "index.js")
-	cmd.Dir = fnDir
-	cmd.Env = env
-	output, err := cmd.Output()
+	dir, err := p.prepareCode(ctx, fn, inv)
 	if err != nil {
-		return nil, fmt.Errorf("执行失败: %v", err)
+		return nil, err
 	}
 
-	// 解析结果
-	var result interface{}
-	if err := json.Unmarshal(output, &result); err != nil {
-		return string(output), nil
+	// 内联代码写入 handler.py 作为入口模块，代码包函数从解压目录导入入口模块
+	module, attrs := "handler", fn.Handler
+	if fn.Package != nil {
+		if module, attrs = findPythonHandler(dir, fn.Handler); module == "" {
+			return nil, newExecutionError(ErrorTypeValidation, "代码包中找不到入口模块: %s", fn.Handler)
+		}
+	} else if err := writeFileAtomic(filepath.Join(fnDir, "handler.py"), []byte(fn.Code)); err != nil {
+		return nil, fmt.Errorf("写入handler.py失败: %v", err)
 	}
 
-	return result, nil
-}
-
-// executePythonFunction 执行Python函数
-func (p *Platform) executePythonFunction(fn *Function, req *ExecuteRequest) (interface{}, error) {
-	fnDir := filepath.Join(p.workDir, fn.ID)
-
 	// 创建Python执行文件
 	pythonCode := fmt.Sprintf(`
+import asyncio
+import importlib
+import inspect
 import json
 import os
 import sys
+import time
 import traceback
 
-%s
+MODULE = %s
+HANDLER = %s
+CODE_DIR = %s
+
+
+class _FCInvocationContext(dict):
+    """调用上下文：字典内容为调用请求中的 context，平台的调用信息为属性"""
+
+    def __init__(self, client_context, invocation):
+        super().__init__(client_context)
+        self.client_context = dict(client_context)
+        self.request_id = invocation.get("request_id")
+        self.function_id = invocation.get("function_id")
+        self.function_name = invocation.get("function_name")
+        self.function_version = invocation.get("function_version")
+        self.namespace = invocation.get("namespace")
+        self.memory_limit_in_mb = invocation.get("memory_limit_mb")
+        self.deadline_ms = invocation.get("deadline_ms", 0)
+
+    def get_remaining_time_ms(self):
+        return max(0, int(self.deadline_ms - time.time() * 1000))
+
+    getRemainingTimeMs = get_remaining_time_ms
+
+
+_handler = None
+_loop = None
+
+
+def load_handler():
+    """导入入口模块并按属性路径取得入口函数；导入成功后缓存，模块级代码在进程中只执行一次"""
+    global _handler
+    if _handler is None:
+        if CODE_DIR not in sys.path:
+            sys.path.insert(0, CODE_DIR)
+        target = importlib.import_module(MODULE)
+        for name in HANDLER.split("."):
+            target = getattr(target, name, None)
+            if target is None:
+                raise AttributeError(f"找不到入口函数: {MODULE}.{HANDLER}")
+        if not callable(target):
+            raise TypeError(f"入口不是可调用对象: {MODULE}.{HANDLER}")
+        _handler = target
+    return _handler
+
+
+def call_handler(event, context):
+    """调用入口函数，协程在进程内复用的事件循环中执行到完成"""
+    global _loop
+    result = load_handler()(event, context)
+    if inspect.isawaitable(result):
+        if _loop is None:
+            _loop = asyncio.new_event_loop()
+            asyncio.set_event_loop(_loop)
+        result = _loop.run_until_complete(result)
+    return result
+
+
+def handle(event, client_context, invocation):
+    """执行一次调用，返回JSON格式的结果信封和是否成功"""
+    try:
+        result = call_handler(event, _FCInvocationContext(client_context or {}, invocation))
+    except MemoryError:
+        envelope = {
+            "success": False,
+            "error": "函数内存不足: MemoryError",
+            "error_type": "oom",
+            "stack": traceback.format_exc()
+        }
+    except Exception as e:
+        envelope = {
+            "success": False,
+            "error": f"{type(e).__name__}: {e}",
+            "error_type": "handler",
+            "stack": traceback.format_exc()
+        }
+    else:
+        envelope = {"success": True, "result": result}
+
+    try:
+        return json.dumps(envelope), envelope["success"]
+    except (TypeError, ValueError) as e:
+        return json.dumps({
+            "success": False,
+            "error": f"返回值无法序列化为JSON: {e}",
+            "error_type": "bad_output"
+        }), False
+
+
+def serve():
+    """常驻实例：从标准输入逐行读取调用请求，每个结果信封占标准输出的一行；
+    用户代码的输出重定向到标准错误，不会混入结果"""
+    protocol = os.fdopen(os.dup(1), "w")
+    os.dup2(2, 1)
+    sys.stdout = sys.stderr
+    for line in sys.stdin:
+        if not line.strip():
+            continue
+        request = json.loads(line)
+        invocation = request.get("invocation") or {}
+        os.environ["FC_REQUEST_ID"] = invocation.get("request_id") or ""
+        os.environ["FC_INVOCATION_CONTEXT"] = json.dumps(invocation)
+        output, _ = handle(request.get("event", {}), request.get("context"), invocation)
+        sys.stderr.flush()
+        protocol.write(output + "\n")
+        protocol.flush()
+
 
 def main():
+    # 从环境变量读取输入
     try:
-        # 从环境变量读取输入
-        event_str = os.environ.get('FUNCTION_EVENT', '{}')
-        context_str = os.environ.get('FUNCTION_CONTEXT', '{}')
-        
-        try:
-            event = json.loads(event_str)
-            context = json.loads(context_str)
-        except json.JSONDecodeError as e:
-            print(json.dumps({
-                "success": False,
-                "error": f"解析输入数据失败: {str(e)}"
-            }))
-            sys.exit(1)
-        
-        # 获取用户函数
-        handler_func = globals().get('%s')
-        if not handler_func:
-            raise Exception(f"找不到Handler函数: %s")
-        
-        if not callable(handler_func):
-            raise Exception(f"Handler不是一个可调用的函数: %s")
-        
-        # 执行用户函数
-        result = handler_func(event, context)
-        
-        print(json.dumps({
-            "success": True,
-            "result": result
-        }))
-        
-    except Exception as e:
+        event = json.loads(os.environ.get("FUNCTION_EVENT", "{}"))
+        client_context = json.loads(os.environ.get("FUNCTION_CONTEXT", "{}"))
+        invocation = json.loads(os.environ.get("FC_INVOCATION_CONTEXT", "{}"))
+    except json.JSONDecodeError as e:
         print(json.dumps({
             "success": False,
-            "error": str(e),
-            "traceback": traceback.format_exc()
+            "error": f"解析输入数据失败: {str(e)}",
+            "error_type": "platform"
         }))
         sys.exit(1)
 
+    output, ok = handle(event, client_context, invocation)
+    print(output)
+    if not ok:
+        sys.exit(1)
+
 if __name__ == "__main__":
-    main()
-`, fn.Code, fn.Handler, fn.Handler, fn.Handler)
+    if os.environ.get("FC_WORKER") == "1":
+        serve()
+    else:
+        main()
+`, jsonString(module), jsonString(attrs), jsonString(dir))
 
-	mainPath := filepath.Join(fnDir, "main.py")
-	if err := os.WriteFile(mainPath, []byte(pythonCode), 0644); err != nil {
+	mainPath, err := writeWrapper(fnDir, "main.py", pythonCode)
+	if err != nil {
 		return nil, fmt.Errorf("写入main.py失败: %v", err)
 	}
 
-	// 准备环境变量
-	env := os.Environ()
-	if req.Event != nil {
-		eventBytes, _ := json.Marshal(req.Event)
-		env = append(env, "FUNCTION_EVENT="+string(eventBytes))
+	// 执行Python：环境变量不继承宿主进程，只包含平台提供的最小环境
+	// 安装了依赖的代码包函数使用虚拟环境中的解释器
+	python := runtimeBinary("python3")
+	if inv.deps != nil && inv.deps.Python != "" {
+		python = inv.deps.Python
 	}
-	if req.Context != nil {
-		contextBytes, _ := json.Marshal(req.Context)
-		env = append(env, "FUNCTION_CONTEXT="+string(contextBytes))
+	if p.warmEnabled(fn) {
+		return p.invokeWarm(ctx, fn, inv, timeout, python, mainPath)
 	}
 
-	// 设置函数的环境变量
-	for k, v := range fn.Environment {
-		env = append(env, k+"="+v)
+	cmd, err := p.newCommand(ctx, fn, inv, python, mainPath)
+	if err != nil {
+		return nil, newExecutionError(ErrorTypePlatform, "创建执行命令失败: %v", err)
 	}
 
-	// 执行Python
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(fn.Timeout)*time.Second)
-	defer cancel()
-
-	cmd := exec.CommandContext(ctx, "python3", "main.py")
-	cmd.Dir = fnDir
-	cmd.Env = env
+	// 解析结果
+	return parseFunctionOutput(runCommand(ctx, cmd, timeout))
+}
 
-	// 设置进程组，便于杀死子进程
-	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+// jsonString 将字符串编码为JSON字符串字面量，同时也是合法的 JavaScript 和 Python 字符串字面量
+func jsonString(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
 
-	output, err := cmd.Output()
-	if err != nil {
-		return nil, fmt.Errorf("执行失败: %v", err)
+// writeWrapper 将入口程序写入 dir 中以内容哈希命名的文件并返回路径。
+// 入口程序只随入口变化，内容不变时不再写入，也不会覆盖正在执行的调用使用的文件
+func writeWrapper(dir, name, source string) (string, error) {
+	sum := sha256.Sum256([]byte(source))
+	ext := filepath.Ext(name)
+	path := filepath.Join(dir, fmt.Sprintf(".fc-%s-%s%s", strings.TrimSuffix(name, ext), hex.EncodeToString(sum[:8]), ext))
+	if fileExists(path) {
+		return path, nil
 	}
+	return path, writeFileAtomic(path, []byte(source))
+}
 
-	// 解析结果
-	var result interface{}
-	if err := json.Unmarshal(output, &result); err != nil {
-		return string(output), nil
+// writeFileAtomic 内容变化时先写入临时文件再重命名为 path，并发的调用不会读到写了一半的文件
+func writeFileAtomic(path string, data []byte) error {
+	if current, err := os.ReadFile(path); err == nil && bytes.Equal(current, data) {
+		return nil
 	}
 
-	return result, nil
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
 }
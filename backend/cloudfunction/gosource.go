@@ -0,0 +1,340 @@
+package cloudfunction
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// goSourceFile 诊断信息和 //line 指令中用户代码的文件名
+const goSourceFile = "handler.go"
+
+// goPackagePrefix 用户代码没有 package 声明时解析前补上的包声明，
+// //line 指令使后续位置仍对应用户代码的第一行
+const goPackagePrefix = "package main\n//line " + goSourceFile + ":1:1\n"
+
+// goImplicitImports 旧版入口程序为用户代码隐式提供的包；
+// 用户代码引用了这些包但没有导入时自动补上导入
+var goImplicitImports = map[string]string{
+	"context": "context",
+	"json":    "encoding/json",
+	"fmt":     "fmt",
+	"os":      "os",
+}
+
+// goSource 解析后的内联Go代码
+type goSource struct {
+	fset *token.FileSet
+	file *ast.File
+	src  string
+	// prefixed 用户代码没有 package 声明，src 以 goPackagePrefix 开头
+	prefixed bool
+}
+
+// parseGoSource 解析内联Go代码，package 声明可省略；
+// 语法错误返回带诊断信息的 *ValidationError
+func parseGoSource(code string) (*goSource, error) {
+	src, prefixed := code, false
+	if _, err := parser.ParseFile(token.NewFileSet(), goSourceFile, code, parser.PackageClauseOnly); err != nil {
+		src, prefixed = goPackagePrefix+code, true
+	}
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, goSourceFile, src, parser.ParseComments)
+	if err != nil {
+		list, ok := err.(scanner.ErrorList)
+		if !ok {
+			return nil, newValidationError("解析Go代码失败: %v", err)
+		}
+		var diagnostics []Diagnostic
+		for _, e := range list {
+			diagnostics = append(diagnostics, Diagnostic{
+				File:     e.Pos.Filename,
+				Line:     e.Pos.Line,
+				Column:   e.Pos.Column,
+				Severity: SeverityError,
+				Message:  e.Msg,
+			})
+		}
+		return nil, &ValidationError{Message: "代码检查失败", Diagnostics: diagnostics}
+	}
+	return &goSource{fset: fset, file: file, src: src, prefixed: prefixed}, nil
+}
+
+// errorAt 创建指向用户代码中某个位置的校验错误，pos 为 token.NoPos 时不带位置
+func (s *goSource) errorAt(pos token.Pos, format string, args ...interface{}) error {
+	diagnostic := Diagnostic{Severity: SeverityError, Message: fmt.Sprintf(format, args...)}
+	if pos.IsValid() {
+		position := s.fset.Position(pos)
+		diagnostic.File, diagnostic.Line, diagnostic.Column = position.Filename, position.Line, position.Column
+	}
+	return &ValidationError{Message: "代码检查失败", Diagnostics: []Diagnostic{diagnostic}}
+}
+
+// checkHandler 检查入口函数已声明且签名可由入口程序调用，并且没有与入口程序冲突的 main 函数
+func (s *goSource) checkHandler(name string) error {
+	for _, decl := range s.file.Decls {
+		if decl, ok := decl.(*ast.FuncDecl); ok && decl.Recv == nil && decl.Name.Name == "main" {
+			return s.errorAt(decl.Name.Pos(), "用户代码不能定义 main 函数，入口程序由平台生成")
+		}
+	}
+
+	handler, declared := findGoHandler(s.file, name)
+	if !declared {
+		return s.errorAt(token.NoPos, "找不到入口函数 %s", name)
+	}
+	if handler == nil {
+		return nil
+	}
+	if problem := goHandlerProblem(s.file, handler); problem != "" {
+		return s.errorAt(handler.Name.Pos(), goHandlerSignatureMessage, name, problem)
+	}
+	return nil
+}
+
+// goHandlerSignatureMessage 入口函数签名不符合要求时的错误信息
+const goHandlerSignatureMessage = "入口函数 %s 的签名不受支持：%s"
+
+// findGoHandler 在文件的顶层声明中查找入口函数；
+// 以变量声明的入口函数返回 nil 和 true，其类型由编译器检查
+func findGoHandler(file *ast.File, name string) (*ast.FuncDecl, bool) {
+	declared := false
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if decl.Recv == nil && decl.Name.Name == name {
+				return decl, true
+			}
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				if spec, ok := spec.(*ast.ValueSpec); ok {
+					for _, ident := range spec.Names {
+						declared = declared || ident.Name == name
+					}
+				}
+			}
+		}
+	}
+	return nil, declared
+}
+
+// goHandlerProblem 检查入口函数声明的签名，返回不符合要求的原因。
+// 参数依次为可选的 context.Context、事件（任意可由JSON解码的类型）和 map[string]string 调用上下文，
+// 返回值为 ()、(R)、(error) 或 (R, error)；入口程序在运行时按同样的规则传参
+func goHandlerProblem(file *ast.File, decl *ast.FuncDecl) string {
+	if decl.Type.TypeParams != nil {
+		return "入口函数不能有类型参数"
+	}
+
+	params := expandFields(decl.Type.Params)
+	if len(params) > 0 && isGoContextType(file, params[0]) {
+		params = params[1:]
+	}
+	for _, param := range params {
+		if _, ok := param.(*ast.Ellipsis); ok {
+			return "入口函数不能有可变参数"
+		}
+		if isGoContextType(file, param) {
+			return "context.Context 必须是第一个参数"
+		}
+	}
+	if len(params) > 2 {
+		return fmt.Sprintf("context.Context 之外最多2个参数（事件和调用上下文），实际为%d个", len(params))
+	}
+	if len(params) == 2 && !isGoStringMap(params[1]) {
+		return "事件之后的调用上下文参数必须是 map[string]string"
+	}
+
+	results := expandFields(decl.Type.Results)
+	if len(results) > 2 {
+		return fmt.Sprintf("最多2个返回值，实际为%d个", len(results))
+	}
+	if len(results) == 2 && !isGoErrorType(results[1]) {
+		return "有2个返回值时第二个必须是 error"
+	}
+	return ""
+}
+
+// expandFields 按名称展开参数列表（a, b T 视为两个参数）
+func expandFields(list *ast.FieldList) []ast.Expr {
+	if list == nil {
+		return nil
+	}
+	var types []ast.Expr
+	for _, field := range list.List {
+		n := len(field.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			types = append(types, field.Type)
+		}
+	}
+	return types
+}
+
+// isGoContextType 判断类型表达式是否为 context.Context（考虑导入别名和自动补充的导入）
+func isGoContextType(file *ast.File, expr ast.Expr) bool {
+	sel, ok := expr.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Context" {
+		return false
+	}
+	pkg, ok := sel.X.(*ast.Ident)
+	if !ok {
+		return false
+	}
+	name, imported := goImportName(file, "context")
+	if !imported {
+		name = "context"
+	}
+	return pkg.Name == name
+}
+
+// isGoStringMap 判断类型表达式是否为 map[string]string
+func isGoStringMap(expr ast.Expr) bool {
+	m, ok := expr.(*ast.MapType)
+	if !ok {
+		return false
+	}
+	key, keyOK := m.Key.(*ast.Ident)
+	value, valueOK := m.Value.(*ast.Ident)
+	return keyOK && valueOK && key.Name == "string" && value.Name == "string"
+}
+
+// isGoErrorType 判断类型表达式是否为 error
+func isGoErrorType(expr ast.Expr) bool {
+	ident, ok := expr.(*ast.Ident)
+	return ok && ident.Name == "error"
+}
+
+// goImportName 返回文件导入指定包时使用的名称
+func goImportName(file *ast.File, importPath string) (string, bool) {
+	for _, spec := range file.Imports {
+		if p, _ := strconv.Unquote(spec.Path.Value); p != importPath {
+			continue
+		}
+		if spec.Name != nil {
+			return spec.Name.Name, true
+		}
+		return path.Base(importPath), true
+	}
+	return "", false
+}
+
+// mainSource 生成包含用户代码的完整 main 程序：用户的 package 声明被替换为 package main，
+// 用户的导入与自动补充的导入合并到入口程序的导入块中；
+// 每段用户代码前加 /*line*/ 指令，编译错误的位置仍对应用户代码(handler.go)
+func (s *goSource) mainSource(call string) string {
+	tokFile := s.fset.File(s.file.Package)
+
+	var imports strings.Builder
+	for _, spec := range s.file.Imports {
+		start, end := tokFile.Offset(spec.Pos()), tokFile.Offset(spec.End())
+		fmt.Fprintf(&imports, "\t%s%s\n", s.lineDirective(spec.Pos()), s.src[start:end])
+	}
+	for _, importPath := range s.missingImports() {
+		fmt.Fprintf(&imports, "\t%q\n", importPath)
+	}
+
+	// 导入之后的用户代码原样保留
+	rest := s.file.Name.End()
+	if s.prefixed {
+		rest = tokFile.Pos(len(goPackagePrefix))
+	}
+	for _, decl := range s.file.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.IMPORT {
+			rest = gen.End()
+		}
+	}
+	userCode := s.lineDirective(rest) + s.src[tokFile.Offset(rest):] + "\n//line main.go:1:1\n"
+
+	return goWrapperSource(imports.String(), userCode, call)
+}
+
+// lineDirective 返回使下一个字符的位置对应用户代码中 pos 位置的 /*line*/ 指令
+func (s *goSource) lineDirective(pos token.Pos) string {
+	position := s.fset.Position(pos)
+	return fmt.Sprintf("/*line %s:%d:%d*/", goSourceFile, position.Line, position.Column)
+}
+
+// missingImports 返回用户代码引用了但没有导入的隐式包
+func (s *goSource) missingImports() []string {
+	var paths []string
+	seen := map[string]bool{}
+	for _, ident := range s.file.Unresolved {
+		importPath, ok := goImplicitImports[ident.Name]
+		if !ok || seen[importPath] {
+			continue
+		}
+		seen[importPath] = true
+		if _, imported := goImportName(s.file, importPath); !imported {
+			paths = append(paths, importPath)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// goMainSource 解析用户代码、检查入口函数并生成完整的 main 程序
+func goMainSource(fn *Function) (string, error) {
+	source, err := parseGoSource(fn.Code)
+	if err != nil {
+		return "", err
+	}
+	if err := source.checkHandler(fn.Handler); err != nil {
+		return "", err
+	}
+	return source.mainSource(fn.Handler), nil
+}
+
+// checkGoPackageHandler 解析代码包入口包目录中的Go源文件，检查入口函数的声明和签名
+func checkGoPackageHandler(dir, handler string) error {
+	pkgDir, name := splitHandler(handler)
+	entries, err := os.ReadDir(filepath.Join(dir, filepath.FromSlash(pkgDir)))
+	if err != nil {
+		return newValidationError("代码包中找不到入口包目录: %s", pkgDir)
+	}
+
+	fset := token.NewFileSet()
+	for _, entry := range entries {
+		fileName := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(fileName, ".go") || strings.HasSuffix(fileName, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, filepath.Join(dir, filepath.FromSlash(pkgDir), fileName), nil, parser.SkipObjectResolution)
+		if err != nil {
+			// 语法错误由编译检查报告
+			return nil
+		}
+		decl, declared := findGoHandler(file, name)
+		if !declared {
+			continue
+		}
+		if decl == nil {
+			return nil
+		}
+		if problem := goHandlerProblem(file, decl); problem != "" {
+			position := fset.Position(decl.Name.Pos())
+			return &ValidationError{
+				Message: "代码检查失败",
+				Diagnostics: []Diagnostic{{
+					File:     path.Join(pkgDir, fileName),
+					Line:     position.Line,
+					Column:   position.Column,
+					Severity: SeverityError,
+					Message:  fmt.Sprintf(goHandlerSignatureMessage, name, problem),
+				}},
+			}
+		}
+		return nil
+	}
+	return newValidationError("入口包 %s 中找不到入口函数 %s", pkgDir, name)
+}
@@ -0,0 +1,199 @@
+package cloudfunction
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCheckGoHandler(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    string
+		problem string // 为空表示签名有效
+		line    int
+	}{
+		{
+			name: "标准签名",
+			code: "func Handler(ctx context.Context, event interface{}) interface{} { return event }",
+		},
+		{
+			name: "any和导入别名",
+			code: "package handlers\n\nimport stdctx \"context\"\n\nfunc Handler(c stdctx.Context, event any) (result interface{}) { return nil }",
+		},
+		{
+			name: "变量声明的入口由编译器检查",
+			code: "var Handler = func(ctx context.Context, event interface{}) interface{} { return nil }",
+		},
+		{
+			name: "结构体事件和error",
+			code: "type Order struct{ ID string }\n\nfunc Handler(ctx context.Context, order Order) (map[string]interface{}, error) { return nil, nil }",
+		},
+		{
+			name: "省略context并读取调用上下文",
+			code: "func Handler(event interface{}, context map[string]string) interface{} { return nil }",
+		},
+		{
+			name: "没有参数和返回值",
+			code: "func Handler() {}",
+		},
+		{
+			name:    "context不是第一个参数",
+			code:    "\nfunc Handler(event any, ctx context.Context) interface{} { return nil }",
+			problem: "context.Context 必须是第一个参数",
+			line:    2,
+		},
+		{
+			name:    "导入别名后仍写 context",
+			code:    "import c \"context\"\n\nfunc Handler(ctx context.Context, event any) interface{} { return nil }",
+			problem: "调用上下文参数必须是 map[string]string",
+			line:    3,
+		},
+		{
+			name:    "参数过多",
+			code:    "func Handler(ctx context.Context, a, b, c any) {}",
+			problem: "最多2个参数",
+			line:    1,
+		},
+		{
+			name:    "可变参数",
+			code:    "func Handler(events ...any) {}",
+			problem: "不能有可变参数",
+			line:    1,
+		},
+		{
+			name:    "第二个返回值不是error",
+			code:    "func Handler(event any) (interface{}, bool) { return nil, false }",
+			problem: "第二个必须是 error",
+			line:    1,
+		},
+		{
+			name:    "类型参数",
+			code:    "func Handler[T any](ctx context.Context, event T) interface{} { return nil }",
+			problem: "不能有类型参数",
+			line:    1,
+		},
+		{
+			name:    "定义了main",
+			code:    "func Handler(ctx context.Context, event any) interface{} { return nil }\n\nfunc main() {}",
+			problem: "不能定义 main 函数",
+			line:    3,
+		},
+		{
+			name:    "找不到入口",
+			code:    "func Other(ctx context.Context, event any) interface{} { return nil }",
+			problem: "找不到入口函数 Handler",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, err := parseGoSource(tt.code)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = source.checkHandler("Handler")
+			if tt.problem == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var validation *ValidationError
+			if !errors.As(err, &validation) {
+				t.Fatalf("err = %v, want *ValidationError", err)
+			}
+			d := validation.Diagnostics[0]
+			if !strings.Contains(d.Message, tt.problem) || d.Line != tt.line {
+				t.Fatalf("诊断 = %+v, want 第%d行 %q", d, tt.line, tt.problem)
+			}
+		})
+	}
+}
+
+func TestParseGoSourceSyntaxErrorPosition(t *testing.T) {
+	// 没有 package 声明时补上的前缀不影响行号
+	_, err := parseGoSource("func Handler(ctx context.Context, event any) interface{} {\n\treturn {\n}\n")
+	var validation *ValidationError
+	if !errors.As(err, &validation) {
+		t.Fatalf("err = %v, want *ValidationError", err)
+	}
+	if d := validation.Diagnostics[0]; d.File != goSourceFile || d.Line != 2 {
+		t.Fatalf("诊断 = %+v, want handler.go 第2行", d)
+	}
+}
+
+func TestGoMainSourceAddsImplicitImports(t *testing.T) {
+	source, err := parseGoSource("import \"strings\"\n\nfunc Handler(ctx context.Context, event any) interface{} {\n\tdata, _ := json.Marshal(event)\n\treturn strings.ToUpper(fmt.Sprint(string(data)))\n}\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(source.missingImports(), ","); got != "context,encoding/json,fmt" {
+		t.Fatalf("missingImports = %s", got)
+	}
+}
+
+func TestExecuteGoFunction(t *testing.T) {
+	requireTool(t, "go")
+	p := newTestPlatform(t)
+	fn := &Function{
+		Name:    "go-handler",
+		Runtime: "go",
+		Handler: "Handle",
+		Timeout: 10,
+		Memory:  128,
+		Code: `package orders
+
+import (
+	"errors"
+	"strings"
+)
+
+type Order struct {
+	ID    string  ` + "`json:\"id\"`" + `
+	Total float64 ` + "`json:\"total\"`" + `
+}
+
+func Handle(ctx context.Context, order Order, meta map[string]string) (map[string]interface{}, error) {
+	if order.ID == "" {
+		return nil, errors.New("缺少订单ID")
+	}
+	return map[string]interface{}{"id": strings.ToUpper(order.ID), "tax": order.Total * 0.1, "source": meta["source"]}, nil
+}
+`,
+	}
+	if err := p.CreateFunction(fn); err != nil {
+		t.Fatal(err)
+	}
+	waitForBuilds(t, p)
+
+	resp, err := p.ExecuteFunction(fn.ID, &ExecuteRequest{
+		Event:   map[string]interface{}{"id": "a1", "total": 50},
+		Context: map[string]string{"source": "test"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := json.Marshal(resp.Result); !resp.Success || string(got) != `{"id":"A1","source":"test","tax":5}` {
+		t.Fatalf("resp = %+v, result = %s", resp, got)
+	}
+
+	tests := []struct {
+		event     interface{}
+		errorType string
+		message   string
+	}{
+		{map[string]interface{}{"total": 1}, ErrorTypeHandler, "缺少订单ID"},
+		{map[string]interface{}{"id": 1}, ErrorTypeValidation, ""},
+	}
+	for _, tt := range tests {
+		resp, err := p.ExecuteFunction(fn.ID, &ExecuteRequest{Event: tt.event})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Success || resp.ErrorType != tt.errorType || !strings.Contains(resp.Error, tt.message) {
+			t.Errorf("event %v: resp = %+v, want %s 错误", tt.event, resp, tt.errorType)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package cloudfunction
+
+import "testing"
+
+func TestInvocationContextPassedToHandlers(t *testing.T) {
+	tests := []struct {
+		tool string
+		fn   *Function
+	}{
+		{
+			tool: "node",
+			fn: newNodeFunction("ctx-node", `function handler(event, context) {
+  return {id: context.requestId, name: context.functionName, version: context.functionVersion,
+          memory: context.memoryLimitInMB, remaining: context.getRemainingTimeMs(),
+          user: context.user, client: context.clientContext.user};
+}`),
+		},
+		{
+			tool: "python3",
+			fn: &Function{Name: "ctx-python", Runtime: "python", Handler: "handler", Timeout: 10, Memory: 128,
+				Code: `def handler(event, context):
+    return {"id": context.request_id, "name": context.function_name, "version": context.function_version,
+            "memory": context.memory_limit_in_mb, "remaining": context.get_remaining_time_ms(),
+            "user": context["user"], "client": context.client_context["user"]}
+`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fn.Runtime, func(t *testing.T) {
+			requireTool(t, tt.tool)
+			p := newTestPlatform(t)
+			if err := p.CreateFunction(tt.fn); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := p.PublishVersion(tt.fn.ID, ""); err != nil {
+				t.Fatal(err)
+			}
+			waitForBuilds(t, p)
+
+			resp, err := p.ExecuteFunction(tt.fn.ID+":1", &ExecuteRequest{Context: map[string]string{"user": "u-1"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, ok := resp.Result.(map[string]interface{})
+			if !resp.Success || !ok {
+				t.Fatalf("resp = %+v", resp)
+			}
+			if result["id"] != resp.RequestID || result["name"] != tt.fn.Name || result["version"] != "1" || result["memory"] != float64(128) {
+				t.Errorf("调用信息 = %v, request_id = %s", result, resp.RequestID)
+			}
+			if remaining := result["remaining"].(float64); remaining <= 0 || remaining > 10000 {
+				t.Errorf("剩余时间 = %vms, want (0, 10000]", remaining)
+			}
+			// 调用请求中的 context 仍按原来的方式读取
+			if result["user"] != "u-1" || result["client"] != "u-1" {
+				t.Errorf("调用请求的 context = %v", result)
+			}
+		})
+	}
+}
+
+func TestGoHandlerContextHasDeadline(t *testing.T) {
+	requireTool(t, "go")
+	p := newTestPlatform(t)
+	fn := &Function{Name: "ctx-go", Runtime: "go", Handler: "Handler", Timeout: 5, Memory: 128,
+		Code: `import "time"
+
+func Handler(ctx context.Context, event interface{}) interface{} {
+	deadline, ok := ctx.Deadline()
+	return map[string]interface{}{"ok": ok, "remaining": time.Until(deadline).Milliseconds(), "request": os.Getenv("FC_REQUEST_ID")}
+}
+`}
+	if err := p.CreateFunction(fn); err != nil {
+		t.Fatal(err)
+	}
+	waitForBuilds(t, p)
+
+	resp, err := p.ExecuteFunction(fn.ID, &ExecuteRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, _ := resp.Result.(map[string]interface{})
+	if !resp.Success || result["ok"] != true || result["request"] != resp.RequestID {
+		t.Fatalf("resp = %+v", resp)
+	}
+	if remaining := result["remaining"].(float64); remaining <= 0 || remaining > 5000 {
+		t.Fatalf("剩余时间 = %vms, want (0, 5000]", remaining)
+	}
+}
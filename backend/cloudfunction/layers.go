@@ -0,0 +1,466 @@
+package cloudfunction
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxFunctionLayers 一个函数最多引用的层数
+const maxFunctionLayers = 5
+
+// goLayersWorkFile 引用了Go模块层时在编译目录生成的工作区文件，通过 GOWORK 指定，不影响代码包自带的 go.work
+const goLayersWorkFile = ".fclayers.work"
+
+// ErrLayerInUse 层版本仍被函数或已发布版本引用
+var ErrLayerInUse = errors.New("层正在被函数使用")
+
+var layerNamePattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_-]{0,63}$`)
+
+// Layer 可被多个函数共享的层（公共库、依赖或数据文件），每次上传生成一个不可变的新版本。
+// 层的压缩包与函数代码包一样按内容哈希保存在 workDir/packages 下
+type Layer struct {
+	Name          string          `json:"name"`
+	LatestVersion int             `json:"latest_version"` // 最近发布的版本号，删除的版本号不会复用
+	Versions      []*LayerVersion `json:"versions"`
+	CreatedAt     time.Time       `json:"created_at"`
+	UpdatedAt     time.Time       `json:"updated_at"`
+}
+
+// LayerVersion 层的不可变版本
+type LayerVersion struct {
+	Version     int          `json:"version"`
+	Description string       `json:"description,omitempty"`
+	Package     *CodePackage `json:"package"`
+	CreatedAt   time.Time    `json:"created_at"`
+}
+
+// LayerRef 函数对层版本的引用
+type LayerRef struct {
+	Name    string `json:"name"`
+	Version int    `json:"version"`
+}
+
+func (r LayerRef) String() string {
+	return fmt.Sprintf("%s:%d", r.Name, r.Version)
+}
+
+// preparedLayer 执行时已解压的层
+type preparedLayer struct {
+	LayerRef
+	Dir string
+}
+
+// validateLayerName 校验层名称
+func validateLayerName(name string) error {
+	if !layerNamePattern.MatchString(name) {
+		return fmt.Errorf("无效的层名称: %s（需以字母开头，1-64个字符，只能包含字母、数字、-和_）", name)
+	}
+	return nil
+}
+
+// loadLayers 从JSON文件加载层
+func (p *Platform) loadLayers() error {
+	data, err := os.ReadFile(p.layersFile)
+	if os.IsNotExist(err) || (err == nil && len(data) == 0) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("读取层数据文件失败: %v", err)
+	}
+
+	var layers []*Layer
+	if err := json.Unmarshal(data, &layers); err != nil {
+		return fmt.Errorf("解析层数据文件失败: %v", err)
+	}
+	for _, layer := range layers {
+		p.layers[layer.Name] = layer
+	}
+	return nil
+}
+
+// saveLayers 将层保存到JSON文件，调用方需持有 p.mutex
+func (p *Platform) saveLayers() error {
+	if err := os.MkdirAll(filepath.Dir(p.layersFile), 0755); err != nil {
+		return fmt.Errorf("创建数据目录失败: %v", err)
+	}
+
+	data, err := json.MarshalIndent(p.sortedLayers(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化层数据失败: %v", err)
+	}
+	if err := os.WriteFile(p.layersFile, data, 0644); err != nil {
+		return fmt.Errorf("写入层数据文件失败: %v", err)
+	}
+	return nil
+}
+
+// sortedLayers 按名称排序返回所有层，调用方需持有 p.mutex
+func (p *Platform) sortedLayers() []*Layer {
+	layers := make([]*Layer, 0, len(p.layers))
+	for _, layer := range p.layers {
+		layers = append(layers, layer)
+	}
+	sort.Slice(layers, func(i, j int) bool { return layers[i].Name < layers[j].Name })
+	return layers
+}
+
+// replaceLayer 以写时复制的方式替换（updated 为 nil 时删除）层并持久化，失败时回滚
+func (p *Platform) replaceLayer(name string, updated *Layer) error {
+	existing, exists := p.layers[name]
+	if updated == nil {
+		delete(p.layers, name)
+	} else {
+		p.layers[name] = updated
+	}
+
+	if err := p.saveLayers(); err != nil {
+		if exists {
+			p.layers[name] = existing
+		} else {
+			delete(p.layers, name)
+		}
+		return fmt.Errorf("持久化层失败: %v", err)
+	}
+	return nil
+}
+
+// PublishLayerVersion 上传压缩包作为层的新版本，层不存在时自动创建
+func (p *Platform) PublishLayerVersion(name, description string, data []byte) (*LayerVersion, error) {
+	if err := validateLayerName(name); err != nil {
+		return nil, newValidationError("%v", err)
+	}
+	// 直接上传的模块和可执行文件只能作为函数代码
+	if format := detectPackageFormat(data); format != PackageFormatZip && format != PackageFormatTarGz {
+		return nil, newValidationError("层只支持 zip 和 tar.gz 压缩包")
+	}
+	pkg, err := p.StorePackage(data)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	now := time.Now()
+	updated := &Layer{Name: name, CreatedAt: now}
+	if existing, exists := p.layers[name]; exists {
+		copied := *existing
+		updated = &copied
+	}
+	version := &LayerVersion{
+		Version:     updated.LatestVersion + 1,
+		Description: description,
+		Package:     pkg,
+		CreatedAt:   now,
+	}
+	updated.LatestVersion = version.Version
+	updated.Versions = append(append([]*LayerVersion(nil), updated.Versions...), version)
+	updated.UpdatedAt = now
+
+	if err := p.replaceLayer(name, updated); err != nil {
+		return nil, err
+	}
+	return version, nil
+}
+
+// ListLayers 按名称列出所有层
+func (p *Platform) ListLayers() []*Layer {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.sortedLayers()
+}
+
+// GetLayer 获取层
+func (p *Platform) GetLayer(name string) (*Layer, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	layer, exists := p.layers[name]
+	if !exists {
+		return nil, fmt.Errorf("层不存在: %s", name)
+	}
+	return layer, nil
+}
+
+// findLayerVersion 查找层版本，调用方需持有 p.mutex
+func (p *Platform) findLayerVersion(ref LayerRef) (*LayerVersion, error) {
+	layer, exists := p.layers[ref.Name]
+	if !exists {
+		return nil, fmt.Errorf("层不存在: %s", ref.Name)
+	}
+	for _, version := range layer.Versions {
+		if version.Version == ref.Version {
+			return version, nil
+		}
+	}
+	return nil, fmt.Errorf("层 %s 不存在版本: %d", ref.Name, ref.Version)
+}
+
+// LayerUsage 返回引用层各版本的函数，$LATEST 记为函数ID，已发布版本记为 函数ID:版本号
+func (p *Platform) LayerUsage(name string) map[int][]string {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	usage := make(map[int][]string)
+	for _, fn := range p.functions {
+		for _, ref := range fn.Layers {
+			if ref.Name == name {
+				usage[ref.Version] = append(usage[ref.Version], fn.ID)
+			}
+		}
+		for _, v := range fn.Versions {
+			for _, ref := range v.Layers {
+				if ref.Name == name {
+					usage[ref.Version] = append(usage[ref.Version], fmt.Sprintf("%s:%d", fn.ID, v.Version))
+				}
+			}
+		}
+	}
+	for _, refs := range usage {
+		sort.Strings(refs)
+	}
+	return usage
+}
+
+// layerInUse 检查层版本是否被函数当前配置或已发布版本引用，version 为 0 时检查所有版本。
+// 调用方需持有 p.mutex
+func (p *Platform) layerInUse(name string, version int) (string, bool) {
+	matches := func(refs []LayerRef) bool {
+		for _, ref := range refs {
+			if ref.Name == name && (version == 0 || ref.Version == version) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, fn := range p.functions {
+		if matches(fn.Layers) {
+			return fn.ID, true
+		}
+		for _, v := range fn.Versions {
+			if matches(v.Layers) {
+				return fmt.Sprintf("%s:%d", fn.ID, v.Version), true
+			}
+		}
+	}
+	return "", false
+}
+
+// DeleteLayerVersion 删除未被任何函数引用的层版本
+func (p *Platform) DeleteLayerVersion(name string, version int) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	ref := LayerRef{Name: name, Version: version}
+	if _, err := p.findLayerVersion(ref); err != nil {
+		return err
+	}
+	if user, inUse := p.layerInUse(name, version); inUse {
+		return fmt.Errorf("%w: %s 被 %s 引用", ErrLayerInUse, ref, user)
+	}
+
+	updated := *p.layers[name]
+	updated.Versions = make([]*LayerVersion, 0, len(updated.Versions))
+	for _, v := range p.layers[name].Versions {
+		if v.Version != version {
+			updated.Versions = append(updated.Versions, v)
+		}
+	}
+	updated.UpdatedAt = time.Now()
+	if err := p.replaceLayer(name, &updated); err != nil {
+		return err
+	}
+
+	os.RemoveAll(p.layerDir(ref))
+	p.removeUnusedPackages()
+	return nil
+}
+
+// DeleteLayer 删除层及其所有版本，任一版本被引用时拒绝
+func (p *Platform) DeleteLayer(name string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if _, exists := p.layers[name]; !exists {
+		return fmt.Errorf("层不存在: %s", name)
+	}
+	if user, inUse := p.layerInUse(name, 0); inUse {
+		return fmt.Errorf("%w: %s 被 %s 引用", ErrLayerInUse, name, user)
+	}
+	if err := p.replaceLayer(name, nil); err != nil {
+		return err
+	}
+
+	os.RemoveAll(filepath.Join(p.workDir, "layers", name))
+	p.removeUnusedPackages()
+	return nil
+}
+
+// layerDir 返回层版本的解压目录，其中按内容哈希区分，删除后重建的同名层不会使用旧的解压结果
+func (p *Platform) layerDir(ref LayerRef) string {
+	return filepath.Join(p.workDir, "layers", ref.Name, strconv.Itoa(ref.Version))
+}
+
+// validateLayerRefs 校验函数引用的层：数量限制、不能重复引用同一个层、引用的版本必须存在
+func (p *Platform) validateLayerRefs(refs []LayerRef) error {
+	if len(refs) > maxFunctionLayers {
+		return newValidationError("一个函数最多引用 %d 个层", maxFunctionLayers)
+	}
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	seen := make(map[string]bool)
+	for _, ref := range refs {
+		if seen[ref.Name] {
+			return newValidationError("不能重复引用层: %s", ref.Name)
+		}
+		seen[ref.Name] = true
+		if _, err := p.findLayerVersion(ref); err != nil {
+			return newValidationError("%v", err)
+		}
+	}
+	return nil
+}
+
+// prepareLayers 确保函数引用的层已解压到 workDir/layers/<名称>/<版本>，按引用顺序返回。
+// linkDir 不为空时在其中的 layers 目录下为每个层创建同名的符号链接，函数可按相对路径读取层中的文件
+func (p *Platform) prepareLayers(fn *Function, linkDir string) ([]*preparedLayer, error) {
+	if len(fn.Layers) == 0 {
+		return nil, nil
+	}
+
+	layers := make([]*preparedLayer, 0, len(fn.Layers))
+	for _, ref := range fn.Layers {
+		p.mutex.RLock()
+		version, err := p.findLayerVersion(ref)
+		p.mutex.RUnlock()
+		if err != nil {
+			return nil, newExecutionError(ErrorTypeValidation, "%v", err)
+		}
+
+		dir := filepath.Join(p.layerDir(ref), version.Package.SHA256[:16])
+		if err := p.extractOnce(version.Package, dir, nil); err != nil {
+			return nil, newExecutionError(ErrorTypePlatform, "解压层 %s 失败: %v", ref, err)
+		}
+		layers = append(layers, &preparedLayer{LayerRef: ref, Dir: dir})
+	}
+
+	if linkDir != "" {
+		if err := linkLayers(filepath.Join(linkDir, "layers"), layers); err != nil {
+			return nil, newExecutionError(ErrorTypePlatform, "链接层失败: %v", err)
+		}
+	}
+	return layers, nil
+}
+
+// linkLayers 在 dir 下创建指向各层解压目录的符号链接，已存在的同名普通文件或目录保持不变
+func linkLayers(dir string, layers []*preparedLayer) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, layer := range layers {
+		link := filepath.Join(dir, layer.Name)
+		if target, err := os.Readlink(link); err == nil && target == layer.Dir {
+			continue
+		} else if err != nil && fileExists(link) {
+			continue
+		}
+
+		// 先创建临时链接再重命名，并发执行时不会看到缺失的链接
+		tmp := link + ".tmp-" + generateRequestID()
+		if err := os.Symlink(layer.Dir, tmp); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, link); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+	}
+	return nil
+}
+
+// layerPathEnv 按运行时将层加入模块搜索路径：Python 层优先使用 python 子目录，
+// Node.js 层优先使用 nodejs/node_modules 或 node_modules 子目录，否则使用层的根目录。
+// 已有的值（如代码包依赖的 NODE_PATH）排在层之前
+func layerPathEnv(env map[string]string, runtime string, layers []*preparedLayer) {
+	var key string
+	var candidates []string
+	switch runtime {
+	case "python":
+		key, candidates = "PYTHONPATH", []string{"python"}
+	case "nodejs":
+		key, candidates = "NODE_PATH", []string{filepath.Join("nodejs", "node_modules"), "node_modules"}
+	default:
+		return
+	}
+
+	var paths []string
+	if existing := env[key]; existing != "" {
+		paths = append(paths, existing)
+	}
+	for _, layer := range layers {
+		path := layer.Dir
+		for _, candidate := range candidates {
+			if fileExists(filepath.Join(layer.Dir, candidate)) {
+				path = filepath.Join(layer.Dir, candidate)
+				break
+			}
+		}
+		paths = append(paths, path)
+	}
+	if len(paths) > 0 {
+		env[key] = strings.Join(paths, string(os.PathListSeparator))
+	}
+}
+
+// goLayerModules 返回层中的Go模块目录：层根目录或其 go 子目录中有 go.mod 时视为模块，其他层只提供文件
+func goLayerModules(layers []*preparedLayer) []string {
+	var modules []string
+	for _, layer := range layers {
+		for _, dir := range []string{filepath.Join(layer.Dir, "go"), layer.Dir} {
+			if fileExists(filepath.Join(dir, "go.mod")) {
+				modules = append(modules, dir)
+				break
+			}
+		}
+	}
+	return modules
+}
+
+// useGoLayers 通过工作区文件将层中的Go模块与函数模块一起编译，函数代码可直接导入层模块中的包。
+// 没有Go模块层时删除之前生成的工作区文件
+func (p *Platform) useGoLayers(ctx context.Context, dir string, layers []*preparedLayer) error {
+	workFile := filepath.Join(dir, goLayersWorkFile)
+	os.Remove(workFile)
+
+	modules := goLayerModules(layers)
+	if len(modules) == 0 {
+		return nil
+	}
+	if fileExists(filepath.Join(dir, "vendor", "modules.txt")) {
+		return newExecutionError(ErrorTypeValidation, "带 vendor 目录的Go代码包不能引用包含Go模块的层")
+	}
+	if err := p.ensureGoModule(ctx, dir); err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, runtimeBinary("go"), append([]string{"work", "init", dir}, modules...)...)
+	cmd.Dir = dir
+	cmd.Env = append(p.goBuildEnv(dir), "GOWORK="+workFile)
+	if output, err := combinedOutput(cmd); err != nil {
+		return fmt.Errorf("生成Go工作区失败: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
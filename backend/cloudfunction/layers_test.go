@@ -0,0 +1,127 @@
+package cloudfunction
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestLayerOnPythonPath(t *testing.T) {
+	requireTool(t, "python3")
+	p := newTestPlatform(t)
+
+	data := buildZip(t, []packageEntry{
+		{name: "python/shared.py", body: "def greet(name):\n    return 'hi ' + name\n"},
+		{name: "data/greeting.txt", body: "from layer"},
+	})
+	if err := validateLayerName("1shared"); err == nil {
+		t.Fatal("以数字开头的层名称应无效")
+	}
+	if _, err := p.PublishLayerVersion("shared", "公共库", data); err != nil {
+		t.Fatal(err)
+	}
+
+	fn := &Function{
+		Name:    "layered",
+		Runtime: "python",
+		Handler: "handler",
+		Timeout: 10,
+		Memory:  128,
+		Layers:  []LayerRef{{Name: "shared", Version: 1}},
+		Code: `import shared
+
+def handler(event, context):
+    with open("layers/shared/data/greeting.txt") as f:
+        return [shared.greet(event["name"]), f.read()]
+`,
+	}
+	if err := p.CreateFunction(fn); err != nil {
+		t.Fatal(err)
+	}
+
+	waitForBuilds(t, p)
+	resp, err := p.ExecuteFunction(fn.ID, &ExecuteRequest{Event: map[string]interface{}{"name": "layer"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := json.Marshal(resp.Result); !resp.Success || string(got) != `["hi layer","from layer"]` {
+		t.Fatalf("resp = %+v", resp)
+	}
+}
+
+func TestValidateLayerRefs(t *testing.T) {
+	p := newTestPlatform(t)
+	if _, err := p.PublishLayerVersion("lib", "", buildZip(t, []packageEntry{{name: "a.txt", body: "a"}})); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.validateLayerRefs([]LayerRef{{Name: "lib", Version: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.validateLayerRefs([]LayerRef{{Name: "lib", Version: 1}, {Name: "lib", Version: 1}}); err == nil {
+		t.Error("重复引用同一个层应返回错误")
+	}
+	if err := p.validateLayerRefs([]LayerRef{{Name: "lib", Version: 2}}); err == nil {
+		t.Error("引用不存在的版本应返回错误")
+	}
+	var refs []LayerRef
+	for i := 0; i <= maxFunctionLayers; i++ {
+		refs = append(refs, LayerRef{Name: "lib", Version: 1})
+	}
+	if err := p.validateLayerRefs(refs); err == nil {
+		t.Error("超过层数限制应返回错误")
+	}
+}
+
+func TestDeleteLayerVersionInUse(t *testing.T) {
+	p := newTestPlatform(t)
+	data := buildZip(t, []packageEntry{{name: "config.json", body: "{}"}})
+	for i := 0; i < 2; i++ {
+		if _, err := p.PublishLayerVersion("config", "", data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fn := newNodeFunction("uses-layer", "function handler() { return 1; }")
+	fn.Layers = []LayerRef{{Name: "config", Version: 1}}
+	if err := p.CreateFunction(fn); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.PublishVersion(fn.ID, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// $LATEST 改为引用版本2后，已发布的版本1仍引用层版本1
+	update := newNodeFunction("uses-layer", "function handler() { return 2; }")
+	update.Layers = []LayerRef{{Name: "config", Version: 2}}
+	if err := p.UpdateFunction(fn.ID, update); err != nil {
+		t.Fatal(err)
+	}
+	want := map[int][]string{1: {fn.ID + ":1"}, 2: {fn.ID}}
+	if usage := p.LayerUsage("config"); !reflect.DeepEqual(usage, want) {
+		t.Fatalf("LayerUsage = %v, want %v", usage, want)
+	}
+
+	if err := p.DeleteLayerVersion("config", 1); !errors.Is(err, ErrLayerInUse) {
+		t.Fatalf("err = %v, want ErrLayerInUse", err)
+	}
+	if err := p.DeleteLayer("config"); !errors.Is(err, ErrLayerInUse) {
+		t.Fatalf("err = %v, want ErrLayerInUse", err)
+	}
+
+	waitForBuilds(t, p)
+	if err := p.DeleteFunction(fn.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.DeleteLayerVersion("config", 1); err != nil {
+		t.Fatal(err)
+	}
+	layer, err := p.GetLayer("config")
+	if err != nil || len(layer.Versions) != 1 || layer.LatestVersion != 2 {
+		t.Fatalf("GetLayer = %+v, %v", layer, err)
+	}
+	if err := p.DeleteLayer("config"); err != nil {
+		t.Fatal(err)
+	}
+}
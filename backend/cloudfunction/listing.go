@@ -0,0 +1,214 @@
+package cloudfunction
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// 列表查询支持的过滤条件，与 Storage.ListFunctions 的 filters 参数一致
+const (
+	FilterNamespace  = "namespace"   // string，命名空间
+	FilterRuntime    = "runtime"     // string，运行时
+	FilterNamePrefix = "name_prefix" // string，名称前缀
+	FilterLabels     = "labels"      // map[string]string，需全部匹配的标签，值为空表示只要求存在该标签
+	FilterSort       = "sort"        // string，排序字段：name、created、updated
+	FilterOrder      = "order"       // string，排序方向：asc、desc
+	FilterLimit      = "limit"       // int，每页数量
+	FilterCursor     = "cursor"      // string，上一页返回的 next_cursor
+)
+
+// 分页默认值
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+var labelKeyPattern = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9._/-]{0,61}[a-zA-Z0-9])?$`)
+
+// FunctionPage 函数列表的一页
+type FunctionPage struct {
+	Functions  []*Function `json:"functions"`
+	Total      int         `json:"total"`                 // 满足过滤条件的函数总数
+	NextCursor string      `json:"next_cursor,omitempty"` // 为空表示没有下一页
+}
+
+// listCursor 分页游标内容
+type listCursor struct {
+	Key string `json:"k"`
+	ID  string `json:"id"`
+}
+
+// QueryFunctions 按过滤条件、排序和游标分页列出函数
+func (p *Platform) QueryFunctions(filters map[string]interface{}) (*FunctionPage, error) {
+	return queryFunctions(p.ListFunctions(), filters)
+}
+
+// queryFunctions 对函数列表应用过滤、排序和分页
+func queryFunctions(functions []*Function, filters map[string]interface{}) (*FunctionPage, error) {
+	namespace, _ := filters[FilterNamespace].(string)
+	runtime, _ := filters[FilterRuntime].(string)
+	namePrefix, _ := filters[FilterNamePrefix].(string)
+	labels, _ := filters[FilterLabels].(map[string]string)
+	cursorStr, _ := filters[FilterCursor].(string)
+
+	sortField, _ := filters[FilterSort].(string)
+	if sortField == "" {
+		sortField = "created"
+	}
+	sortKey, err := sortKeyFunc(sortField)
+	if err != nil {
+		return nil, err
+	}
+
+	order, _ := filters[FilterOrder].(string)
+	if order == "" {
+		order = "asc"
+	}
+	if order != "asc" && order != "desc" {
+		return nil, fmt.Errorf("无效的排序方向: %s", order)
+	}
+	desc := order == "desc"
+
+	limit := defaultPageSize
+	if value, ok := filters[FilterLimit].(int); ok && value != 0 {
+		limit = value
+	}
+	if limit < 0 || limit > maxPageSize {
+		return nil, fmt.Errorf("每页数量必须在1-%d之间: %d", maxPageSize, limit)
+	}
+
+	matched := make([]*Function, 0, len(functions))
+	for _, fn := range functions {
+		if namespace != "" && fn.Namespace != namespace {
+			continue
+		}
+		if runtime != "" && fn.Runtime != runtime {
+			continue
+		}
+		if namePrefix != "" && !strings.HasPrefix(fn.Name, namePrefix) {
+			continue
+		}
+		if !matchLabels(fn.Labels, labels) {
+			continue
+		}
+		matched = append(matched, fn)
+	}
+
+	// 以 (排序键, ID) 排序，保证顺序稳定
+	less := func(a, b *Function) bool {
+		ka, kb := sortKey(a), sortKey(b)
+		if ka != kb {
+			return ka < kb
+		}
+		return a.ID < b.ID
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		if desc {
+			return less(matched[j], matched[i])
+		}
+		return less(matched[i], matched[j])
+	})
+
+	start := 0
+	if cursorStr != "" {
+		cursor, err := decodeCursor(cursorStr)
+		if err != nil {
+			return nil, err
+		}
+		start = sort.Search(len(matched), func(i int) bool {
+			key := sortKey(matched[i])
+			if desc {
+				return key < cursor.Key || (key == cursor.Key && matched[i].ID < cursor.ID)
+			}
+			return key > cursor.Key || (key == cursor.Key && matched[i].ID > cursor.ID)
+		})
+	}
+
+	end := start + limit
+	if end > len(matched) {
+		end = len(matched)
+	}
+
+	page := &FunctionPage{
+		Functions: matched[start:end],
+		Total:     len(matched),
+	}
+	if end < len(matched) {
+		last := matched[end-1]
+		page.NextCursor = encodeCursor(listCursor{Key: sortKey(last), ID: last.ID})
+	}
+	return page, nil
+}
+
+// sortKeyFunc 返回排序字段对应的排序键，时间格式化为可按字典序比较的字符串
+func sortKeyFunc(field string) (func(*Function) string, error) {
+	const timeLayout = "2006-01-02T15:04:05.000000000"
+
+	switch field {
+	case "name":
+		return func(fn *Function) string { return fn.Name }, nil
+	case "created":
+		return func(fn *Function) string { return fn.CreatedAt.UTC().Format(timeLayout) }, nil
+	case "updated":
+		return func(fn *Function) string { return fn.UpdatedAt.UTC().Format(timeLayout) }, nil
+	default:
+		return nil, fmt.Errorf("无效的排序字段: %s（支持 name、created、updated）", field)
+	}
+}
+
+// matchLabels 检查函数标签是否满足所有过滤条件
+func matchLabels(labels, required map[string]string) bool {
+	for key, value := range required {
+		actual, ok := labels[key]
+		if !ok || (value != "" && actual != value) {
+			return false
+		}
+	}
+	return true
+}
+
+// encodeCursor 编码分页游标
+func encodeCursor(cursor listCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor 解码分页游标
+func decodeCursor(value string) (listCursor, error) {
+	var cursor listCursor
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err == nil {
+		err = json.Unmarshal(data, &cursor)
+	}
+	if err != nil {
+		return cursor, fmt.Errorf("无效的分页游标: %s", value)
+	}
+	return cursor, nil
+}
+
+// validateLabels 校验函数标签
+func validateLabels(labels map[string]string) error {
+	for key, value := range labels {
+		if !labelKeyPattern.MatchString(key) {
+			return fmt.Errorf("无效的标签名: %s", key)
+		}
+		if len(value) > 63 {
+			return fmt.Errorf("标签 %s 的值过长（最多63个字符）", key)
+		}
+	}
+	return nil
+}
+
+// sortFunctionsByCreated 按创建时间排序函数列表
+func sortFunctionsByCreated(functions []*Function) {
+	sort.Slice(functions, func(i, j int) bool {
+		if !functions[i].CreatedAt.Equal(functions[j].CreatedAt) {
+			return functions[i].CreatedAt.Before(functions[j].CreatedAt)
+		}
+		return functions[i].ID < functions[j].ID
+	})
+}
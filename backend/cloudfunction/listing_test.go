@@ -0,0 +1,106 @@
+package cloudfunction
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	tests := []listCursor{
+		{Key: "hello", ID: "fn_1"},
+		{Key: "", ID: ""},
+		{Key: "2024-01-02T03:04:05.000000000", ID: "fn_1748575613798741000"},
+		{Key: "名称/with spaces&symbols=?", ID: "fn_x"},
+	}
+	for _, cursor := range tests {
+		encoded := encodeCursor(cursor)
+		decoded, err := decodeCursor(encoded)
+		if err != nil {
+			t.Fatalf("decodeCursor(%q): %v", encoded, err)
+		}
+		if decoded != cursor {
+			t.Fatalf("round trip = %+v, want %+v", decoded, cursor)
+		}
+	}
+}
+
+func TestDecodeCursorTampered(t *testing.T) {
+	valid := encodeCursor(listCursor{Key: "a", ID: "fn_1"})
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"非base64", "!!!not-base64!!!"},
+		{"标准base64填充", base64.StdEncoding.EncodeToString([]byte(`{"k":"ab","id":"fn_1"}`))},
+		{"截断", valid[:len(valid)-3]},
+		{"非JSON", base64.RawURLEncoding.EncodeToString([]byte("plain text"))},
+		{"字段类型错误", base64.RawURLEncoding.EncodeToString([]byte(`{"k":1,"id":"fn_1"}`))},
+		{"JSON数组", base64.RawURLEncoding.EncodeToString([]byte(`["a","fn_1"]`))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeCursor(tt.value); err == nil {
+				t.Fatalf("decodeCursor(%q) 应返回错误", tt.value)
+			}
+			filters := map[string]interface{}{FilterCursor: tt.value}
+			if _, err := queryFunctions(nil, filters); err == nil {
+				t.Fatal("queryFunctions 应拒绝无效的游标")
+			}
+		})
+	}
+}
+
+func TestQueryFunctionsPagination(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var functions []*Function
+	for i := 0; i < 7; i++ {
+		functions = append(functions, &Function{
+			ID:        fmt.Sprintf("fn_%d", i),
+			Name:      fmt.Sprintf("func-%d", 6-i),
+			Namespace: DefaultNamespace,
+			// 两个函数共用一个创建时间，翻页时按ID区分
+			CreatedAt: base.Add(time.Duration(i/2) * time.Second),
+		})
+	}
+
+	for _, sort := range []string{"created", "name"} {
+		for _, order := range []string{"asc", "desc"} {
+			t.Run(sort+"/"+order, func(t *testing.T) {
+				seen := make(map[string]bool)
+				cursor := ""
+				for pages := 0; ; pages++ {
+					if pages > len(functions) {
+						t.Fatal("分页没有结束")
+					}
+					page, err := queryFunctions(functions, map[string]interface{}{
+						FilterSort:   sort,
+						FilterOrder:  order,
+						FilterLimit:  3,
+						FilterCursor: cursor,
+					})
+					if err != nil {
+						t.Fatal(err)
+					}
+					if page.Total != len(functions) {
+						t.Fatalf("Total = %d, want %d", page.Total, len(functions))
+					}
+					for _, fn := range page.Functions {
+						if seen[fn.ID] {
+							t.Fatalf("函数 %s 在多页中重复出现", fn.ID)
+						}
+						seen[fn.ID] = true
+					}
+					if page.NextCursor == "" {
+						break
+					}
+					cursor = page.NextCursor
+				}
+				if len(seen) != len(functions) {
+					t.Fatalf("分页共返回 %d 个函数, want %d", len(seen), len(functions))
+				}
+			})
+		}
+	}
+}
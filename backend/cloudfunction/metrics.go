@@ -1,6 +1,8 @@
 package cloudfunction
 
 import (
+	"fmt"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -31,6 +33,11 @@ type Metrics struct {
 	// 系统指标
 	StartTime time.Time `json:"start_time"`
 
+	// 按函数版本统计，键为 "函数ID:版本号"
+	revisions map[string]*RevisionStats
+	// 通过别名调用的各版本统计，键为 "函数ID:别名:版本号"，金丝雀回滚只根据这部分流量判断
+	aliasRevisions map[string]*RevisionStats
+
 	mu sync.RWMutex
 }
 
@@ -40,6 +47,8 @@ func NewMetrics() *Metrics {
 		RuntimeUsage:     make(map[string]int64),
 		ErrorsByType:     make(map[string]int64),
 		StartTime:        time.Now(),
+		revisions:        make(map[string]*RevisionStats),
+		aliasRevisions:   make(map[string]*RevisionStats),
 		MinExecutionTime: 999999999, // 初始化为一个很大的值
 	}
 }
@@ -158,6 +167,8 @@ func (m *Metrics) Reset() {
 	m.RuntimeUsage = make(map[string]int64)
 	m.ErrorsByType = make(map[string]int64)
 	m.StartTime = time.Now()
+	m.revisions = make(map[string]*RevisionStats)
+	m.aliasRevisions = make(map[string]*RevisionStats)
 }
 
 // 全局指标实例
@@ -241,3 +252,169 @@ func (pm *PerformanceMonitor) CheckAlerts() []string {
 
 // 全局性能监控实例
 var GlobalPerformanceMonitor = NewPerformanceMonitor(GlobalMetrics)
+
+// maxRevisionSamples 每个版本保留的最近执行样本数量
+const maxRevisionSamples = 1000
+
+// revisionSample 单次执行样本，用于按时间窗口计算错误率
+type revisionSample struct {
+	at       time.Time
+	success  bool
+	duration int64
+}
+
+// RevisionStats 单个函数版本的执行统计
+type RevisionStats struct {
+	Invocations     int64 `json:"invocations"`
+	Errors          int64 `json:"errors"`
+	TotalDurationMs int64 `json:"total_duration_ms"`
+	MinDurationMs   int64 `json:"min_duration_ms"`
+	MaxDurationMs   int64 `json:"max_duration_ms"`
+	samples         []revisionSample
+}
+
+// RevisionSnapshot 版本统计快照
+type RevisionSnapshot struct {
+	FunctionID    string  `json:"function_id"`
+	Version       int     `json:"version"`
+	Invocations   int64   `json:"invocations"`
+	Errors        int64   `json:"errors"`
+	SuccessRate   float64 `json:"success_rate_percent"`
+	AvgDurationMs float64 `json:"avg_duration_ms"`
+	MinDurationMs int64   `json:"min_duration_ms"`
+	MaxDurationMs int64   `json:"max_duration_ms"`
+}
+
+// revisionKey 生成版本统计的键
+func revisionKey(functionID string, version int) string {
+	return fmt.Sprintf("%s:%d", functionID, version)
+}
+
+// aliasRevisionKey 生成别名版本统计的键
+func aliasRevisionKey(functionID, alias string, version int) string {
+	return fmt.Sprintf("%s:%s:%d", functionID, alias, version)
+}
+
+// RecordRevision 记录某个函数版本的一次执行
+func (m *Metrics) RecordRevision(functionID string, version int, duration time.Duration, success bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	recordRevision(m.revisions, revisionKey(functionID, version), duration, success)
+}
+
+// RecordAliasRevision 记录通过别名路由到某个版本的一次执行
+func (m *Metrics) RecordAliasRevision(functionID, alias string, version int, duration time.Duration, success bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	recordRevision(m.aliasRevisions, aliasRevisionKey(functionID, alias, version), duration, success)
+}
+
+// recordRevision 将一次执行计入统计，调用方需持有写锁
+func recordRevision(revisions map[string]*RevisionStats, key string, duration time.Duration, success bool) {
+	durationMs := duration.Milliseconds()
+	stats, ok := revisions[key]
+	if !ok {
+		stats = &RevisionStats{MinDurationMs: durationMs}
+		revisions[key] = stats
+	}
+
+	stats.Invocations++
+	if !success {
+		stats.Errors++
+	}
+	stats.TotalDurationMs += durationMs
+	if durationMs < stats.MinDurationMs {
+		stats.MinDurationMs = durationMs
+	}
+	if durationMs > stats.MaxDurationMs {
+		stats.MaxDurationMs = durationMs
+	}
+
+	stats.samples = append(stats.samples, revisionSample{at: time.Now(), success: success, duration: durationMs})
+	if len(stats.samples) > maxRevisionSamples {
+		stats.samples = stats.samples[len(stats.samples)-maxRevisionSamples:]
+	}
+}
+
+// RevisionErrorRate 计算版本在最近时间窗口内的错误率(百分比)及样本数
+func (m *Metrics) RevisionErrorRate(functionID string, version int, window time.Duration) (float64, int) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.revisions[revisionKey(functionID, version)].errorRate(window)
+}
+
+// AliasErrorRate 计算通过别名路由到版本的调用在最近时间窗口内的错误率(百分比)及样本数
+func (m *Metrics) AliasErrorRate(functionID, alias string, version int, window time.Duration) (float64, int) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.aliasRevisions[aliasRevisionKey(functionID, alias, version)].errorRate(window)
+}
+
+// errorRate 计算最近时间窗口内样本的错误率，调用方需持有读锁
+func (stats *RevisionStats) errorRate(window time.Duration) (float64, int) {
+	if stats == nil {
+		return 0, 0
+	}
+
+	since := time.Now().Add(-window)
+	total, failed := 0, 0
+	for i := len(stats.samples) - 1; i >= 0; i-- {
+		sample := stats.samples[i]
+		if sample.at.Before(since) {
+			break
+		}
+		total++
+		if !sample.success {
+			failed++
+		}
+	}
+
+	if total == 0 {
+		return 0, 0
+	}
+	return float64(failed) / float64(total) * 100, total
+}
+
+// ForgetFunction 删除函数所有版本和别名的统计，函数删除后调用
+func (m *Metrics) ForgetFunction(functionID string) {
+	m.forget(functionID + ":")
+}
+
+// ForgetAlias 删除别名的统计，别名删除或重新配置后之前的调用不再参与金丝雀判断
+func (m *Metrics) ForgetAlias(functionID, alias string) {
+	m.forget(functionID + ":" + alias + ":")
+}
+
+// forget 删除键以 prefix 开头的统计
+func (m *Metrics) forget(prefix string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, revisions := range []map[string]*RevisionStats{m.revisions, m.aliasRevisions} {
+		for key := range revisions {
+			if strings.HasPrefix(key, prefix) {
+				delete(revisions, key)
+			}
+		}
+	}
+}
+
+// GetRevisionSnapshot 获取函数版本的统计快照
+func (m *Metrics) GetRevisionSnapshot(functionID string, version int) RevisionSnapshot {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	snapshot := RevisionSnapshot{FunctionID: functionID, Version: version}
+	stats, ok := m.revisions[revisionKey(functionID, version)]
+	if !ok || stats.Invocations == 0 {
+		return snapshot
+	}
+
+	snapshot.Invocations = stats.Invocations
+	snapshot.Errors = stats.Errors
+	snapshot.SuccessRate = float64(stats.Invocations-stats.Errors) / float64(stats.Invocations) * 100
+	snapshot.AvgDurationMs = float64(stats.TotalDurationMs) / float64(stats.Invocations)
+	snapshot.MinDurationMs = stats.MinDurationMs
+	snapshot.MaxDurationMs = stats.MaxDurationMs
+	return snapshot
+}
@@ -0,0 +1,149 @@
+package cloudfunction
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultNamespace 未指定命名空间时使用的默认命名空间
+const DefaultNamespace = "default"
+
+// ErrNameTaken 函数名称在命名空间内已被使用
+var ErrNameTaken = errors.New("函数名称已被使用")
+
+var (
+	functionNamePattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_-]{0,63}$`)
+	namespacePattern    = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+)
+
+// NameRedirect 重命名后保留的旧名称，在宽限期内仍可用于访问函数
+type NameRedirect struct {
+	Name      string    `json:"name"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// nameEntry 名称索引项
+type nameEntry struct {
+	id        string
+	expiresAt time.Time // 零值表示当前名称，否则为旧名称的过期时间
+}
+
+// validateFunctionName 校验函数名称
+func validateFunctionName(name string) error {
+	if !functionNamePattern.MatchString(name) {
+		return fmt.Errorf("无效的函数名称: %s（需以字母开头，1-64个字符，只能包含字母、数字、-和_）", name)
+	}
+	// 避免与生成的函数ID混淆
+	if strings.HasPrefix(name, "fn_") {
+		return fmt.Errorf("函数名称不能以 fn_ 开头: %s", name)
+	}
+	return nil
+}
+
+// validateNamespace 校验命名空间
+func validateNamespace(namespace string) error {
+	if !namespacePattern.MatchString(namespace) {
+		return fmt.Errorf("无效的命名空间: %s（只能包含小写字母、数字和-，最长63个字符）", namespace)
+	}
+	return nil
+}
+
+// nameKey 生成名称索引的键
+func nameKey(namespace, name string) string {
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+	return namespace + "/" + name
+}
+
+// indexNames 重建名称索引，调用方需持有写锁
+func (p *Platform) indexNames() {
+	now := time.Now()
+	names := make(map[string]nameEntry, len(p.functions))
+
+	for _, fn := range p.functions {
+		key := nameKey(fn.Namespace, fn.Name)
+		if other, exists := names[key]; exists && other.expiresAt.IsZero() {
+			Warn("函数名称重复: %s (函数 %s 与 %s)", key, other.id, fn.ID)
+			continue
+		}
+		names[key] = nameEntry{id: fn.ID}
+	}
+
+	for _, fn := range p.functions {
+		for _, redirect := range fn.PreviousNames {
+			if !redirect.ExpiresAt.After(now) {
+				continue
+			}
+			key := nameKey(fn.Namespace, redirect.Name)
+			// 当前名称优先于旧名称
+			if _, exists := names[key]; !exists {
+				names[key] = nameEntry{id: fn.ID, expiresAt: redirect.ExpiresAt}
+			}
+		}
+	}
+
+	p.names = names
+}
+
+// checkNameAvailable 检查名称在命名空间内是否可用，调用方需持有锁
+func (p *Platform) checkNameAvailable(namespace, name, selfID string) error {
+	entry, exists := p.names[nameKey(namespace, name)]
+	if !exists || entry.id == selfID {
+		return nil
+	}
+	if !entry.expiresAt.IsZero() && !entry.expiresAt.After(time.Now()) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s/%s (函数 %s)", ErrNameTaken, namespace, name, entry.id)
+}
+
+// ResolveFunctionID 将函数名称或ID解析为函数ID，支持 "名称:限定符" 形式；
+// 通过旧名称访问时 renamedTo 返回函数的当前名称
+func (p *Platform) ResolveFunctionID(namespace, ref string) (id string, renamedTo string, err error) {
+	base, qualifier := splitQualifier(ref)
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	if _, exists := p.functions[base]; exists {
+		return ref, "", nil
+	}
+
+	entry, exists := p.names[nameKey(namespace, base)]
+	if !exists || (!entry.expiresAt.IsZero() && !entry.expiresAt.After(time.Now())) {
+		return "", "", fmt.Errorf("函数不存在: %s", base)
+	}
+
+	if !entry.expiresAt.IsZero() {
+		renamedTo = p.functions[entry.id].Name
+	}
+
+	id = entry.id
+	if qualifier != "" {
+		id += ":" + qualifier
+	}
+	return id, renamedTo, nil
+}
+
+// renameRedirects 计算重命名后的旧名称列表，调用方需持有锁
+func (p *Platform) renameRedirects(existing *Function, newName string) []NameRedirect {
+	now := time.Now()
+	redirects := make([]NameRedirect, 0, len(existing.PreviousNames)+1)
+	for _, redirect := range existing.PreviousNames {
+		// 丢弃已过期的旧名称以及重新启用的名称
+		if redirect.ExpiresAt.After(now) && redirect.Name != newName && redirect.Name != existing.Name {
+			redirects = append(redirects, redirect)
+		}
+	}
+	if p.options.NameRedirectTTL > 0 {
+		redirects = append(redirects, NameRedirect{
+			Name:      existing.Name,
+			ExpiresAt: now.Add(p.options.NameRedirectTTL),
+		})
+	}
+	return redirects
+}
@@ -0,0 +1,166 @@
+package cloudfunction
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateFunctionName(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"hello", true},
+		{"Hello_World-2", true},
+		{"a", true},
+		{strings.Repeat("a", 64), true},
+		{strings.Repeat("a", 65), false},
+		{"", false},
+		{"1hello", false},
+		{"-hello", false},
+		{"hello world", false},
+		{"hello:prod", false},
+		{"名称", false},
+		{"fn_123", false},
+	}
+	for _, tt := range tests {
+		if err := validateFunctionName(tt.name); (err == nil) != tt.valid {
+			t.Errorf("validateFunctionName(%q) = %v, want valid=%v", tt.name, err, tt.valid)
+		}
+	}
+}
+
+func TestSplitQualifier(t *testing.T) {
+	tests := []struct {
+		ref, base, qualifier string
+	}{
+		{"hello", "hello", ""},
+		{"hello:prod", "hello", "prod"},
+		{"hello:3", "hello", "3"},
+		{"hello:$LATEST", "hello", "$LATEST"},
+		{"fn_1:", "fn_1", ""},
+		{"a:b:c", "a:b", "c"},
+	}
+	for _, tt := range tests {
+		base, qualifier := splitQualifier(tt.ref)
+		if base != tt.base || qualifier != tt.qualifier {
+			t.Errorf("splitQualifier(%q) = %q, %q; want %q, %q", tt.ref, base, qualifier, tt.base, tt.qualifier)
+		}
+	}
+}
+
+func TestResolveFunctionID(t *testing.T) {
+	p := &Platform{functions: map[string]*Function{
+		"fn_1": {ID: "fn_1", Name: "hello", Namespace: DefaultNamespace},
+		"fn_2": {ID: "fn_2", Name: "hello", Namespace: "team-a"},
+		"fn_3": {ID: "fn_3", Name: "current", Namespace: DefaultNamespace, PreviousNames: []NameRedirect{
+			{Name: "renamed", ExpiresAt: time.Now().Add(time.Hour)},
+			{Name: "expired", ExpiresAt: time.Now().Add(-time.Hour)},
+			{Name: "hello", ExpiresAt: time.Now().Add(time.Hour)},
+		}},
+	}}
+	p.indexNames()
+
+	tests := []struct {
+		name      string
+		namespace string
+		ref       string
+		id        string
+		renamedTo string
+		wantErr   bool
+	}{
+		{name: "函数ID", namespace: DefaultNamespace, ref: "fn_1", id: "fn_1"},
+		{name: "函数ID带限定符", namespace: DefaultNamespace, ref: "fn_1:prod", id: "fn_1:prod"},
+		{name: "名称", namespace: DefaultNamespace, ref: "hello", id: "fn_1"},
+		{name: "空命名空间使用默认值", namespace: "", ref: "hello", id: "fn_1"},
+		{name: "名称带别名", namespace: DefaultNamespace, ref: "hello:prod", id: "fn_1:prod"},
+		{name: "名称带版本号", namespace: DefaultNamespace, ref: "hello:2", id: "fn_1:2"},
+		{name: "其他命名空间的同名函数", namespace: "team-a", ref: "hello", id: "fn_2"},
+		{name: "当前名称优先于旧名称", namespace: DefaultNamespace, ref: "hello", id: "fn_1"},
+		{name: "旧名称", namespace: DefaultNamespace, ref: "renamed:prod", id: "fn_3:prod", renamedTo: "current"},
+		{name: "过期的旧名称", namespace: DefaultNamespace, ref: "expired", wantErr: true},
+		{name: "命名空间中不存在", namespace: "team-b", ref: "hello", wantErr: true},
+		{name: "不存在的名称", namespace: DefaultNamespace, ref: "missing", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, renamedTo, err := p.ResolveFunctionID(tt.namespace, tt.ref)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ResolveFunctionID(%q) = %q, want error", tt.ref, id)
+				}
+				return
+			}
+			if err != nil || id != tt.id || renamedTo != tt.renamedTo {
+				t.Fatalf("ResolveFunctionID(%q) = %q, %q, %v; want %q, %q", tt.ref, id, renamedTo, err, tt.id, tt.renamedTo)
+			}
+		})
+	}
+}
+
+func TestCheckNameAvailable(t *testing.T) {
+	p := &Platform{functions: map[string]*Function{
+		"fn_1": {ID: "fn_1", Name: "hello", Namespace: DefaultNamespace, PreviousNames: []NameRedirect{
+			{Name: "old", ExpiresAt: time.Now().Add(time.Hour)},
+			{Name: "expired", ExpiresAt: time.Now().Add(-time.Hour)},
+		}},
+	}}
+	p.indexNames()
+
+	tests := []struct {
+		name      string
+		namespace string
+		fnName    string
+		selfID    string
+		taken     bool
+	}{
+		{name: "已使用的名称", namespace: DefaultNamespace, fnName: "hello", taken: true},
+		{name: "函数自身的名称", namespace: DefaultNamespace, fnName: "hello", selfID: "fn_1"},
+		{name: "宽限期内的旧名称", namespace: DefaultNamespace, fnName: "old", taken: true},
+		{name: "过期的旧名称", namespace: DefaultNamespace, fnName: "expired"},
+		{name: "其他命名空间", namespace: "team-a", fnName: "hello"},
+		{name: "未使用的名称", namespace: DefaultNamespace, fnName: "new"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.checkNameAvailable(tt.namespace, tt.fnName, tt.selfID)
+			if tt.taken != errors.Is(err, ErrNameTaken) {
+				t.Fatalf("checkNameAvailable(%q) = %v, want taken=%v", tt.fnName, err, tt.taken)
+			}
+		})
+	}
+}
+
+func TestRenameKeepsOldNameDuringGracePeriod(t *testing.T) {
+	p := newTestPlatform(t)
+	fn := newNodeFunction("orders", "function handler() { return 1; }")
+	if err := p.CreateFunction(fn); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.CreateFunction(newNodeFunction("orders", "function handler() { return 2; }")); !errors.Is(err, ErrNameTaken) {
+		t.Fatalf("重复的名称: err = %v, want ErrNameTaken", err)
+	}
+
+	if err := p.UpdateFunction(fn.ID, newNodeFunction("orders-v2", "function handler() { return 1; }")); err != nil {
+		t.Fatal(err)
+	}
+
+	id, renamedTo, err := p.ResolveFunctionID("", "orders")
+	if err != nil || id != fn.ID || renamedTo != "orders-v2" {
+		t.Fatalf("旧名称解析为 %q, %q, %v", id, renamedTo, err)
+	}
+	// 宽限期内旧名称仍被占用，不能给其他函数使用
+	if err := p.CreateFunction(newNodeFunction("orders", "function handler() { return 2; }")); !errors.Is(err, ErrNameTaken) {
+		t.Fatalf("宽限期内的旧名称: err = %v, want ErrNameTaken", err)
+	}
+
+	// 改回旧名称时不再保留跳转
+	if err := p.UpdateFunction(fn.ID, newNodeFunction("orders", "function handler() { return 1; }")); err != nil {
+		t.Fatal(err)
+	}
+	if id, renamedTo, err := p.ResolveFunctionID("", "orders"); err != nil || id != fn.ID || renamedTo != "" {
+		t.Fatalf("当前名称解析为 %q, %q, %v", id, renamedTo, err)
+	}
+}
@@ -0,0 +1,225 @@
+package cloudfunction
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 网络出口策略
+const (
+	NetworkUnrestricted = "unrestricted" // 使用宿主网络，不做限制
+	NetworkNone         = "none"         // 没有任何网络，包括回环网卡
+	NetworkLoopback     = "loopback"     // 只能访问函数自身网络命名空间内的回环地址
+	NetworkAllowlist    = "allowlist"    // 只能通过平台的出口代理访问白名单内的主机和端口
+)
+
+// egressProxyPort 出口代理在函数网络命名空间内监听的端口
+const egressProxyPort = 3128
+
+// egressDialTimeout 出口代理连接目标的超时时间
+const egressDialTimeout = 10 * time.Second
+
+var networkHostPattern = regexp.MustCompile(`^(\*\.)?[a-zA-Z0-9]([a-zA-Z0-9.-]{0,251}[a-zA-Z0-9])?$`)
+
+// NetworkPolicy 函数的网络出口策略
+type NetworkPolicy struct {
+	Mode  string   `json:"mode"`            // unrestricted、none、loopback、allowlist
+	Allow []string `json:"allow,omitempty"` // allowlist 模式允许访问的目标：host、host:port、*.example.com:443
+}
+
+// validateNetworkPolicy 校验网络出口策略
+func validateNetworkPolicy(policy *NetworkPolicy) error {
+	if policy == nil {
+		return nil
+	}
+
+	switch policy.Mode {
+	case NetworkUnrestricted, NetworkNone, NetworkLoopback:
+		if len(policy.Allow) > 0 {
+			return newValidationError("网络模式 %s 不能设置 allow，只有 allowlist 模式使用白名单", policy.Mode)
+		}
+	case NetworkAllowlist:
+		if len(policy.Allow) == 0 {
+			return newValidationError("allowlist 网络模式至少需要一个允许访问的目标")
+		}
+		for _, entry := range policy.Allow {
+			if _, _, err := parseNetworkTarget(entry); err != nil {
+				return newValidationError("无效的网络白名单条目 %q: %v", entry, err)
+			}
+		}
+	default:
+		return newValidationError("无效的网络模式: %s（支持 %s、%s、%s、%s）", policy.Mode,
+			NetworkUnrestricted, NetworkNone, NetworkLoopback, NetworkAllowlist)
+	}
+	return nil
+}
+
+// parseNetworkTarget 解析白名单条目，端口为空表示允许所有端口
+func parseNetworkTarget(entry string) (string, string, error) {
+	host, port := entry, ""
+	if strings.HasPrefix(entry, "[") || strings.Count(entry, ":") == 1 {
+		var err error
+		if host, port, err = net.SplitHostPort(entry); err != nil {
+			return "", "", err
+		}
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return "", "", fmt.Errorf("无效的端口: %s", port)
+		}
+	}
+	if net.ParseIP(host) == nil && !networkHostPattern.MatchString(host) {
+		return "", "", fmt.Errorf("无效的主机名: %s", host)
+	}
+	return strings.ToLower(host), port, nil
+}
+
+// networkMode 返回函数实际使用的网络模式：未配置策略时，沙箱中的函数只有回环网络，其余不限制
+func (p *Platform) networkMode(fn *Function) string {
+	if fn.Network != nil {
+		return fn.Network.Mode
+	}
+	if p.sandboxEnabled(fn) {
+		return NetworkLoopback
+	}
+	return NetworkUnrestricted
+}
+
+// allows 检查目标地址是否在白名单内
+func (policy *NetworkPolicy) allows(host, port string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, entry := range policy.Allow {
+		allowedHost, allowedPort, err := parseNetworkTarget(entry)
+		if err != nil || (allowedPort != "" && allowedPort != port) {
+			continue
+		}
+		if suffix, ok := strings.CutPrefix(allowedHost, "*"); ok {
+			if strings.HasSuffix(host, suffix) {
+				return true
+			}
+		} else if host == allowedHost {
+			return true
+		}
+	}
+	return false
+}
+
+// proxyEnv 让函数通过出口代理访问网络的环境变量
+func proxyEnv() []string {
+	proxy := fmt.Sprintf("http://127.0.0.1:%d", egressProxyPort)
+	return []string{
+		"HTTP_PROXY=" + proxy, "HTTPS_PROXY=" + proxy,
+		"http_proxy=" + proxy, "https_proxy=" + proxy,
+		"NO_PROXY=localhost,127.0.0.1", "no_proxy=localhost,127.0.0.1",
+	}
+}
+
+// serveEgressProxy 在函数网络命名空间内的监听套接字上提供出口代理，直到本次调用结束。
+// 支持 CONNECT 隧道和普通 HTTP 代理请求，白名单外的目标返回 403 并记录到本次调用
+func (p *Platform) serveEgressProxy(ctx context.Context, fn *Function, inv *invocation, listeners <-chan net.Listener) {
+	var listener net.Listener
+	select {
+	case listener = <-listeners:
+	case <-ctx.Done():
+		return
+	}
+	if listener == nil {
+		return
+	}
+
+	dialer := &net.Dialer{Timeout: egressDialTimeout}
+	transport := &http.Transport{DialContext: dialer.DialContext}
+	defer transport.CloseIdleConnections()
+
+	server := &http.Server{
+		ReadHeaderTimeout: egressDialTimeout,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host, port := r.URL.Hostname(), r.URL.Port()
+			if r.Method == http.MethodConnect {
+				host, port, _ = net.SplitHostPort(r.Host)
+			} else if port == "" {
+				port = "80"
+				if r.URL.Scheme == "https" {
+					port = "443"
+				}
+			}
+			target := net.JoinHostPort(host, port)
+
+			if host == "" || !fn.Network.allows(host, port) {
+				inv.addNetworkViolation(target)
+				GlobalLogger.Warn("函数 %s 的调用 %s 访问 %s 被网络策略拒绝", fn.ID, inv.requestID, target)
+				http.Error(w, "目标不在函数的网络白名单内: "+target, http.StatusForbidden)
+				return
+			}
+
+			if r.Method == http.MethodConnect {
+				proxyConnect(ctx, w, dialer, target)
+				return
+			}
+
+			outReq := r.Clone(ctx)
+			outReq.RequestURI = ""
+			outReq.Header.Del("Proxy-Connection")
+			outReq.Header.Del("Proxy-Authorization")
+			resp, err := transport.RoundTrip(outReq)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadGateway)
+				return
+			}
+			defer resp.Body.Close()
+			for key, values := range resp.Header {
+				w.Header()[key] = values
+			}
+			w.WriteHeader(resp.StatusCode)
+			io.Copy(w, resp.Body)
+		}),
+	}
+
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	server.Serve(listener)
+}
+
+// proxyConnect 建立 CONNECT 隧道并双向转发数据
+func proxyConnect(ctx context.Context, w http.ResponseWriter, dialer *net.Dialer, target string) {
+	upstream, err := dialer.DialContext(ctx, "tcp", target)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer upstream.Close()
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "不支持 CONNECT", http.StatusInternalServerError)
+		return
+	}
+	client, buffered, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+	defer client.Close()
+
+	client.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(upstream, buffered)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(client, upstream)
+		done <- struct{}{}
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
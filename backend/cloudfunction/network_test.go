@@ -0,0 +1,125 @@
+package cloudfunction
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestValidateNetworkPolicy(t *testing.T) {
+	valid := []*NetworkPolicy{
+		nil,
+		{Mode: NetworkUnrestricted},
+		{Mode: NetworkNone},
+		{Mode: NetworkLoopback},
+		{Mode: NetworkAllowlist, Allow: []string{"api.example.com", "*.example.org:443", "10.0.0.1:8080", "[::1]:80"}},
+	}
+	for _, policy := range valid {
+		if err := validateNetworkPolicy(policy); err != nil {
+			t.Errorf("validateNetworkPolicy(%+v): %v", policy, err)
+		}
+	}
+
+	invalid := []*NetworkPolicy{
+		{Mode: "open"},
+		{Mode: NetworkNone, Allow: []string{"example.com"}},
+		{Mode: NetworkAllowlist},
+		{Mode: NetworkAllowlist, Allow: []string{"example.com:0"}},
+		{Mode: NetworkAllowlist, Allow: []string{"example.com:http"}},
+		{Mode: NetworkAllowlist, Allow: []string{"exa mple.com"}},
+		{Mode: NetworkAllowlist, Allow: []string{"http://example.com"}},
+	}
+	for _, policy := range invalid {
+		if err := validateNetworkPolicy(policy); err == nil {
+			t.Errorf("validateNetworkPolicy(%+v) 应返回错误", policy)
+		}
+	}
+}
+
+func TestNetworkPolicyAllows(t *testing.T) {
+	policy := &NetworkPolicy{Mode: NetworkAllowlist, Allow: []string{"API.example.com", "*.cdn.example.org:443", "10.0.0.1:8080"}}
+	tests := []struct {
+		host, port string
+		allowed    bool
+	}{
+		{"api.example.com", "443", true},
+		{"api.example.com", "80", true},
+		{"api.example.com.", "443", true},
+		{"other.example.com", "443", false},
+		{"img.cdn.example.org", "443", true},
+		{"img.cdn.example.org", "80", false},
+		{"cdn.example.org", "443", false},
+		{"10.0.0.1", "8080", true},
+		{"10.0.0.1", "22", false},
+	}
+	for _, tt := range tests {
+		if got := policy.allows(tt.host, tt.port); got != tt.allowed {
+			t.Errorf("allows(%s, %s) = %v, want %v", tt.host, tt.port, got, tt.allowed)
+		}
+	}
+}
+
+func TestAllowlistEgressThroughProxy(t *testing.T) {
+	requireTool(t, "python3")
+	if err := SandboxAvailable(); err != nil {
+		t.Skipf("当前主机不支持沙箱: %v", err)
+	}
+
+	// 监听 127.0.0.2，不在代理的 NO_PROXY 列表中，函数只能经出口代理访问
+	listener, err := net.Listen("tcp", "127.0.0.2:0")
+	if err != nil {
+		t.Skipf("无法监听 127.0.0.2: %v", err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "pong")
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+	allowed := listener.Addr().String()
+	_, port, _ := net.SplitHostPort(allowed)
+	denied := net.JoinHostPort("127.0.0.3", port)
+
+	p := newTestPlatform(t)
+	fn := &Function{Name: "egress", Runtime: "python", Handler: "handler", Timeout: 20, Memory: 128,
+		Network: &NetworkPolicy{Mode: NetworkAllowlist, Allow: []string{allowed}},
+		Code: `import urllib.request
+
+def fetch(url):
+    try:
+        return urllib.request.urlopen(url, timeout=5).read().decode()
+    except Exception as e:
+        return "error: " + str(e)
+
+def handler(event, context):
+    return {"allowed": fetch(event["allowed"]), "denied": fetch(event["denied"])}
+`}
+	if err := p.CreateFunction(fn); err != nil {
+		t.Fatal(err)
+	}
+
+	waitForBuilds(t, p)
+	resp, err := p.ExecuteFunction(fn.ID, &ExecuteRequest{Event: map[string]interface{}{
+		"allowed": "http://" + allowed + "/",
+		"denied":  "http://" + denied + "/",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Success {
+		t.Fatalf("执行失败: %s", resp.Error)
+	}
+	data, _ := json.Marshal(resp.Result)
+	result := string(data)
+	if !strings.Contains(result, `"allowed":"pong"`) {
+		t.Errorf("白名单内的目标应可访问: %s", result)
+	}
+	if !strings.Contains(result, `"denied":"error:`) {
+		t.Errorf("白名单外的目标应被拒绝: %s", result)
+	}
+	if len(resp.NetworkViolations) != 1 || resp.NetworkViolations[0] != denied {
+		t.Errorf("NetworkViolations = %v, want [%s]", resp.NetworkViolations, denied)
+	}
+}
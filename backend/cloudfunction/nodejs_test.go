@@ -0,0 +1,121 @@
+package cloudfunction
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNodeJSHandlerStyles(t *testing.T) {
+	requireTool(t, "node")
+	p := newTestPlatform(t)
+
+	tests := []struct {
+		name      string
+		code      string
+		want      string // 期望的返回值 JSON
+		errorType string
+		message   string
+	}{
+		{name: "exports", code: "exports.handler = async (event) => event.n + 1;", want: "2"},
+		{name: "module-exports", code: "function handler(event) { return [event.n]; }\nmodule.exports = { handler };", want: "[1]"},
+		{name: "legacy", code: "function helper(n) { return n * 10; }\nfunction handler(event) { return helper(event.n); }", want: "10"},
+		{
+			name: "esm",
+			code: "import { createHash } from 'crypto';\n\nexport const handler = async (event) => createHash('sha256').update(String(event.n)).digest('hex').slice(0, 8);",
+			want: `"6b86b273"`,
+		},
+		{name: "callback", code: "exports.handler = (event, context, callback) => { setTimeout(() => callback(null, {n: event.n}), 10); };", want: `{"n":1}`},
+		{
+			name:      "callback-error",
+			code:      "exports.handler = (event, context, callback) => callback(new Error('callback failed'));",
+			errorType: ErrorTypeHandler,
+			message:   "callback failed",
+		},
+		{
+			name:      "load-error",
+			code:      "throw new Error('load failed');\nexports.handler = () => 1;",
+			errorType: ErrorTypeHandler,
+			message:   "load failed",
+		},
+		{
+			name:      "unhandled-rejection",
+			code:      "exports.handler = () => { Promise.reject(new Error('rejected')); return new Promise(() => {}); };",
+			errorType: ErrorTypeHandler,
+			message:   "rejected",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fn := newNodeFunction("node-"+tt.name, tt.code)
+			if err := p.CreateFunction(fn); err != nil {
+				t.Fatal(err)
+			}
+			waitForBuilds(t, p)
+
+			resp, err := p.ExecuteFunction(fn.ID, &ExecuteRequest{Event: map[string]interface{}{"n": 1}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.errorType != "" {
+				if resp.Success || resp.ErrorType != tt.errorType || !strings.Contains(resp.Error, tt.message) {
+					t.Fatalf("resp = %+v, want %s 错误包含 %q", resp, tt.errorType, tt.message)
+				}
+				return
+			}
+			if got, _ := json.Marshal(resp.Result); !resp.Success || string(got) != tt.want {
+				t.Fatalf("resp = %+v, result = %s, want %s", resp, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNodeJSExitsAfterResult(t *testing.T) {
+	requireTool(t, "node")
+	p := newTestPlatform(t)
+	fn := newNodeFunction("node-timers", "exports.handler = async () => { setInterval(() => {}, 1000); return 'done'; };")
+	if err := p.CreateFunction(fn); err != nil {
+		t.Fatal(err)
+	}
+	waitForBuilds(t, p)
+
+	// 遗留的定时器不会让调用等到超时
+	start := time.Now()
+	resp, err := p.ExecuteFunction(fn.ID, &ExecuteRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Success || resp.Result != "done" || time.Since(start) > 5*time.Second {
+		t.Fatalf("resp = %+v, 耗时 %v", resp, time.Since(start))
+	}
+}
+
+func TestNodeJSModulePackage(t *testing.T) {
+	requireTool(t, "node")
+	p := newTestPlatform(t)
+	fn := newNodeFunction("node-esm-package", "function handler() { return 0; }")
+	if err := p.CreateFunction(fn); err != nil {
+		t.Fatal(err)
+	}
+
+	// "type": "module" 包中的 .js 按 ES 模块导入
+	data := buildZip(t, []packageEntry{
+		{name: "package.json", body: `{"type": "module"}`},
+		{name: "lib/math.js", body: "export const square = (n) => n * n;\n"},
+		{name: "src/app.js", body: "import { square } from '../lib/math.js';\nexport async function main(event) { return square(event.n); }\n"},
+	})
+	if _, err := p.UploadPackage(fn.ID, data, "src/app.main"); err != nil {
+		t.Fatal(err)
+	}
+	waitForBuilds(t, p)
+
+	resp, err := p.ExecuteFunction(fn.ID, &ExecuteRequest{Event: map[string]interface{}{"n": 7}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := json.Marshal(resp.Result); !resp.Success || string(got) != "49" {
+		t.Fatalf("resp = %+v", resp)
+	}
+}
@@ -0,0 +1,69 @@
+package cloudfunction
+
+import "time"
+
+// Options 云函数平台配置
+type Options struct {
+	// NameRedirectTTL 函数重命名后旧名称继续可用的宽限期
+	NameRedirectTTL time.Duration
+
+	// 部署时校验使用的限制
+	EnabledRuntimes []string // 启用的运行时
+	MaxCodeSize     int64    // 代码大小上限(KB)
+	MaxTimeout      int      // 超时时间上限(秒)
+	MinMemory       int      // 内存限制下限(MB)
+	MaxMemory       int      // 内存限制上限(MB)
+
+	// 代码包限制
+	MaxPackageSize  int64 // 上传的压缩包大小上限(MB)
+	MaxUnpackedSize int64 // 解压后的总大小上限(MB)
+	MaxPackageFiles int   // 压缩包内的文件和目录数上限
+
+	// 代码包依赖的本地来源，安装时不访问网络
+	GoProxy          string // 编译Go函数使用的 GOPROXY，如 file:///srv/goproxy 或 off；为空时继承宿主配置
+	GoModCache       string // 编译Go函数使用的 GOMODCACHE；为空时继承宿主配置
+	NpmCache         string // npm 离线缓存目录，用于没有附带 node_modules 的 Node.js 代码包
+	PythonWheelhouse string // 安装 requirements.txt 使用的本地 wheel 目录
+
+	// 构建配置：BuildTimeout 为一次构建（安装依赖、编译）的超时时间(秒)，与函数的超时时间无关
+	BuildTimeout     int
+	BuildConcurrency int // 同时执行的构建数
+
+	// 常驻实例：WarmIdleTimeout 为空闲实例保留的时间(秒)，0 表示每次调用都启动新进程；
+	// WarmMaxIdle 为每个函数（版本）保留的空闲实例数上限
+	WarmIdleTimeout int
+	WarmMaxIdle     int
+
+	// 密钥加密使用的主密钥；SecretsPreviousKeys 为轮换前的旧主密钥，仅用于解密
+	SecretsMasterKey    string
+	SecretsPreviousKeys []string
+	// SecretsFile 加密密钥的存储文件，必须位于函数目录之外；为空时使用函数目录旁的 secrets.json
+	SecretsFile string
+
+	// HostEnvAllowlist 允许传递给函数的宿主环境变量，支持 "PREFIX_*" 前缀匹配；默认不传递任何宿主变量
+	HostEnvAllowlist []string
+
+	// Sandbox 默认是否在 Linux 命名空间沙箱中运行函数，函数可通过 sandbox 字段单独覆盖
+	Sandbox bool
+}
+
+// DefaultOptions 返回默认的平台配置
+func DefaultOptions() Options {
+	return Options{
+		NameRedirectTTL: 7 * 24 * time.Hour,
+		EnabledRuntimes: []string{"go", "nodejs", "python", "js-embedded", "wasm", "custom"},
+		MaxCodeSize:     1024,
+		MaxTimeout:      900,
+		MinMemory:       64,
+		MaxMemory:       3072,
+		MaxPackageSize:  50,
+		MaxUnpackedSize: 250,
+		MaxPackageFiles: 10000,
+
+		BuildTimeout:     300,
+		BuildConcurrency: 2,
+
+		WarmIdleTimeout: 300,
+		WarmMaxIdle:     4,
+	}
+}
@@ -0,0 +1,848 @@
+package cloudfunction
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"debug/elf"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 代码包格式
+const (
+	PackageFormatZip    = "zip"
+	PackageFormatTarGz  = "tar.gz"
+	PackageFormatWasm   = "wasm"   // 直接上传的 WebAssembly 模块，解压为 function.wasm
+	PackageFormatBinary = "binary" // 直接上传的 Linux 可执行文件（预编译的Go函数），解压为 function
+)
+
+// uploadPackageRetries 上传代码包期间函数被其他请求修改时重新合并的次数
+const uploadPackageRetries = 3
+
+// ErrFunctionModified 函数在更新期间被其他请求修改
+var ErrFunctionModified = errors.New("函数在更新期间被其他请求修改，请重试")
+
+// packagePruneGrace 未被任何函数或版本引用的压缩包在删除前保留的时间，
+// 避免删除刚上传、尚未保存到函数上的代码包
+const packagePruneGrace = time.Hour
+
+// goPackageMainDir 代码包中生成的Go入口程序所在目录，以 _ 开头不会被 ./... 匹配
+const goPackageMainDir = "_fcmain"
+
+var (
+	pythonModuleHandlerPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)+$`)
+	nodeFileHandlerPattern     = regexp.MustCompile(`^[A-Za-z0-9_.@-]+(/[A-Za-z0-9_.@-]+)*\.[A-Za-z_$][A-Za-z0-9_$]*$`)
+	goPackageHandlerPattern    = regexp.MustCompile(`^([A-Za-z0-9_.-]+(/[A-Za-z0-9_.-]+)*\.)?[A-Z][A-Za-z0-9_]*$`)
+	goModulePattern            = regexp.MustCompile(`(?m)^module\s+"?([^\s"]+)"?`)
+)
+
+// CodePackage 函数的多文件代码包。压缩包按内容哈希保存在 workDir/packages 下，
+// 函数和已发布版本只保存元数据，执行时解压到各自的函数目录
+type CodePackage struct {
+	SHA256       string    `json:"sha256"`
+	Format       string    `json:"format"`        // zip 或 tar.gz
+	Size         int64     `json:"size"`          // 压缩包大小(字节)
+	UnpackedSize int64     `json:"unpacked_size"` // 解压后的总大小(字节)
+	Files        int       `json:"files"`         // 文件和目录数
+	UploadedAt   time.Time `json:"uploaded_at"`
+
+	data []byte // 未保存的代码包内容，只在校验试运行时设置
+}
+
+// packageLimits 解压代码包时的限制，0 表示不限制
+type packageLimits struct {
+	maxSize  int64
+	maxFiles int
+
+	// skipLinks 为 true 时忽略符号链接而不是报错，用于 node_modules 中的 .bin 链接
+	skipLinks bool
+}
+
+// InspectPackage 校验上传的代码包并返回代码包元数据，不保存压缩包；
+// 返回的代码包只在内存中保留内容，用于不部署的校验试运行。
+// 压缩包中的绝对路径、.. 路径、符号链接和特殊文件都会被拒绝
+func (p *Platform) InspectPackage(data []byte) (*CodePackage, error) {
+	if maxSize := p.options.MaxPackageSize * 1024 * 1024; maxSize > 0 && int64(len(data)) > maxSize {
+		return nil, newValidationError("代码包大小 %d 字节超过限制 %dMB", len(data), p.options.MaxPackageSize)
+	}
+	format := detectPackageFormat(data)
+	if format == "" {
+		return nil, newValidationError("无法识别的代码包格式，只支持 zip、tar.gz、WebAssembly 模块和 Linux 可执行文件")
+	}
+
+	sum := sha256.Sum256(data)
+	pkg := &CodePackage{
+		SHA256:     hex.EncodeToString(sum[:]),
+		Format:     format,
+		Size:       int64(len(data)),
+		UploadedAt: time.Now(),
+	}
+
+	// 先解压到临时目录，校验路径和大小并统计文件数
+	if err := os.MkdirAll(p.workDir, 0755); err != nil {
+		return nil, fmt.Errorf("创建工作目录失败: %v", err)
+	}
+	dir, err := os.MkdirTemp(p.workDir, ".check-")
+	if err != nil {
+		return nil, fmt.Errorf("创建检查目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	pkg.Files, pkg.UnpackedSize, err = extractPackage(bytes.NewReader(data), pkg.Size, format, dir, p.packageLimits())
+	if err != nil {
+		return nil, newValidationError("代码包无效: %v", err)
+	}
+	pkg.data = data
+	return pkg, nil
+}
+
+// StorePackage 校验并保存上传的代码包，返回代码包元数据
+func (p *Platform) StorePackage(data []byte) (*CodePackage, error) {
+	pkg, err := p.InspectPackage(data)
+	if err != nil {
+		return nil, err
+	}
+	pkg.data = nil
+
+	archive := p.packagePath(pkg)
+	if err := os.MkdirAll(filepath.Dir(archive), 0755); err != nil {
+		return nil, fmt.Errorf("创建代码包目录失败: %v", err)
+	}
+	if _, err := os.Stat(archive); err == nil {
+		// 相同内容的代码包已存在，刷新修改时间以免被清理
+		now := time.Now()
+		os.Chtimes(archive, now, now)
+		return pkg, nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(archive), ".upload-")
+	if err != nil {
+		return nil, fmt.Errorf("保存代码包失败: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("保存代码包失败: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("保存代码包失败: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), archive); err != nil {
+		return nil, fmt.Errorf("保存代码包失败: %v", err)
+	}
+	return pkg, nil
+}
+
+// UploadPackage 将函数的代码替换为上传的代码包，handler 不为空时同时修改入口。
+// 合并基于读取到的函数，保存时函数已被其他请求修改则重新读取并合并，不会覆盖其他修改
+func (p *Platform) UploadPackage(id string, data []byte, handler string) (*Function, error) {
+	if _, err := p.GetFunction(id); err != nil {
+		return nil, err
+	}
+
+	pkg, err := p.StorePackage(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var fn Function
+	for attempt := 0; ; attempt++ {
+		existing, err := p.GetFunction(id)
+		if err != nil {
+			return nil, err
+		}
+
+		fn = *existing
+		fn.Code = ""
+		fn.Package = pkg
+		if handler != "" {
+			fn.Handler = handler
+		} else if pkg.Format == PackageFormatWasm {
+			fn.Handler = wasmModuleFile
+		}
+		err = p.updateFunction(id, &fn, existing.UpdatedAt)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, ErrFunctionModified) || attempt == uploadPackageRetries {
+			return nil, err
+		}
+	}
+
+	p.mutex.Lock()
+	p.removeUnusedPackages()
+	p.mutex.Unlock()
+	return &fn, nil
+}
+
+// PackageArchive 返回函数当前代码包的压缩包路径
+func (p *Platform) PackageArchive(id string) (string, *CodePackage, error) {
+	fn, err := p.GetFunction(id)
+	if err != nil {
+		return "", nil, err
+	}
+	if fn.Package == nil {
+		return "", nil, fmt.Errorf("函数 %s 没有代码包", id)
+	}
+	return p.packagePath(fn.Package), fn.Package, nil
+}
+
+// packageLimits 返回配置的代码包解压限制
+func (p *Platform) packageLimits() packageLimits {
+	return packageLimits{
+		maxSize:  p.options.MaxUnpackedSize * 1024 * 1024,
+		maxFiles: p.options.MaxPackageFiles,
+	}
+}
+
+// packagePath 返回代码包压缩包的保存路径
+func (p *Platform) packagePath(pkg *CodePackage) string {
+	ext := ".zip"
+	switch pkg.Format {
+	case PackageFormatTarGz:
+		ext = ".tar.gz"
+	case PackageFormatWasm:
+		ext = ".wasm"
+	case PackageFormatBinary:
+		ext = ".bin"
+	}
+	return filepath.Join(p.workDir, "packages", pkg.SHA256+ext)
+}
+
+// packageDir 返回代码包在函数目录下的解压目录，按内容哈希区分
+func (p *Platform) packageDir(fn *Function) string {
+	return filepath.Join(p.functionDir(fn), "package", fn.Package.SHA256[:16])
+}
+
+// codeDir 返回函数进程的工作目录：代码包函数为解压后的代码包目录，否则为函数目录
+func (p *Platform) codeDir(fn *Function) string {
+	if fn.Package != nil {
+		return p.packageDir(fn)
+	}
+	return p.functionDir(fn)
+}
+
+// preparePackage 确保函数的代码包已解压，返回解压目录。返回的目录在调用方释放前不会被删除
+func (p *Platform) preparePackage(ctx context.Context, fn *Function) (string, error) {
+	dir := p.packageDir(fn)
+	// 先登记使用再检查目录，避免检查之后被其他调用当作旧目录删除
+	p.packageDirs.acquire(dir)
+	if _, err := os.Stat(dir); err == nil {
+		return dir, nil
+	}
+
+	var setup func(string) error
+	if fn.Runtime == "go" && !prebuiltBinary(fn) {
+		setup = func(tmp string) error { return p.ensureGoModule(ctx, tmp) }
+	}
+	if err := p.extractOnce(fn.Package, dir, setup); err != nil {
+		p.packageDirs.release(dir)
+		return "", err
+	}
+
+	// 清理旧代码包的解压目录，仍在使用的目录在最后一个调用结束后删除
+	parent := filepath.Dir(dir)
+	if entries, err := os.ReadDir(parent); err == nil {
+		for _, entry := range entries {
+			if name := entry.Name(); name != filepath.Base(dir) && !strings.HasPrefix(name, ".") {
+				p.packageDirs.retire(filepath.Join(parent, name))
+			}
+		}
+	}
+	return dir, nil
+}
+
+// dirRefs 目录的引用计数，不再需要的目录在没有使用者后删除
+type dirRefs struct {
+	mutex   sync.Mutex
+	counts  map[string]int
+	retired map[string]bool
+}
+
+func newDirRefs() *dirRefs {
+	return &dirRefs{counts: make(map[string]int), retired: make(map[string]bool)}
+}
+
+// acquire 登记一个目录的使用者，之前标记删除的目录重新使用时不再删除
+func (r *dirRefs) acquire(dir string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.counts[dir]++
+	delete(r.retired, dir)
+}
+
+// release 释放 acquire 登记的使用，最后一个使用者释放标记删除的目录时删除目录
+func (r *dirRefs) release(dir string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.counts[dir] == 0 {
+		return
+	}
+	if r.counts[dir]--; r.counts[dir] > 0 {
+		return
+	}
+	delete(r.counts, dir)
+	if r.retired[dir] {
+		delete(r.retired, dir)
+		os.RemoveAll(dir)
+	}
+}
+
+// retire 删除不再需要的目录，仍有使用者时推迟到最后一个使用者释放后
+func (r *dirRefs) retire(dir string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.counts[dir] > 0 {
+		r.retired[dir] = true
+		return
+	}
+	os.RemoveAll(dir)
+}
+
+// extractOnce 在 dir 不存在时将压缩包解压到 dir，setup 不为空时在解压后对目录做额外处理。
+// 先解压到临时目录再重命名，并发执行时不会看到解压了一半的目录
+func (p *Platform) extractOnce(pkg *CodePackage, dir string, setup func(string) error) error {
+	if _, err := os.Stat(dir); err == nil {
+		return nil
+	}
+
+	parent := filepath.Dir(dir)
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return fmt.Errorf("创建解压目录失败: %v", err)
+	}
+	tmp, err := os.MkdirTemp(parent, ".extract-")
+	if err != nil {
+		return fmt.Errorf("创建解压目录失败: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := p.extractStoredPackage(pkg, tmp); err != nil {
+		return err
+	}
+	if setup != nil {
+		if err := setup(tmp); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Rename(tmp, dir); err != nil {
+		// 其他调用已经完成解压
+		if _, statErr := os.Stat(dir); statErr == nil {
+			return nil
+		}
+		return fmt.Errorf("解压代码包失败: %v", err)
+	}
+	return nil
+}
+
+// extractStoredPackage 将已保存的代码包解压到 dest，试运行的代码包直接从内存解压
+func (p *Platform) extractStoredPackage(pkg *CodePackage, dest string) error {
+	if pkg.data != nil {
+		if _, _, err := extractPackage(bytes.NewReader(pkg.data), pkg.Size, pkg.Format, dest, p.packageLimits()); err != nil {
+			return fmt.Errorf("解压代码包失败: %v", err)
+		}
+		return nil
+	}
+
+	file, err := os.Open(p.packagePath(pkg))
+	if err != nil {
+		return fmt.Errorf("读取代码包失败: %v", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("读取代码包失败: %v", err)
+	}
+	if _, _, err := extractPackage(file, info.Size(), pkg.Format, dest, p.packageLimits()); err != nil {
+		return fmt.Errorf("解压代码包失败: %v", err)
+	}
+	return nil
+}
+
+// removeUnusedPackages 删除不再被任何函数、版本或层引用的压缩包，调用方需持有 p.mutex
+func (p *Platform) removeUnusedPackages() {
+	used := make(map[string]bool)
+	for _, layer := range p.layers {
+		for _, v := range layer.Versions {
+			used[filepath.Base(p.packagePath(v.Package))] = true
+		}
+	}
+	for _, fn := range p.functions {
+		if fn.Package != nil {
+			used[filepath.Base(p.packagePath(fn.Package))] = true
+		}
+		for _, v := range fn.Versions {
+			if v.Package != nil {
+				used[filepath.Base(p.packagePath(v.Package))] = true
+			}
+		}
+	}
+
+	dir := filepath.Join(p.workDir, "packages")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if used[entry.Name()] {
+			continue
+		}
+		if info, err := entry.Info(); err == nil && time.Since(info.ModTime()) > packagePruneGrace {
+			os.Remove(filepath.Join(dir, entry.Name()))
+		}
+	}
+}
+
+// detectPackageFormat 根据文件头识别压缩包格式
+func detectPackageFormat(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")), bytes.HasPrefix(data, []byte("PK\x05\x06")):
+		return PackageFormatZip
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		return PackageFormatTarGz
+	case bytes.HasPrefix(data, []byte("\x00asm")):
+		return PackageFormatWasm
+	case bytes.HasPrefix(data, []byte(elf.ELFMAG)):
+		return PackageFormatBinary
+	}
+	return ""
+}
+
+// packageExtractor 将压缩包条目写入目标目录，并检查路径和大小限制
+type packageExtractor struct {
+	dest   string
+	limits packageLimits
+	files  int
+	size   int64
+}
+
+// extractPackage 将 zip 或 tar.gz 压缩包解压到 dest，返回文件数和解压后的总大小
+func extractPackage(r io.ReaderAt, size int64, format, dest string, limits packageLimits) (int, int64, error) {
+	e := &packageExtractor{dest: dest, limits: limits}
+
+	switch format {
+	case PackageFormatZip:
+		reader, err := zip.NewReader(r, size)
+		if err != nil {
+			return 0, 0, fmt.Errorf("读取zip失败: %v", err)
+		}
+		for _, file := range reader.File {
+			if err := e.extractZipFile(file); err != nil {
+				return 0, 0, err
+			}
+		}
+	case PackageFormatTarGz:
+		gz, err := gzip.NewReader(io.NewSectionReader(r, 0, size))
+		if err != nil {
+			return 0, 0, fmt.Errorf("读取gzip失败: %v", err)
+		}
+		defer gz.Close()
+
+		reader := tar.NewReader(gz)
+		for {
+			header, err := reader.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return 0, 0, fmt.Errorf("读取tar失败: %v", err)
+			}
+			if err := e.extractTarEntry(header, reader); err != nil {
+				return 0, 0, err
+			}
+		}
+	case PackageFormatWasm:
+		if err := e.writeFile(wasmModuleFile, 0644, io.NewSectionReader(r, 0, size)); err != nil {
+			return 0, 0, err
+		}
+	case PackageFormatBinary:
+		if err := e.writeFile(prebuiltBinaryFile, 0755, io.NewSectionReader(r, 0, size)); err != nil {
+			return 0, 0, err
+		}
+	default:
+		return 0, 0, fmt.Errorf("不支持的代码包格式: %s", format)
+	}
+	return e.files, e.size, nil
+}
+
+// extractZipFile 解压 zip 中的一个条目
+func (e *packageExtractor) extractZipFile(file *zip.File) error {
+	mode := file.Mode()
+	switch {
+	case mode.IsDir():
+		return e.mkdir(file.Name)
+	case mode.IsRegular():
+		rc, err := file.Open()
+		if err != nil {
+			return fmt.Errorf("读取 %s 失败: %v", file.Name, err)
+		}
+		defer rc.Close()
+		return e.writeFile(file.Name, mode, rc)
+	case mode&os.ModeSymlink != 0 && e.limits.skipLinks:
+		return nil
+	}
+	return fmt.Errorf("不支持符号链接或特殊文件: %s", file.Name)
+}
+
+// extractTarEntry 解压 tar 中的一个条目
+func (e *packageExtractor) extractTarEntry(header *tar.Header, r io.Reader) error {
+	switch header.Typeflag {
+	case tar.TypeDir:
+		return e.mkdir(header.Name)
+	case tar.TypeReg:
+		return e.writeFile(header.Name, header.FileInfo().Mode(), r)
+	case tar.TypeXGlobalHeader:
+		return nil
+	case tar.TypeSymlink, tar.TypeLink:
+		if e.limits.skipLinks {
+			return nil
+		}
+	}
+	return fmt.Errorf("不支持符号链接或特殊文件: %s", header.Name)
+}
+
+// target 将条目名转换为目标目录下的路径，拒绝绝对路径和指向目录外的路径；
+// 返回空字符串表示条目就是根目录
+func (e *packageExtractor) target(name string) (string, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(name, "/") || strings.Contains(name, ":") {
+		return "", fmt.Errorf("代码包中不能包含绝对路径: %s", name)
+	}
+	clean := path.Clean(name)
+	if clean == "." {
+		return "", nil
+	}
+	if clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("代码包中的路径不能指向包外: %s", name)
+	}
+
+	e.files++
+	if e.limits.maxFiles > 0 && e.files > e.limits.maxFiles {
+		return "", fmt.Errorf("代码包中的文件数超过限制 %d", e.limits.maxFiles)
+	}
+	return filepath.Join(e.dest, filepath.FromSlash(clean)), nil
+}
+
+// mkdir 创建目录条目
+func (e *packageExtractor) mkdir(name string) error {
+	target, err := e.target(name)
+	if err != nil || target == "" {
+		return err
+	}
+	return os.MkdirAll(target, 0755)
+}
+
+// writeFile 写入普通文件条目，只保留可执行权限位
+func (e *packageExtractor) writeFile(name string, mode os.FileMode, r io.Reader) error {
+	target, err := e.target(name)
+	if err != nil {
+		return err
+	}
+	if target == "" {
+		return fmt.Errorf("无效的文件名: %s", name)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	perm := os.FileMode(0644)
+	if mode&0111 != 0 {
+		perm = 0755
+	}
+	file, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// 按实际写入的字节数计算大小，不信任压缩包头中记录的大小
+	var reader io.Reader = r
+	if e.limits.maxSize > 0 {
+		reader = io.LimitReader(r, e.limits.maxSize-e.size+1)
+	}
+	n, err := io.Copy(file, reader)
+	e.size += n
+	if err != nil {
+		return fmt.Errorf("解压 %s 失败: %v", name, err)
+	}
+	if e.limits.maxSize > 0 && e.size > e.limits.maxSize {
+		return fmt.Errorf("代码包解压后的大小超过限制 %dMB", e.limits.maxSize/1024/1024)
+	}
+	return nil
+}
+
+// validatePackageHandler 校验代码包函数的入口：
+// Python 为 模块.函数（模块可带包路径，如 app.handlers.main；函数可以是模块中对象的属性，如 app.service.handler.handle），
+// Node.js 为 文件.导出名（文件可带目录，如 lib/app.handler），
+// Go 为入口包中导出的函数名，入口包不在根目录时写作 目录.函数名（如 cmd/api.Handler），
+// wasm 为入口模块在代码包中的路径（如 bin/app.wasm），custom 为传给 bootstrap 的任意标识（如 app.handler）
+func validatePackageHandler(runtime, handler string) error {
+	var valid bool
+	switch runtime {
+	case "go":
+		valid = goPackageHandlerPattern.MatchString(handler)
+	case "nodejs":
+		file, export := splitHandler(handler)
+		valid = nodeFileHandlerPattern.MatchString(handler) && !javascriptReservedWords[export] && !hasDotDotSegment(file)
+	case "python":
+		valid = pythonModuleHandlerPattern.MatchString(handler)
+		for _, part := range strings.Split(handler, ".") {
+			valid = valid && !pythonReservedWords[part]
+		}
+	case "wasm":
+		valid = wasmHandlerPattern.MatchString(handler) && !hasDotDotSegment(handler)
+	case "custom":
+		valid = customHandlerPattern.MatchString(handler)
+	}
+	if !valid {
+		return newValidationError("无效的代码包入口: %q（%s运行时，格式见文档）", handler, runtime)
+	}
+	return nil
+}
+
+// splitHandler 按最后一个 . 拆分代码包入口，返回文件/模块/包路径和函数名
+func splitHandler(handler string) (string, string) {
+	if idx := strings.LastIndex(handler, "."); idx >= 0 {
+		return handler[:idx], handler[idx+1:]
+	}
+	return "", handler
+}
+
+// hasDotDotSegment 判断路径中是否有 .. 段
+func hasDotDotSegment(name string) bool {
+	for _, segment := range strings.Split(name, "/") {
+		if segment == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPackage 解压代码包，检查入口文件是否存在并对入口做编译/语法检查
+func (p *Platform) checkPackage(ctx context.Context, dir string, fn *Function, layers []*preparedLayer, compile bool) ([]Diagnostic, error) {
+	codeDir := filepath.Join(dir, "code")
+	if err := os.MkdirAll(codeDir, 0755); err != nil {
+		return nil, fmt.Errorf("创建检查目录失败: %v", err)
+	}
+	if err := p.extractStoredPackage(fn.Package, codeDir); err != nil {
+		return nil, newValidationError("%v", err)
+	}
+	if prebuiltBinary(fn) {
+		return checkELF(filepath.Join(codeDir, prebuiltBinaryFile), prebuiltBinaryFile, true), nil
+	}
+	if fn.Runtime == "go" && !compile {
+		// 部署时只检查入口包和入口函数签名，依赖在构建时下载
+		return p.checkGoPackage(ctx, codeDir, fn, layers, false)
+	}
+	if fn.Runtime == "go" {
+		if _, err := exec.LookPath("go"); err != nil {
+			return []Diagnostic{toolchainMissing("go")}, nil
+		}
+		if err := p.ensureGoModule(ctx, codeDir); err != nil {
+			return nil, err
+		}
+	}
+	// 部署时安装依赖，安装失败作为校验错误返回，成功的结果留在缓存中供构建和执行使用；
+	// 安装时间不受编译检查超时的限制，与构建使用相同的超时时间
+	installTimeout := time.Duration(p.options.BuildTimeout) * time.Second
+	installCtx, cancel := context.WithTimeout(context.Background(), installTimeout)
+	defer cancel()
+	if _, err := p.prepareDependencies(installCtx, fn, codeDir); err != nil {
+		if installCtx.Err() == context.DeadlineExceeded {
+			return nil, newValidationError("安装依赖超时（%v）", installTimeout)
+		}
+		return nil, newValidationError("%s", classifyError(err).Message)
+	}
+
+	switch fn.Runtime {
+	case "go":
+		return p.checkGoPackage(ctx, codeDir, fn, layers, true)
+	case "nodejs":
+		file, _ := splitHandler(fn.Handler)
+		entry := findNodeEntry(codeDir, file)
+		if entry == "" {
+			return nil, newValidationError("代码包中找不到入口文件: %s(.js/.mjs/.cjs/index.js)", file)
+		}
+		return checkNodeJSFile(ctx, filepath.Join(codeDir, entry), entry)
+	case "python":
+		module, _ := findPythonHandler(codeDir, fn.Handler)
+		if module == "" {
+			return nil, newValidationError("代码包中找不到入口模块: %s", fn.Handler)
+		}
+		entry := findPythonModule(codeDir, module)
+		return checkPythonFile(ctx, codeDir, filepath.Join(codeDir, entry), entry)
+	case "wasm":
+		entry := filepath.Join(codeDir, filepath.FromSlash(fn.Handler))
+		if info, err := os.Stat(entry); err != nil || !info.Mode().IsRegular() {
+			return nil, newValidationError("代码包中找不到入口模块: %s", fn.Handler)
+		}
+		return p.checkWasmModule(ctx, fn, entry)
+	case "custom":
+		return checkBootstrap(codeDir), nil
+	}
+	return nil, nil
+}
+
+// findNodeEntry 按 Node.js 的 require 规则查找入口文件（另外支持 .mjs），返回相对路径
+func findNodeEntry(dir, file string) string {
+	for _, candidate := range []string{file, file + ".js", file + ".mjs", file + ".cjs", file + "/index.js", file + "/index.mjs"} {
+		if info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(candidate))); err == nil && info.Mode().IsRegular() {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// findPythonModule 查找模块对应的源文件（模块文件或包的 __init__.py），返回相对路径
+func findPythonModule(dir, module string) string {
+	base := strings.ReplaceAll(module, ".", "/")
+	for _, candidate := range []string{base + ".py", base + "/__init__.py"} {
+		if info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(candidate))); err == nil && info.Mode().IsRegular() {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// findPythonHandler 将入口拆分为模块和模块中的属性路径，优先使用最长的存在的模块，
+// 如 app.service.Handler.handle 在 app/service.py 存在时拆分为 app.service 和 Handler.handle；
+// 找不到模块时返回空字符串
+func findPythonHandler(dir, handler string) (string, string) {
+	parts := strings.Split(handler, ".")
+	for i := len(parts) - 1; i >= 1; i-- {
+		if module := strings.Join(parts[:i], "."); findPythonModule(dir, module) != "" {
+			return module, strings.Join(parts[i:], ".")
+		}
+	}
+	return "", ""
+}
+
+// checkGoPackage 检查入口包和入口函数签名，compile 为 true 时再编译生成的入口程序
+func (p *Platform) checkGoPackage(ctx context.Context, dir string, fn *Function, layers []*preparedLayer, compile bool) ([]Diagnostic, error) {
+	pkgDir, _ := splitHandler(fn.Handler)
+	name, err := goPackageName(filepath.Join(dir, filepath.FromSlash(pkgDir)))
+	if err != nil {
+		return nil, newValidationError("%v", err)
+	}
+	if name == "main" {
+		return nil, newValidationError("入口包不能是 package main，请将 %s 放在可导入的包中", fn.Handler)
+	}
+	if err := checkGoPackageHandler(dir, fn.Handler); err != nil {
+		return nil, err
+	}
+	if !compile {
+		return nil, nil
+	}
+
+	if err := writeGoPackageMain(dir, fn.Handler); err != nil {
+		return nil, err
+	}
+	if err := p.useGoLayers(ctx, dir, layers); err != nil {
+		return nil, newValidationError("%s", classifyError(err).Message)
+	}
+
+	buildCmd := exec.CommandContext(ctx, "go", "build", "-o", os.DevNull, "./"+goPackageMainDir)
+	buildCmd.Dir = dir
+	buildCmd.Env = p.goBuildEnv(dir)
+	if output, err := combinedOutput(buildCmd); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("编译检查超时")
+		}
+		return parseGoDiagnostics(output, SeverityError), nil
+	}
+
+	vetCmd := exec.CommandContext(ctx, "go", "vet", "./...")
+	vetCmd.Dir = dir
+	vetCmd.Env = p.goBuildEnv(dir)
+	if output, err := combinedOutput(vetCmd); err != nil {
+		return parseGoDiagnostics(output, SeverityWarning), nil
+	}
+	return nil, nil
+}
+
+// goPackageName 读取目录中Go源文件的包名
+func goPackageName(dir string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", fmt.Errorf("代码包中找不到入口包目录: %s", filepath.Base(dir))
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(token.NewFileSet(), filepath.Join(dir, name), nil, parser.PackageClauseOnly)
+		if err != nil {
+			return "", fmt.Errorf("解析 %s 失败: %v", name, err)
+		}
+		return file.Name.Name, nil
+	}
+	return "", fmt.Errorf("入口包目录中没有Go源文件")
+}
+
+// ensureGoModule 代码包没有 go.mod 时初始化为名为 function 的模块
+func (p *Platform) ensureGoModule(ctx context.Context, dir string) error {
+	if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+		return nil
+	}
+	cmd := exec.CommandContext(ctx, runtimeBinary("go"), "mod", "init", "function")
+	cmd.Dir = dir
+	cmd.Env = p.goBuildEnv(dir)
+	if output, err := combinedOutput(cmd); err != nil {
+		return fmt.Errorf("初始化Go模块失败: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// goModulePath 读取 go.mod 中的模块路径
+func goModulePath(dir string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return "", fmt.Errorf("读取go.mod失败: %v", err)
+	}
+	match := goModulePattern.FindSubmatch(data)
+	if match == nil {
+		return "", fmt.Errorf("go.mod中没有module声明")
+	}
+	return string(match[1]), nil
+}
+
+// writeGoPackageMain 在代码包中生成导入入口包并调用入口函数的 main 程序
+func writeGoPackageMain(dir, handler string) error {
+	modulePath, err := goModulePath(dir)
+	if err != nil {
+		return err
+	}
+	pkgDir, name := splitHandler(handler)
+	importPath := modulePath
+	if pkgDir != "" {
+		importPath = modulePath + "/" + pkgDir
+	}
+
+	mainDir := filepath.Join(dir, goPackageMainDir)
+	if err := os.MkdirAll(mainDir, 0755); err != nil {
+		return fmt.Errorf("创建入口程序目录失败: %v", err)
+	}
+	source := goWrapperSource(fmt.Sprintf("\thandler %q\n", importPath), "", "handler."+name)
+	if err := os.WriteFile(filepath.Join(mainDir, "main.go"), []byte(source), 0644); err != nil {
+		return fmt.Errorf("写入入口程序失败: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,304 @@
+package cloudfunction
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// packageEntry 测试压缩包中的一个条目
+type packageEntry struct {
+	name    string
+	body    string
+	symlink string      // 不为空时条目是指向该目标的符号链接
+	mode    os.FileMode // 文件权限，默认 0644
+}
+
+func (e packageEntry) fileMode() os.FileMode {
+	if e.mode == 0 {
+		return 0644
+	}
+	return e.mode
+}
+
+func buildZip(t *testing.T, entries []packageEntry) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	w := zip.NewWriter(buf)
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.name, Method: zip.Deflate}
+		body := entry.body
+		if entry.symlink != "" {
+			header.SetMode(os.ModeSymlink | 0777)
+			body = entry.symlink
+		} else {
+			header.SetMode(entry.fileMode())
+		}
+		f, err := w.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func buildTarGz(t *testing.T, entries []packageEntry) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	w := tar.NewWriter(gz)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Mode: int64(entry.fileMode()), Size: int64(len(entry.body)), Typeflag: tar.TypeReg}
+		if entry.symlink != "" {
+			header.Typeflag = tar.TypeSymlink
+			header.Linkname = entry.symlink
+			header.Size = 0
+		}
+		if err := w.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if entry.symlink == "" {
+			if _, err := w.Write([]byte(entry.body)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractPackage(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []packageEntry
+		limits  packageLimits
+		files   int
+		size    int64
+		wantErr string
+	}{
+		{
+			name:    "普通文件",
+			entries: []packageEntry{{name: "main.py", body: "print(1)"}, {name: "lib/util.py", body: "x = 1"}},
+			files:   2,
+			size:    13,
+		},
+		{
+			name:    "上级目录",
+			entries: []packageEntry{{name: "../evil.py", body: "x"}},
+			wantErr: "指向包外",
+		},
+		{
+			name:    "中间的上级目录",
+			entries: []packageEntry{{name: "lib/../../evil.py", body: "x"}},
+			wantErr: "指向包外",
+		},
+		{
+			name:    "绝对路径",
+			entries: []packageEntry{{name: "/etc/passwd", body: "x"}},
+			wantErr: "绝对路径",
+		},
+		{
+			name:    "盘符路径",
+			entries: []packageEntry{{name: "C:/windows/evil.py", body: "x"}},
+			wantErr: "绝对路径",
+		},
+		{
+			name:    "反斜杠盘符路径",
+			entries: []packageEntry{{name: `C:\windows\evil.py`, body: "x"}},
+			wantErr: "绝对路径",
+		},
+		{
+			name:    "符号链接",
+			entries: []packageEntry{{name: "link", symlink: "/etc/passwd"}},
+			wantErr: "符号链接",
+		},
+		{
+			name:    "跳过符号链接",
+			entries: []packageEntry{{name: "main.py", body: "x"}, {name: "link", symlink: "main.py"}},
+			limits:  packageLimits{skipLinks: true},
+			files:   1,
+			size:    1,
+		},
+		{
+			name:    "超过解压大小",
+			entries: []packageEntry{{name: "big.txt", body: strings.Repeat("x", 100)}},
+			limits:  packageLimits{maxSize: 10},
+			wantErr: "超过限制",
+		},
+		{
+			name:    "超过文件数",
+			entries: []packageEntry{{name: "a", body: "1"}, {name: "b", body: "2"}, {name: "c", body: "3"}},
+			limits:  packageLimits{maxFiles: 2},
+			wantErr: "文件数超过限制",
+		},
+	}
+
+	formats := []struct {
+		format string
+		build  func(*testing.T, []packageEntry) []byte
+	}{
+		{PackageFormatZip, buildZip},
+		{PackageFormatTarGz, buildTarGz},
+	}
+
+	for _, format := range formats {
+		for _, tt := range tests {
+			t.Run(format.format+"/"+tt.name, func(t *testing.T) {
+				data := format.build(t, tt.entries)
+				if got := detectPackageFormat(data); got != format.format {
+					t.Fatalf("detectPackageFormat = %q, want %q", got, format.format)
+				}
+
+				root := t.TempDir()
+				dest := filepath.Join(root, "dest")
+				if err := os.Mkdir(dest, 0755); err != nil {
+					t.Fatal(err)
+				}
+				files, size, err := extractPackage(bytes.NewReader(data), int64(len(data)), format.format, dest, tt.limits)
+
+				if tt.wantErr != "" {
+					if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+						t.Fatalf("err = %v, want containing %q", err, tt.wantErr)
+					}
+					if _, err := os.Stat(filepath.Join(root, "evil.py")); err == nil {
+						t.Fatal("文件被写到了解压目录之外")
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if files != tt.files || size != tt.size {
+					t.Fatalf("got %d files, %d bytes; want %d files, %d bytes", files, size, tt.files, tt.size)
+				}
+				for _, entry := range tt.entries {
+					if entry.symlink != "" {
+						if _, err := os.Lstat(filepath.Join(dest, entry.name)); err == nil {
+							t.Fatalf("符号链接 %s 不应被解压", entry.name)
+						}
+						continue
+					}
+					data, err := os.ReadFile(filepath.Join(dest, filepath.FromSlash(entry.name)))
+					if err != nil || string(data) != entry.body {
+						t.Fatalf("%s = %q, %v; want %q", entry.name, data, err, entry.body)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestUploadPackageRunsModuleHandler(t *testing.T) {
+	requireTool(t, "python3")
+	p := newTestPlatform(t)
+	fn := &Function{Name: "packaged", Runtime: "python", Handler: "handler", Code: "def handler(e, c):\n    return 0\n", Timeout: 10, Memory: 128}
+	if err := p.CreateFunction(fn); err != nil {
+		t.Fatal(err)
+	}
+
+	data := buildZip(t, []packageEntry{
+		{name: "app/__init__.py"},
+		{name: "app/handlers.py", body: "from app import util\n\ndef main(event, context):\n    return util.double(event['n'])\n"},
+		{name: "app/util.py", body: "def double(n):\n    return n * 2\n"},
+	})
+	if _, err := p.UploadPackage(fn.ID, data, "app.handler-name"); err == nil {
+		t.Fatal("无效的入口应返回错误")
+	}
+	updated, err := p.UploadPackage(fn.ID, data, "app.handlers.main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Code != "" || updated.Package.Files != 3 {
+		t.Fatalf("代码包元数据 = %+v", updated.Package)
+	}
+
+	waitForBuilds(t, p)
+	resp, err := p.ExecuteFunction(fn.ID, &ExecuteRequest{Event: map[string]interface{}{"n": 21}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := json.Marshal(resp.Result); !resp.Success || string(got) != "42" {
+		t.Fatalf("resp = %+v", resp)
+	}
+
+	archive, _, err := p.PackageArchive(fn.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(archive); err != nil {
+		t.Fatalf("PackageArchive = %q, %v", archive, err)
+	}
+}
+
+func TestOldPackageDirKeptWhileInUse(t *testing.T) {
+	requireTool(t, "python3")
+	p := newTestPlatform(t)
+	fn := &Function{Name: "in-use", Runtime: "python", Handler: "handler", Code: "def handler(e, c):\n    return 0\n", Timeout: 10, Memory: 128}
+	if err := p.CreateFunction(fn); err != nil {
+		t.Fatal(err)
+	}
+
+	// 旧代码包在调用进行中才读取包内的文件
+	slow := buildZip(t, []packageEntry{
+		{name: "main.py", body: "import time\n\ndef handler(event, context):\n    time.sleep(1.5)\n    with open('data.txt') as f:\n        return f.read()\n"},
+		{name: "data.txt", body: "old"},
+	})
+	if _, err := p.UploadPackage(fn.ID, slow, "main.handler"); err != nil {
+		t.Fatal(err)
+	}
+	waitForBuilds(t, p)
+	old, err := p.GetFunction(fn.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldDir := p.packageDir(old)
+
+	done := make(chan *ExecuteResponse, 1)
+	go func() {
+		resp, err := p.ExecuteFunction(fn.ID, &ExecuteRequest{})
+		if err != nil {
+			resp = &ExecuteResponse{Error: err.Error()}
+		}
+		done <- resp
+	}()
+	time.Sleep(300 * time.Millisecond)
+
+	// 上传新代码包并执行，解压新目录时旧目录仍在使用
+	data := buildZip(t, []packageEntry{{name: "main.py", body: "def handler(event, context):\n    return 'new'\n"}})
+	if _, err := p.UploadPackage(fn.ID, data, "main.handler"); err != nil {
+		t.Fatal(err)
+	}
+	waitForBuilds(t, p)
+	if resp, err := p.ExecuteFunction(fn.ID, &ExecuteRequest{}); err != nil || resp.Result != "new" {
+		t.Fatalf("resp = %+v, %v", resp, err)
+	}
+	if !fileExists(oldDir) {
+		t.Fatal("正在使用的旧代码包目录被删除")
+	}
+
+	if resp := <-done; !resp.Success || resp.Result != "old" {
+		t.Fatalf("旧代码包的调用 = %+v", resp)
+	}
+	// 最后一个调用结束后删除旧目录
+	if fileExists(oldDir) {
+		t.Fatal("旧代码包目录在调用结束后没有被删除")
+	}
+}
@@ -6,22 +6,40 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
 	"sync"
 	"time"
+
+	"github.com/tetratelabs/wazero"
 )
 
 // Function 表示一个云函数
 type Function struct {
 	ID          string            `json:"id"`
-	Name        string            `json:"name"`
-	Runtime     string            `json:"runtime"`     // go, nodejs, python
-	Code        string            `json:"code"`        // 函数代码
-	Handler     string            `json:"handler"`     // 入口函数
-	Environment map[string]string `json:"environment"` // 环境变量
-	Timeout     int               `json:"timeout"`     // 超时时间(秒)
-	Memory      int               `json:"memory"`      // 内存限制(MB)
+	Name        string            `json:"name"`               // 命名空间内唯一
+	Namespace   string            `json:"namespace"`          // 命名空间
+	Runtime     string            `json:"runtime"`            // go, nodejs, python
+	Code        string            `json:"code"`               // 函数代码
+	Package     *CodePackage      `json:"package,omitempty"`  // 多文件代码包，设置时不使用 Code
+	Layers      []LayerRef        `json:"layers,omitempty"`   // 引用的层，按顺序加入模块搜索路径
+	BuildID     string            `json:"build_id,omitempty"` // 当前代码使用的构建
+	Handler     string            `json:"handler"`            // 入口函数
+	Environment map[string]string `json:"environment"`        // 环境变量
+	Labels      map[string]string `json:"labels,omitempty"`   // 标签，用于列表过滤
+	Timeout     int               `json:"timeout"`            // 超时时间(秒)
+	Memory      int               `json:"memory"`             // 内存限制(MB)
+	Sandbox     *bool             `json:"sandbox,omitempty"`  // 是否在沙箱中运行，未设置时使用全局配置
+	Network     *NetworkPolicy    `json:"network,omitempty"`  // 网络出口策略
 	CreatedAt   time.Time         `json:"created_at"`
 	UpdatedAt   time.Time         `json:"updated_at"`
+
+	Versions []*FunctionVersion `json:"versions,omitempty"` // 已发布的不可变版本
+	Aliases  map[string]*Alias  `json:"aliases,omitempty"`  // 指向版本的别名
+
+	PreviousNames []NameRedirect `json:"previous_names,omitempty"` // 重命名前的旧名称
+
+	version int    // 执行时使用的版本号，0表示当前代码
+	alias   string // 通过别名调用时的别名名称
 }
 
 // ExecuteRequest 函数执行请求
@@ -32,31 +50,82 @@ type ExecuteRequest struct {
 
 // ExecuteResponse 函数执行响应
 type ExecuteResponse struct {
+	RequestID  string      `json:"request_id"`
 	Success    bool        `json:"success"`
 	Result     interface{} `json:"result"`
 	Error      string      `json:"error,omitempty"`
-	Duration   int64       `json:"duration"` // 执行时间(毫秒)
+	ErrorType  string      `json:"error_type,omitempty"` // 错误类型：validation、build、timeout、oom、handler、bad_output、platform
+	Stack      string      `json:"stack,omitempty"`      // 用户代码的异常堆栈或进程的错误输出
+	Duration   int64       `json:"duration"`             // 执行时间(毫秒)
 	MemoryUsed int         `json:"memory_used,omitempty"`
+	Version    int         `json:"version,omitempty"` // 实际执行的版本，0表示当前代码
+
+	NetworkViolations []string `json:"network_violations,omitempty"` // 被网络策略拒绝的访问目标
 }
 
 // Platform 云函数平台
 type Platform struct {
-	functions map[string]*Function
-	workDir   string
-	dataFile  string // 数据持久化文件路径
-	mutex     sync.RWMutex
+	functions  map[string]*Function
+	names      map[string]nameEntry // 命名空间/名称 -> 函数ID 索引
+	layers     map[string]*Layer    // 层名称 -> 层，与函数共用 mutex
+	workDir    string
+	dataFile   string // 数据持久化文件路径
+	layersFile string // 层数据持久化文件路径
+	options    Options
+	secrets    *SecretStore
+	mutex      sync.RWMutex
+
+	depsMutex sync.Mutex // 串行安装代码包依赖
+
+	builds      map[string]*Build // 构建ID -> 构建记录
+	buildsMutex sync.Mutex
+	buildSlots  chan struct{} // 限制同时执行的构建数
+
+	warm        *warmPool               // 空闲的常驻函数实例
+	wasmCache   wazero.CompilationCache // wasm 模块的编译结果
+	packageDirs *dirRefs                // 正在使用的代码包解压目录
 }
 
-// NewPlatform 创建新的云函数平台
+// NewPlatform 使用默认配置创建新的云函数平台
 func NewPlatform(workDir string) *Platform {
+	return NewPlatformWithOptions(workDir, DefaultOptions())
+}
+
+// NewPlatformWithOptions 创建新的云函数平台
+func NewPlatformWithOptions(workDir string, options Options) *Platform {
+	// 函数进程的工作目录不一定是函数目录，统一使用绝对路径
+	if abs, err := filepath.Abs(workDir); err == nil {
+		workDir = abs
+	}
 	platform := &Platform{
-		functions: make(map[string]*Function),
-		workDir:   workDir,
-		dataFile:  filepath.Join(workDir, "functions.json"),
+		functions:   make(map[string]*Function),
+		names:       make(map[string]nameEntry),
+		layers:      make(map[string]*Layer),
+		workDir:     workDir,
+		dataFile:    filepath.Join(workDir, "functions.json"),
+		layersFile:  filepath.Join(workDir, "layers.json"),
+		options:     options,
+		builds:      make(map[string]*Build),
+		buildSlots:  make(chan struct{}, max(options.BuildConcurrency, 1)),
+		warm:        newWarmPool(),
+		wasmCache:   newWasmCompilationCache(workDir),
+		packageDirs: newDirRefs(),
 	}
 
-	// 尝试从文件加载现有函数
+	// 初始化密钥存储，加载失败时禁用密钥功能以免覆盖已有数据
+	secrets, err := NewSecretStore(platform.migrateSecretsFile(), options.SecretsMasterKey, options.SecretsPreviousKeys)
+	if err != nil {
+		Error("初始化密钥存储失败，密钥功能已禁用: %v", err)
+		secrets = &SecretStore{keys: map[string][]byte{}, secrets: map[string]*storedSecret{}}
+	}
+	platform.secrets = secrets
+
+	// 尝试从文件加载现有函数和层
 	platform.loadFromFile()
+	if err := platform.loadLayers(); err != nil {
+		Error("加载层失败: %v", err)
+	}
+	platform.loadBuilds()
 
 	return platform
 }
@@ -79,20 +148,35 @@ func (p *Platform) loadFromFile() error {
 		return nil
 	}
 
-	var functions []*Function
-	if err := json.Unmarshal(data, &functions); err != nil {
-		return fmt.Errorf("解析数据文件失败: %v", err)
+	functions, err := decodeFunctions(data)
+	if err != nil {
+		return err
 	}
 
 	// 将函数加载到内存
 	for _, fn := range functions {
 		p.functions[fn.ID] = fn
 	}
+	p.indexNames()
 
 	fmt.Printf("从文件加载了 %d 个函数\n", len(functions))
 	return nil
 }
 
+// decodeFunctions 解析数据文件中的函数记录；命名空间功能之前保存的函数没有命名空间，归入默认命名空间
+func decodeFunctions(data []byte) ([]*Function, error) {
+	var functions []*Function
+	if err := json.Unmarshal(data, &functions); err != nil {
+		return nil, fmt.Errorf("解析数据文件失败: %v", err)
+	}
+	for _, fn := range functions {
+		if fn.Namespace == "" {
+			fn.Namespace = DefaultNamespace
+		}
+	}
+	return functions, nil
+}
+
 // saveToFile 将函数列表保存到JSON文件
 func (p *Platform) saveToFile() error {
 	// 确保目录存在
@@ -119,12 +203,39 @@ func (p *Platform) saveToFile() error {
 
 // CreateFunction 创建新函数
 func (p *Platform) CreateFunction(fn *Function) error {
+	if fn.Namespace == "" {
+		fn.Namespace = DefaultNamespace
+	}
+	if err := validateNamespace(fn.Namespace); err != nil {
+		return err
+	}
+	if err := validateFunctionName(fn.Name); err != nil {
+		return err
+	}
+	if err := validateLabels(fn.Labels); err != nil {
+		return err
+	}
+	// 部署前校验配置并检查代码语法，避免错误拖到首次调用才暴露；Go代码的编译错误由构建报告
+	if err := p.validateDeployment(fn); err != nil {
+		return err
+	}
+
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 
+	if err := p.checkNameAvailable(fn.Namespace, fn.Name, ""); err != nil {
+		return err
+	}
+	// 密钥的删除在同一把锁内检查引用，这里重新检查以免引用校验之后被删除的密钥
+	if err := p.validateSecretRefs(fn.Environment); err != nil {
+		return err
+	}
+
 	fn.ID = generateID()
 	fn.CreatedAt = time.Now()
 	fn.UpdatedAt = time.Now()
+	build := newBuild(fn)
+	fn.BuildID = build.ID
 
 	// 创建函数工作目录
 	fnDir := filepath.Join(p.workDir, fn.ID)
@@ -138,15 +249,18 @@ func (p *Platform) CreateFunction(fn *Function) error {
 	}
 
 	p.functions[fn.ID] = fn
+	p.indexNames()
 
 	// 持久化到文件
 	if err := p.saveToFile(); err != nil {
 		// 如果持久化失败，回滚内存操作
 		delete(p.functions, fn.ID)
+		p.indexNames()
 		os.RemoveAll(fnDir)
 		return fmt.Errorf("持久化函数失败: %v", err)
 	}
 
+	p.startBuild(fn, build)
 	return nil
 }
 
@@ -162,7 +276,7 @@ func (p *Platform) GetFunction(id string) (*Function, error) {
 	return fn, nil
 }
 
-// ListFunctions 列出所有函数
+// ListFunctions 按创建时间顺序列出所有函数
 func (p *Platform) ListFunctions() []*Function {
 	p.mutex.RLock()
 	defer p.mutex.RUnlock()
@@ -171,11 +285,22 @@ func (p *Platform) ListFunctions() []*Function {
 	for _, fn := range p.functions {
 		functions = append(functions, fn)
 	}
+	sortFunctionsByCreated(functions)
 	return functions
 }
 
 // UpdateFunction 更新函数
 func (p *Platform) UpdateFunction(id string, fn *Function) error {
+	return p.updateFunction(id, fn, time.Time{})
+}
+
+// updateFunction 更新函数；revision 不为零时，函数的更新时间与之不同（校验期间被其他请求修改）
+// 返回 ErrFunctionModified，用于基于读取到的函数做修改的调用方
+func (p *Platform) updateFunction(id string, fn *Function, revision time.Time) error {
+	if err := p.validateDeployment(fn); err != nil {
+		return err
+	}
+
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 
@@ -183,6 +308,17 @@ func (p *Platform) UpdateFunction(id string, fn *Function) error {
 	if !exists {
 		return fmt.Errorf("函数不存在: %s", id)
 	}
+	if !revision.IsZero() && !existing.UpdatedAt.Equal(revision) {
+		return ErrFunctionModified
+	}
+	// 密钥的删除在同一把锁内检查引用，这里重新检查以免引用校验之后被删除的密钥
+	if err := p.validateSecretRefs(fn.Environment); err != nil {
+		return err
+	}
+
+	if err := validateLabels(fn.Labels); err != nil {
+		return err
+	}
 
 	// 备份原函数用于回滚
 	backup := *existing
@@ -191,19 +327,50 @@ func (p *Platform) UpdateFunction(id string, fn *Function) error {
 	fn.CreatedAt = existing.CreatedAt
 	fn.UpdatedAt = time.Now()
 
+	// 已发布的版本和别名不随代码更新而改变
+	fn.Versions = existing.Versions
+	fn.Aliases = existing.Aliases
+
+	// 命名空间不可修改；重命名时保留旧名称作为跳转
+	fn.Namespace = existing.Namespace
+	fn.PreviousNames = existing.PreviousNames
+	if fn.Name != existing.Name {
+		if err := validateFunctionName(fn.Name); err != nil {
+			return err
+		}
+		if err := p.checkNameAvailable(fn.Namespace, fn.Name, id); err != nil {
+			return err
+		}
+		fn.PreviousNames = p.renameRedirects(existing, fn.Name)
+	}
+
+	// 构建输入变化或上次构建失败时重新构建，只修改配置时沿用原来的构建
+	var build *Build
+	fn.BuildID = existing.BuildID
+	if p.needsBuild(existing, fn) {
+		build = newBuild(fn)
+		fn.BuildID = build.ID
+	}
+
 	if err := p.saveFunction(fn); err != nil {
 		return fmt.Errorf("保存函数失败: %v", err)
 	}
 
 	p.functions[id] = fn
+	p.indexNames()
 
 	// 持久化到文件
 	if err := p.saveToFile(); err != nil {
 		// 如果持久化失败，回滚
 		p.functions[id] = &backup
+		p.indexNames()
 		return fmt.Errorf("持久化函数失败: %v", err)
 	}
 
+	p.warm.evict(id)
+	if build != nil {
+		p.startBuild(fn, build)
+	}
 	return nil
 }
 
@@ -227,68 +394,123 @@ func (p *Platform) DeleteFunction(id string) error {
 	}
 
 	delete(p.functions, id)
+	p.indexNames()
 
 	// 持久化到文件
 	if err := p.saveToFile(); err != nil {
 		// 如果持久化失败，回滚
 		p.functions[id] = &backup
+		p.indexNames()
 		// 尝试恢复目录（尽力而为）
 		os.MkdirAll(fnDir, 0755)
 		p.saveFunction(&backup)
 		return fmt.Errorf("持久化删除操作失败: %v", err)
 	}
 
+	p.warm.evict(id)
+	p.removeUnusedPackages()
+	p.forgetBuilds(id)
+	GlobalMetrics.ForgetFunction(id)
 	return nil
 }
 
-// ExecuteFunction 执行函数
+// ExecuteFunction 执行函数，id 可带版本号或别名限定符，如 fn_xxx:3、fn_xxx:prod
 func (p *Platform) ExecuteFunction(id string, req *ExecuteRequest) (*ExecuteResponse, error) {
-	fn, err := p.GetFunction(id)
+	fn, err := p.resolveFunction(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// 构建成功前拒绝调用
+	build, err := p.readyBuild(fn)
 	if err != nil {
 		return nil, err
 	}
 
-	startTime := time.Now()
+	inv := newInvocation(fn, req)
+	inv.build = build
+	defer inv.release(p)
+	startTime := inv.startTime
+
+	// 密钥只在执行时解密注入，执行结果中出现的密钥值会被脱敏
+	environment, secretValues, err := p.resolveEnvironment(fn.Environment)
+	inv.secrets = secretValues
+	execFn := *fn
+	execFn.Environment = environment
+	fn = &execFn
 
 	// 根据运行时执行函数
 	var result interface{}
 	var execErr error
 
-	switch fn.Runtime {
-	case "go":
-		result, execErr = p.executeGoFunction(fn, req)
-	case "nodejs":
-		result, execErr = p.executeNodeJSFunction(fn, req)
-	case "python":
-		result, execErr = p.executePythonFunction(fn, req)
+	switch {
+	case err != nil:
+		execErr = newExecutionError(ErrorTypeValidation, "解析环境变量失败: %v", err)
+	case !p.runtimeEnabled(fn.Runtime):
+		execErr = newExecutionError(ErrorTypeValidation, "不支持或未启用的运行时: %s", fn.Runtime)
 	default:
-		execErr = fmt.Errorf("不支持的运行时: %s", fn.Runtime)
+		if err := os.MkdirAll(p.functionDir(fn), 0755); err != nil {
+			execErr = newExecutionError(ErrorTypePlatform, "创建函数目录失败: %v", err)
+			break
+		}
+		switch fn.Runtime {
+		case "go":
+			result, execErr = p.executeGoFunction(fn, inv)
+		case "nodejs":
+			result, execErr = p.executeNodeJSFunction(fn, inv)
+		case "python":
+			result, execErr = p.executePythonFunction(fn, inv)
+		case "js-embedded":
+			result, execErr = p.executeEmbeddedJSFunction(fn, inv)
+		case "wasm":
+			result, execErr = p.executeWasmFunction(fn, inv)
+		case "custom":
+			result, execErr = p.executeCustomFunction(fn, inv)
+		}
 	}
 
 	duration := time.Since(startTime).Milliseconds()
 
 	response := &ExecuteResponse{
-		Success:  execErr == nil,
-		Result:   result,
-		Duration: duration,
+		RequestID: inv.requestID,
+		Success:   execErr == nil,
+		Result:    redactValue(result, secretValues),
+		Duration:  duration,
+		Version:   fn.version,
+
+		NetworkViolations: inv.networkViolations(),
 	}
 
 	if execErr != nil {
-		response.Error = execErr.Error()
+		typed := classifyError(execErr)
+		response.Error = redactString(typed.Message, secretValues)
+		response.ErrorType = typed.Type
+		response.Stack = redactString(typed.Stack, secretValues)
+	}
+
+	// 按运行时和版本统计执行结果，通过别名调用时检查金丝雀版本
+	GlobalMetrics.RecordExecution(fn.Runtime, time.Since(startTime), response.Success, response.ErrorType)
+	GlobalMetrics.RecordRevision(fn.ID, fn.version, time.Since(startTime), response.Success)
+	if fn.alias != "" {
+		GlobalMetrics.RecordAliasRevision(fn.ID, fn.alias, fn.version, time.Since(startTime), response.Success)
+		p.checkCanary(fn.ID, fn.alias, fn.version)
 	}
 
 	return response, nil
 }
 
-// saveFunction 保存函数代码到文件
+// saveFunction 保存函数代码到文件，代码包函数的代码在执行时从代码包解压
 func (p *Platform) saveFunction(fn *Function) error {
 	fnDir := filepath.Join(p.workDir, fn.ID)
+	if fn.Package != nil {
+		return nil
+	}
 
 	var filename string
 	switch fn.Runtime {
 	case "go":
 		filename = "main.go"
-	case "nodejs":
+	case "nodejs", "js-embedded":
 		filename = "index.js"
 	case "python":
 		filename = "main.py"
@@ -300,6 +522,15 @@ func (p *Platform) saveFunction(fn *Function) error {
 	return ioutil.WriteFile(filepath, []byte(fn.Code), 0644)
 }
 
+// functionDir 返回函数执行所用的目录，已发布版本使用各自独立的子目录
+func (p *Platform) functionDir(fn *Function) string {
+	dir := filepath.Join(p.workDir, fn.ID)
+	if fn.version > 0 {
+		return filepath.Join(dir, "versions", strconv.Itoa(fn.version))
+	}
+	return dir
+}
+
 // generateID 生成唯一ID
 func generateID() string {
 	return fmt.Sprintf("fn_%d", time.Now().UnixNano())
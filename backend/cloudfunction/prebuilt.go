@@ -0,0 +1,89 @@
+package cloudfunction
+
+import (
+	"debug/elf"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// 预编译的Go函数：代码包是静态链接的 Linux 可执行文件，部署时只检查 ELF 文件头，
+// 构建时复制为函数的构建产物，不执行 go build。可执行文件按生成的Go入口程序的协议处理调用
+
+// prebuiltBinaryFile 直接上传的可执行文件在代码包中的文件名
+const prebuiltBinaryFile = "function"
+
+// elfMachines 宿主机架构对应的 ELF 机器类型
+var elfMachines = map[string]elf.Machine{
+	"amd64":   elf.EM_X86_64,
+	"386":     elf.EM_386,
+	"arm64":   elf.EM_AARCH64,
+	"arm":     elf.EM_ARM,
+	"riscv64": elf.EM_RISCV,
+	"ppc64le": elf.EM_PPC64,
+	"s390x":   elf.EM_S390,
+	"loong64": elf.EM_LOONGARCH,
+}
+
+// prebuiltBinary 判断函数是否使用上传的可执行文件而不是Go源码
+func prebuiltBinary(fn *Function) bool {
+	return fn.Runtime == "go" && fn.Package != nil && fn.Package.Format == PackageFormatBinary
+}
+
+// checkELF 检查可执行文件能否在宿主机上运行：Linux 可执行文件，架构与平台相同；
+// static 为 true 时要求静态链接（没有动态链接器）
+func checkELF(path, name string, static bool) []Diagnostic {
+	file, err := elf.Open(path)
+	if err != nil {
+		return elfDiagnostics(name, "不是有效的 ELF 可执行文件: %v", err)
+	}
+	defer file.Close()
+
+	if runtime.GOOS != "linux" {
+		return elfDiagnostics(name, "平台运行在 %s 上，不能执行 Linux 可执行文件", runtime.GOOS)
+	}
+	if file.OSABI != elf.ELFOSABI_NONE && file.OSABI != elf.ELFOSABI_LINUX {
+		return elfDiagnostics(name, "不是 Linux 可执行文件（OS ABI 为 %v）", file.OSABI)
+	}
+	if file.Type != elf.ET_EXEC && file.Type != elf.ET_DYN {
+		return elfDiagnostics(name, "不是可执行文件（类型为 %v）", file.Type)
+	}
+	if machine, ok := elfMachines[runtime.GOARCH]; !ok || file.Machine != machine {
+		return elfDiagnostics(name, "可执行文件的架构 %v 与平台的架构 %s 不符，请使用 GOARCH=%[2]s 编译", file.Machine, runtime.GOARCH)
+	}
+	if static {
+		for _, prog := range file.Progs {
+			if prog.Type == elf.PT_INTERP {
+				return elfDiagnostics(name, "可执行文件是动态链接的，请使用 CGO_ENABLED=0 编译为静态链接的程序")
+			}
+		}
+	}
+	return nil
+}
+
+// elfDiagnostics 创建指向可执行文件的错误诊断
+func elfDiagnostics(file, format string, args ...interface{}) []Diagnostic {
+	return []Diagnostic{{File: file, Severity: SeverityError, Message: fmt.Sprintf(format, args...)}}
+}
+
+// installPrebuiltBinary 将代码包中的可执行文件复制到 output，由构建发布为构建产物
+func installPrebuiltBinary(fn *Function, dir, output string, log *buildLog) error {
+	log.step("使用上传的可执行文件（%s，%d 字节），跳过编译", fn.Package.SHA256[:16], fn.Package.Size)
+
+	src, err := os.Open(filepath.Join(dir, prebuiltBinaryFile))
+	if err != nil {
+		return fmt.Errorf("读取可执行文件失败: %v", err)
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return fmt.Errorf("创建构建产物失败: %v", err)
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return fmt.Errorf("复制可执行文件失败: %v", err)
+	}
+	return dst.Close()
+}
@@ -0,0 +1,157 @@
+package cloudfunction
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// prebuiltProgram 实现Go入口程序调用协议的独立程序
+const prebuiltProgram = `package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+func main() {
+	var event map[string]interface{}
+	json.Unmarshal([]byte(os.Getenv("FUNCTION_EVENT")), &event)
+	fmt.Println("prebuilt log")
+	if event["fail"] == true {
+		fmt.Println(` + "`" + `{"success": false, "error": "失败了", "error_type": "handler"}` + "`" + `)
+		os.Exit(1)
+	}
+	out, _ := json.Marshal(map[string]interface{}{"success": true, "result": map[string]interface{}{"handler": os.Getenv("FC_HANDLER"), "n": event["n"]}})
+	fmt.Println(string(out))
+}
+`
+
+// buildPrebuiltBinary 编译静态链接的测试程序
+func buildPrebuiltBinary(t *testing.T) []byte {
+	t.Helper()
+	requireTool(t, "go")
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte(prebuiltProgram), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module prebuilt\n\ngo 1.21\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(runtimeBinary("go"), "build", "-o", "function", ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "CGO_ENABLED=0", "GOFLAGS=-mod=mod")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("编译测试程序失败: %v\n%s", err, output)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "function"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestCheckELF(t *testing.T) {
+	text := filepath.Join(t.TempDir(), "text")
+	if err := os.WriteFile(text, []byte("#!/bin/sh\necho hi\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if diags := checkELF(text, "function", true); len(diags) != 1 || !strings.Contains(diags[0].Message, "不是有效的 ELF") {
+		t.Errorf("脚本文件的诊断 = %+v", diags)
+	}
+
+	// 系统自带的命令通常是动态链接的
+	dynamic, err := exec.LookPath("ls")
+	if err != nil {
+		t.Skip("找不到 ls")
+	}
+	if diags := checkELF(dynamic, "function", false); diags != nil {
+		t.Errorf("不要求静态链接时 %s 应通过检查: %+v", dynamic, diags)
+	}
+	if diags := checkELF(dynamic, "function", true); len(diags) == 0 {
+		t.Skipf("%s 是静态链接的", dynamic)
+	} else if diags[0].File != "function" || !strings.Contains(diags[0].Message, "动态链接") {
+		t.Errorf("动态链接的诊断 = %+v", diags)
+	}
+}
+
+func TestPrebuiltGoFunction(t *testing.T) {
+	binary := buildPrebuiltBinary(t)
+	p := newTestPlatform(t)
+	fn := &Function{Name: "prebuilt", Runtime: "go", Handler: "Handler", Timeout: 20, Memory: 128,
+		Code: "package main\n\nfunc Handler(event map[string]interface{}) (interface{}, error) {\n\treturn nil, nil\n}\n"}
+	if err := p.CreateFunction(fn); err != nil {
+		t.Fatal(err)
+	}
+	waitForBuilds(t, p)
+
+	updated, err := p.UploadPackage(fn.ID, binary, "orders.Create")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Package.Format != PackageFormatBinary {
+		t.Fatalf("代码包格式 = %q", updated.Package.Format)
+	}
+	waitForBuilds(t, p)
+	build, err := p.GetBuild(fn.ID, updated.BuildID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if build.State != BuildReady || !strings.Contains(build.Output, "跳过编译") {
+		t.Fatalf("构建 = %s: %s\n%s", build.State, build.Error, build.Output)
+	}
+
+	resp, err := p.ExecuteFunction(fn.ID, &ExecuteRequest{Event: map[string]interface{}{"n": 7}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := json.Marshal(resp.Result)
+	if !resp.Success || string(got) != `{"handler":"orders.Create","n":7}` {
+		t.Fatalf("resp = %+v, result = %s", resp, got)
+	}
+	resp, err = p.ExecuteFunction(fn.ID, &ExecuteRequest{Event: map[string]interface{}{"fail": true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Success || resp.Error != "失败了" || resp.ErrorType != ErrorTypeHandler {
+		t.Fatalf("失败的调用 = %+v", resp)
+	}
+}
+
+func TestPrebuiltBinaryRejected(t *testing.T) {
+	binary := buildPrebuiltBinary(t)
+	requireTool(t, "python3")
+	p := newTestPlatform(t)
+	fn := &Function{Name: "not-go", Runtime: "python", Handler: "handler", Code: "def handler(e, c):\n    return 0\n", Timeout: 10, Memory: 128}
+	if err := p.CreateFunction(fn); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.UploadPackage(fn.ID, binary, "handler"); err == nil {
+		t.Error("python 函数不应接受可执行文件")
+	}
+
+	dynamic, err := exec.LookPath("ls")
+	if err != nil {
+		return
+	}
+	if diags := checkELF(dynamic, prebuiltBinaryFile, true); len(diags) == 0 {
+		return
+	}
+	data, err := os.ReadFile(dynamic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	goFn := &Function{Name: "dynamic", Runtime: "go", Handler: "Handler", Timeout: 10, Memory: 128,
+		Code: "package main\n\nfunc Handler(event map[string]interface{}) (interface{}, error) {\n\treturn nil, nil\n}\n"}
+	if err := p.CreateFunction(goFn); err != nil {
+		t.Fatal(err)
+	}
+	waitForBuilds(t, p)
+	if _, err := p.UploadPackage(goFn.ID, data, "Handler"); err == nil || !strings.Contains(err.Error(), "动态链接") {
+		t.Errorf("动态链接的可执行文件应被拒绝: %v", err)
+	}
+}
@@ -0,0 +1,148 @@
+package cloudfunction
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// processGracePeriod 超时后从 SIGTERM 到 SIGKILL 的宽限期
+const processGracePeriod = 2 * time.Second
+
+// processReapTimeout 清理进程组中残留进程的最长等待时间
+const processReapTimeout = 5 * time.Second
+
+// maxStderrSize 函数进程错误输出保留的最大长度
+const maxStderrSize = 64 * 1024
+
+// maxStdoutSize 函数进程标准输出（日志和结果信封）的大小上限
+const maxStdoutSize = 6 << 20
+
+// tailBuffer 只保留最后 limit 字节的输出
+type tailBuffer struct {
+	limit int
+	data  []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.data = append(b.data, p...)
+	if len(b.data) > b.limit {
+		b.data = append(b.data[:0], b.data[len(b.data)-b.limit:]...)
+	}
+	return len(p), nil
+}
+
+// cappedBuffer 超过上限后丢弃写入的数据并记录溢出
+type cappedBuffer struct {
+	limit    int
+	data     bytes.Buffer
+	overflow bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if b.data.Len()+len(p) > b.limit {
+		b.overflow = true
+		return len(p), nil
+	}
+	return b.data.Write(p)
+}
+
+// setProcessGroup 让命令在独立的进程组中运行；ctx 结束时向整个进程组发送 SIGTERM，
+// 宽限期后主进程仍未退出时收到 SIGKILL，主进程退出后由 startCommand 杀死进程组中残留的进程
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+
+	cmd.Cancel = func() error {
+		if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM); err != nil {
+			return err
+		}
+		// 主进程被回收后进程组ID可能被复用，宽限期后只通过 Process 杀死主进程
+		time.AfterFunc(processGracePeriod, func() {
+			cmd.Process.Kill()
+		})
+		return nil
+	}
+	// 子进程继承了标准输出时，宽限期后不再等待输出关闭
+	cmd.WaitDelay = processGracePeriod + time.Second
+}
+
+// startCommand 在独立的进程组中启动命令。返回的 wait 等待命令结束：主进程退出后、被回收之前
+// 杀死进程组中残留的进程（此时进程组ID不会被复用），然后回收过继给本进程的僵尸进程
+func startCommand(cmd *exec.Cmd) (func() error, error) {
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	pgid := cmd.Process.Pid
+	return func() error {
+		if waitExited(pgid) {
+			syscall.Kill(-pgid, syscall.SIGKILL)
+		}
+		err := cmd.Wait()
+		go reapProcessGroup(pgid)
+		return err
+	}, nil
+}
+
+// runCommand 在独立的进程组中运行命令，返回标准输出和错误输出的末尾部分。
+// 命令结束时杀死进程组中残留的进程并回收僵尸进程；因超时结束时返回 timeout 类型的错误，
+// 标准输出超过 maxStdoutSize 时返回 bad_output 类型的错误
+func runCommand(ctx context.Context, cmd *exec.Cmd, timeout time.Duration) ([]byte, []byte, error) {
+	stdout := &cappedBuffer{limit: maxStdoutSize}
+	stderr := &tailBuffer{limit: maxStderrSize}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	wait, err := startCommand(cmd)
+	if err == nil {
+		err = wait()
+	}
+
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return stdout.data.Bytes(), stderr.data, &ExecutionError{
+			Type:    ErrorTypeTimeout,
+			Message: fmt.Sprintf("执行超时（%v）", timeout),
+		}
+	}
+	if stdout.overflow {
+		return nil, stderr.data, newExecutionError(ErrorTypeBadOutput, "函数输出超过 %dMB", maxStdoutSize>>20)
+	}
+	return stdout.data.Bytes(), stderr.data, err
+}
+
+// combinedOutput 与 runCommand 相同，但返回合并的标准输出和错误输出，用于编译器、语法检查等工具
+func combinedOutput(cmd *exec.Cmd) ([]byte, error) {
+	output := &bytes.Buffer{}
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	wait, err := startCommand(cmd)
+	if err != nil {
+		return nil, err
+	}
+	err = wait()
+	return output.Bytes(), err
+}
+
+// reapProcessGroup 回收进程组中已成为本进程子进程的僵尸进程
+// （服务作为容器的 1 号进程运行时，孤儿进程会被过继给服务进程）
+func reapProcessGroup(pgid int) {
+	deadline := time.Now().Add(processReapTimeout)
+	for time.Now().Before(deadline) {
+		pid, err := syscall.Wait4(-pgid, nil, syscall.WNOHANG, nil)
+		if pid > 0 {
+			continue
+		}
+		if err == syscall.ECHILD && syscall.Kill(-pgid, 0) == syscall.ESRCH {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
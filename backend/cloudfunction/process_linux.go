@@ -0,0 +1,16 @@
+//go:build linux
+
+package cloudfunction
+
+import "golang.org/x/sys/unix"
+
+// waitExited 阻塞到进程退出，但不回收进程，之后仍由 cmd.Wait 回收
+func waitExited(pid int) bool {
+	var info unix.Siginfo
+	for {
+		err := unix.Waitid(unix.P_PID, pid, &info, unix.WEXITED|unix.WNOWAIT, nil)
+		if err != unix.EINTR {
+			return err == nil
+		}
+	}
+}
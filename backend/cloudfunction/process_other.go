@@ -0,0 +1,8 @@
+//go:build !linux
+
+package cloudfunction
+
+// waitExited 其他平台无法在不回收的情况下等待进程退出，不杀死残留进程，由 ctx 结束时的进程组信号处理
+func waitExited(pid int) bool {
+	return false
+}
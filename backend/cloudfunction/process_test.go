@@ -0,0 +1,128 @@
+package cloudfunction
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// processGone 等待进程退出并被回收，或已成为僵尸进程
+func processGone(pid int, wait time.Duration) bool {
+	deadline := time.Now().Add(wait)
+	for time.Now().Before(deadline) {
+		if syscall.Kill(pid, 0) == syscall.ESRCH {
+			return true
+		}
+		if stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat"); err == nil {
+			if fields := strings.Fields(string(stat)); len(fields) > 2 && fields[2] == "Z" {
+				return true
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return false
+}
+
+func TestRunCommandTimeoutKillsProcessGroup(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "child.pid")
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	// 后台进程不持有标准输出，主进程退出后仍会继续运行
+	cmd := exec.CommandContext(ctx, "sh", "-c", "sleep 60 >/dev/null 2>&1 & echo $! > "+pidFile+"; wait")
+	start := time.Now()
+	_, _, err := runCommand(ctx, cmd, 300*time.Millisecond)
+	if got := classifyError(err).Type; got != ErrorTypeTimeout {
+		t.Fatalf("err = %v (%s), want timeout", err, got)
+	}
+	if elapsed := time.Since(start); elapsed > processGracePeriod {
+		t.Fatalf("超时后 %v 才返回", elapsed)
+	}
+
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	if !processGone(pid, 2*time.Second) {
+		syscall.Kill(pid, syscall.SIGKILL)
+		t.Fatalf("进程组中的子进程 %d 在超时后仍在运行", pid)
+	}
+}
+
+func TestRunCommandKillsProcessIgnoringSIGTERM(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", "trap '' TERM; sleep 60")
+	start := time.Now()
+	_, _, err := runCommand(ctx, cmd, 200*time.Millisecond)
+	if got := classifyError(err).Type; got != ErrorTypeTimeout {
+		t.Fatalf("err = %v (%s), want timeout", err, got)
+	}
+	// 忽略 SIGTERM 的进程在宽限期后被 SIGKILL 终止
+	if elapsed := time.Since(start); elapsed < processGracePeriod || elapsed > processGracePeriod+2*time.Second {
+		t.Fatalf("进程在 %v 后结束, want 约 %v", elapsed, processGracePeriod)
+	}
+}
+
+func TestFunctionTimeoutKillsChildProcesses(t *testing.T) {
+	requireTool(t, "python3")
+	pidFile := filepath.Join(t.TempDir(), "child.pid")
+
+	p := newTestPlatform(t)
+	fn := &Function{Name: "spawner", Runtime: "python", Handler: "handler", Timeout: 1, Memory: 128,
+		Code: `import subprocess, time
+
+def handler(event, context):
+    child = subprocess.Popen(["sleep", "60"], stdout=subprocess.DEVNULL, stderr=subprocess.DEVNULL)
+    with open(event["pid_file"], "w") as f:
+        f.write(str(child.pid))
+    time.sleep(60)
+`}
+	if err := p.CreateFunction(fn); err != nil {
+		t.Fatal(err)
+	}
+
+	waitForBuilds(t, p)
+	resp, err := p.ExecuteFunction(fn.ID, &ExecuteRequest{Event: map[string]interface{}{"pid_file": pidFile}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Success || resp.ErrorType != ErrorTypeTimeout {
+		t.Fatalf("resp = %+v, want timeout", resp)
+	}
+
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	if !processGone(pid, 2*time.Second) {
+		syscall.Kill(pid, syscall.SIGKILL)
+		t.Fatalf("函数创建的子进程 %d 在超时后仍在运行", pid)
+	}
+}
+
+func TestRunCommandCapsStdout(t *testing.T) {
+	ctx := context.Background()
+	cmd := exec.CommandContext(ctx, "sh", "-c", "head -c "+strconv.Itoa(maxStdoutSize+1)+" /dev/zero; echo done >&2")
+	stdout, stderr, err := runCommand(ctx, cmd, time.Minute)
+	if got := classifyError(err).Type; got != ErrorTypeBadOutput {
+		t.Fatalf("err = %v (%s), want bad_output", err, got)
+	}
+	if stdout != nil || strings.TrimSpace(string(stderr)) != "done" {
+		t.Fatalf("stdout = %d 字节, stderr = %q", len(stdout), stderr)
+	}
+
+	cmd = exec.CommandContext(ctx, "sh", "-c", "head -c "+strconv.Itoa(maxStdoutSize)+" /dev/zero")
+	if stdout, _, err := runCommand(ctx, cmd, time.Minute); err != nil || len(stdout) != maxStdoutSize {
+		t.Fatalf("未超过上限的输出: %d 字节, %v", len(stdout), err)
+	}
+}
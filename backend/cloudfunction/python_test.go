@@ -0,0 +1,133 @@
+package cloudfunction
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func newPythonFunction(name, handler, code string) *Function {
+	return &Function{Name: name, Runtime: "python", Handler: handler, Code: code, Timeout: 10, Memory: 128}
+}
+
+func TestPythonHandlerForms(t *testing.T) {
+	requireTool(t, "python3")
+	p := newTestPlatform(t)
+
+	async := newPythonFunction("py-async", "handler", `import asyncio
+
+async def double(n):
+    await asyncio.sleep(0.01)
+    return n * 2
+
+async def handler(event, context):
+    print("日志不影响返回值")
+    return await asyncio.gather(double(event["n"]), double(event["n"] + 1))
+`)
+	attribute := newPythonFunction("py-attribute", "service.handle", `class Service:
+    prefix = "svc"
+
+    def handle(self, event, context):
+        return self.prefix + ":" + str(event["n"])
+
+service = Service()
+`)
+
+	for fn, want := range map[*Function]string{async: "[2,4]", attribute: `"svc:1"`} {
+		if err := p.CreateFunction(fn); err != nil {
+			t.Fatal(err)
+		}
+		waitForBuilds(t, p)
+		resp, err := p.ExecuteFunction(fn.ID, &ExecuteRequest{Event: map[string]interface{}{"n": 1}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := json.Marshal(resp.Result); !resp.Success || string(got) != want {
+			t.Errorf("%s: resp = %+v, result = %s, want %s", fn.Name, resp, got, want)
+		}
+	}
+}
+
+// callCount 调用计数函数并返回模块级计数器的值
+func callCount(t *testing.T, p *Platform, id string) float64 {
+	t.Helper()
+	resp, err := p.ExecuteFunction(id, &ExecuteRequest{Event: map[string]interface{}{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, ok := resp.Result.(float64)
+	if !resp.Success || !ok {
+		t.Fatalf("resp = %+v", resp)
+	}
+	return count
+}
+
+const pythonCounterCode = `import time
+
+calls = 0
+
+def handler(event, context):
+    global calls
+    calls += 1
+    if event.get("sleep"):
+        time.sleep(event["sleep"])
+    return calls
+`
+
+func TestPythonWarmInstanceReuse(t *testing.T) {
+	requireTool(t, "python3")
+	p := newTestPlatform(t)
+	fn := newPythonFunction("py-warm", "handler", pythonCounterCode)
+	fn.Timeout = 1
+	if err := p.CreateFunction(fn); err != nil {
+		t.Fatal(err)
+	}
+	waitForBuilds(t, p)
+
+	// 模块级状态在同一实例的调用之间保留
+	for want := 1.0; want <= 3; want++ {
+		if got := callCount(t, p, fn.ID); got != want {
+			t.Fatalf("第%v次调用计数 = %v", want, got)
+		}
+	}
+
+	// 超时的实例被丢弃，下一次调用启动新实例
+	resp, err := p.ExecuteFunction(fn.ID, &ExecuteRequest{Event: map[string]interface{}{"sleep": 5}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ErrorType != ErrorTypeTimeout {
+		t.Fatalf("resp = %+v, want timeout", resp)
+	}
+	if got := callCount(t, p, fn.ID); got != 1 {
+		t.Fatalf("超时后计数 = %v, want 新实例", got)
+	}
+
+	// 更新函数后不再复用旧实例
+	update := newPythonFunction("py-warm", "handler", pythonCounterCode+"\n# v2\n")
+	update.Timeout = 1
+	if err := p.UpdateFunction(fn.ID, update); err != nil {
+		t.Fatal(err)
+	}
+	waitForBuilds(t, p)
+	if got := callCount(t, p, fn.ID); got != 1 {
+		t.Fatalf("更新后计数 = %v, want 新实例", got)
+	}
+}
+
+func TestPythonWarmInstancesDisabled(t *testing.T) {
+	requireTool(t, "python3")
+	options := DefaultOptions()
+	options.WarmIdleTimeout = 0
+	p := newTestPlatformWithOptions(t, options)
+	fn := newPythonFunction("py-cold", "handler", pythonCounterCode)
+	if err := p.CreateFunction(fn); err != nil {
+		t.Fatal(err)
+	}
+	waitForBuilds(t, p)
+
+	for i := 0; i < 2; i++ {
+		if got := callCount(t, p, fn.ID); got != 1 {
+			t.Fatalf("禁用常驻实例时计数 = %v, want 1", got)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package cloudfunction
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// sandboxInitArg 沙箱初始化进程的 argv[0]。
+// 服务进程以该参数重新执行自身，在新的命名空间内搭建根文件系统后再 exec 函数进程
+const sandboxInitArg = "fc-sandbox-init"
+
+// sandboxInitExitCode 沙箱初始化失败时的退出码
+const sandboxInitExitCode = 125
+
+// sandboxSystemPaths 沙箱内只读挂载的系统目录
+var sandboxSystemPaths = []string{
+	"/usr", "/bin", "/sbin", "/lib", "/lib32", "/lib64", "/libx32",
+}
+
+// sandboxEtcPaths 沙箱内只读挂载的 /etc 文件，不挂载整个 /etc 以免暴露 shadow 等敏感文件
+var sandboxEtcPaths = []string{
+	"/etc/ld.so.cache", "/etc/ld.so.conf", "/etc/ld.so.conf.d",
+	"/etc/passwd", "/etc/group", "/etc/nsswitch.conf", "/etc/hosts", "/etc/resolv.conf",
+	"/etc/localtime", "/etc/ssl", "/etc/pki", "/etc/ca-certificates", "/etc/alternatives",
+}
+
+// sandboxSpec 传给沙箱初始化进程的配置
+type sandboxSpec struct {
+	Path string `json:"path"` // 要执行的程序
+
+	// Filesystem 为 true 时使用独立的挂载、PID、IPC 命名空间和只读根文件系统；
+	// 为 false 时只按网络模式隔离网络
+	Filesystem bool     `json:"filesystem"`
+	Root       string   `json:"root,omitempty"`     // 新根文件系统的挂载点，每个沙箱在自己的挂载命名空间内挂载 tmpfs
+	Dir        string   `json:"dir,omitempty"`      // 函数目录，在沙箱内以相同路径只读挂载
+	WorkDir    string   `json:"work_dir,omitempty"` // 工作目录，位于函数目录内
+	Mounts     []string `json:"mounts,omitempty"`   // 只读挂载的宿主路径
+	TmpSize    int      `json:"tmp_size,omitempty"` // 私有 /tmp 的大小(MB)
+
+	Network   string `json:"network"`              // 网络模式，unrestricted 表示使用宿主网络
+	ProxyPort int    `json:"proxy_port,omitempty"` // allowlist 模式下出口代理在命名空间内监听的端口
+}
+
+// sandboxEnabled 判断函数是否在沙箱中运行：函数配置优先，未配置时使用全局配置
+func (p *Platform) sandboxEnabled(fn *Function) bool {
+	if fn.Sandbox != nil {
+		return *fn.Sandbox
+	}
+	return p.options.Sandbox
+}
+
+// newCommand 创建运行函数的命令。所有运行时都通过它启动函数进程，
+// 以便统一设置工作目录、环境变量，并按配置将进程放入沙箱和隔离网络。
+// allowlist 网络模式的出口代理在 ctx 结束时关闭
+func (p *Platform) newCommand(ctx context.Context, fn *Function, inv *invocation, name string, args ...string) (*exec.Cmd, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = p.codeDir(fn)
+	cmd.Env = p.functionEnv(fn, inv)
+
+	network := p.networkMode(fn)
+	if !p.sandboxEnabled(fn) && network == NetworkUnrestricted {
+		return cmd, nil
+	}
+
+	spec := &sandboxSpec{Path: cmd.Path, Network: network}
+	if p.sandboxEnabled(fn) {
+		if err := p.sandboxFilesystem(cmd, fn, inv, spec); err != nil {
+			return nil, err
+		}
+	}
+
+	if network == NetworkAllowlist {
+		spec.ProxyPort = egressProxyPort
+		cmd.Env = append(cmd.Env, proxyEnv()...)
+		listeners, err := attachEgressListener(ctx, cmd)
+		if err != nil {
+			return nil, err
+		}
+		go p.serveEgressProxy(ctx, fn, inv, listeners)
+	}
+
+	if err := sandboxCommand(cmd, spec); err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
+
+// sandboxFilesystem 填写沙箱根文件系统的配置
+func (p *Platform) sandboxFilesystem(cmd *exec.Cmd, fn *Function, inv *invocation, spec *sandboxSpec) error {
+	// 沙箱内按相同路径挂载，工作目录为函数目录或其中的代码包目录
+	root := filepath.Join(p.workDir, ".sandbox")
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return err
+	}
+
+	spec.Filesystem = true
+	spec.Root = root
+	spec.Dir = p.functionDir(fn)
+	spec.WorkDir = cmd.Dir
+	spec.Mounts = sandboxMounts(fn.Runtime)
+	if inv.deps != nil {
+		spec.Mounts = append(spec.Mounts, inv.deps.Dir)
+	}
+	for _, layer := range inv.layers {
+		spec.Mounts = append(spec.Mounts, layer.Dir)
+	}
+	spec.TmpSize = fn.Memory
+
+	// 沙箱内的 /tmp 是私有的 tmpfs
+	cmd.Env = append(cmd.Env, "TMPDIR=/tmp")
+	return nil
+}
+
+// sandboxMounts 返回沙箱内只读挂载的宿主路径：系统目录、必要的 /etc 文件，
+// 以及不在系统目录下的运行时安装目录（如 pyenv 安装的 Python）
+func sandboxMounts(runtime string) []string {
+	mounts := append(append([]string(nil), sandboxSystemPaths...), sandboxEtcPaths...)
+
+	for _, name := range runtimeBinaryNames(runtime) {
+		path := runtimeBinary(name)
+		if !filepath.IsAbs(path) || underSandboxPaths(path, mounts) {
+			continue
+		}
+		// 可执行文件位于 <prefix>/bin 下，挂载整个安装前缀以包含标准库和动态库
+		mounts = append(mounts, filepath.Dir(filepath.Dir(path)))
+	}
+	return mounts
+}
+
+// underSandboxPaths 判断路径是否位于已挂载的目录下
+func underSandboxPaths(path string, mounts []string) bool {
+	for _, mount := range mounts {
+		if path == mount || strings.HasPrefix(path, mount+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,533 @@
+//go:build linux
+
+package cloudfunction
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// sandboxFilesystemFlags 文件系统沙箱使用的命名空间：挂载、PID 和 IPC
+const sandboxFilesystemFlags = syscall.CLONE_NEWNS | syscall.CLONE_NEWPID | syscall.CLONE_NEWIPC
+
+// egressListenerFd 沙箱初始化进程回传出口代理监听套接字使用的文件描述符
+const egressListenerFd = 3
+
+// seccompArch 各架构的 seccomp 审计架构标识
+var seccompArch = map[string]uint32{
+	"amd64": unix.AUDIT_ARCH_X86_64,
+	"arm64": unix.AUDIT_ARCH_AARCH64,
+}
+
+// seccompDenied 沙箱内禁止的系统调用，调用时返回 EPERM
+var seccompDenied = []uint32{
+	unix.SYS_MOUNT, unix.SYS_UMOUNT2, unix.SYS_PIVOT_ROOT, unix.SYS_CHROOT,
+	unix.SYS_OPEN_TREE, unix.SYS_MOVE_MOUNT, unix.SYS_FSOPEN, unix.SYS_FSCONFIG,
+	unix.SYS_FSMOUNT, unix.SYS_FSPICK, unix.SYS_MOUNT_SETATTR,
+	unix.SYS_UNSHARE, unix.SYS_SETNS,
+	unix.SYS_PTRACE, unix.SYS_PROCESS_VM_READV, unix.SYS_PROCESS_VM_WRITEV,
+	unix.SYS_KEXEC_LOAD, unix.SYS_KEXEC_FILE_LOAD, unix.SYS_REBOOT,
+	unix.SYS_INIT_MODULE, unix.SYS_FINIT_MODULE, unix.SYS_DELETE_MODULE,
+	unix.SYS_SWAPON, unix.SYS_SWAPOFF, unix.SYS_ACCT, unix.SYS_QUOTACTL,
+	unix.SYS_BPF, unix.SYS_PERF_EVENT_OPEN, unix.SYS_USERFAULTFD,
+	unix.SYS_KEYCTL, unix.SYS_ADD_KEY, unix.SYS_REQUEST_KEY,
+	unix.SYS_OPEN_BY_HANDLE_AT, unix.SYS_NAME_TO_HANDLE_AT,
+	unix.SYS_SETTIMEOFDAY, unix.SYS_CLOCK_SETTIME, unix.SYS_CLOCK_ADJTIME, unix.SYS_ADJTIMEX,
+	unix.SYS_SETHOSTNAME, unix.SYS_SETDOMAINNAME,
+}
+
+// seccompCloneNamespaces 禁止通过 clone 创建的命名空间
+const seccompCloneNamespaces = unix.CLONE_NEWUSER | unix.CLONE_NEWNS | unix.CLONE_NEWPID |
+	unix.CLONE_NEWIPC | unix.CLONE_NEWNET | unix.CLONE_NEWUTS | unix.CLONE_NEWCGROUP
+
+// sandboxDevices 沙箱 /dev 中从宿主绑定的设备文件
+var sandboxDevices = []string{"null", "zero", "full", "random", "urandom"}
+
+var sandboxProbe struct {
+	once sync.Once
+	err  error
+}
+
+func init() {
+	if len(os.Args) > 0 && os.Args[0] == sandboxInitArg {
+		runSandboxInit()
+	}
+}
+
+// SandboxAvailable 检查当前主机能否创建函数沙箱。
+// 实际启动一次沙箱初始化进程，结果会被缓存
+func SandboxAvailable() error {
+	sandboxProbe.once.Do(func() {
+		root, err := os.MkdirTemp("", "fc-sandbox-probe-")
+		if err != nil {
+			sandboxProbe.err = err
+			return
+		}
+		defer os.RemoveAll(root)
+
+		cmd := &exec.Cmd{}
+		spec := &sandboxSpec{Filesystem: true, Root: root, Dir: "/", WorkDir: "/", Mounts: sandboxSystemPaths, TmpSize: 1, Network: NetworkLoopback}
+		if err := sandboxCommand(cmd, spec); err != nil {
+			sandboxProbe.err = err
+			return
+		}
+		if output, err := cmd.CombinedOutput(); err != nil {
+			sandboxProbe.err = fmt.Errorf("%v %s", err, output)
+		}
+	})
+	return sandboxProbe.err
+}
+
+// sandboxCommand 将命令改写为先启动沙箱初始化进程，由它在新的命名空间中 exec 原命令
+func sandboxCommand(cmd *exec.Cmd, spec *sandboxSpec) error {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return err
+	}
+
+	cmd.Args = append([]string{sandboxInitArg, string(data)}, cmd.Args...)
+	cmd.Path = "/proc/self/exe"
+
+	attr := cmd.SysProcAttr
+	if attr == nil {
+		attr = &syscall.SysProcAttr{}
+	}
+	attr.Cloneflags |= syscall.CLONE_NEWUSER
+	if spec.Filesystem {
+		attr.Cloneflags |= sandboxFilesystemFlags
+	}
+	if spec.Network != NetworkUnrestricted {
+		attr.Cloneflags |= syscall.CLONE_NEWNET
+	}
+	// 沙箱内的 root 映射为服务进程自身的用户，不获得宿主上的额外权限
+	attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}}
+	attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}}
+	attr.GidMappingsEnableSetgroups = false
+	attr.Pdeathsig = syscall.SIGKILL
+	cmd.SysProcAttr = attr
+	return nil
+}
+
+// attachEgressListener 为命令附加一个 socketpair，沙箱初始化进程通过它把在函数网络命名空间内
+// 创建的出口代理监听套接字传回服务进程。返回的 channel 收到监听器后关闭；ctx 结束时释放 socketpair
+func attachEgressListener(ctx context.Context, cmd *exec.Cmd) (<-chan net.Listener, error) {
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("创建出口代理通道失败: %v", err)
+	}
+	// 服务进程一端使用非阻塞模式，以便调用结束时关闭能够中断等待
+	if err := unix.SetNonblock(fds[0], true); err != nil {
+		unix.Close(fds[0])
+		unix.Close(fds[1])
+		return nil, err
+	}
+	local := os.NewFile(uintptr(fds[0]), "egress-local")
+	remote := os.NewFile(uintptr(fds[1]), "egress-remote")
+	cmd.ExtraFiles = append(cmd.ExtraFiles, remote)
+	if len(cmd.ExtraFiles) != egressListenerFd-2 {
+		local.Close()
+		remote.Close()
+		return nil, fmt.Errorf("出口代理通道的文件描述符冲突")
+	}
+
+	listeners := make(chan net.Listener, 1)
+	go func() {
+		<-ctx.Done()
+		local.Close()
+		remote.Close()
+	}()
+	go func() {
+		defer close(listeners)
+
+		buf := make([]byte, 1)
+		oob := make([]byte, unix.CmsgSpace(4))
+		conn, err := local.SyscallConn()
+		if err != nil {
+			return
+		}
+		var oobn int
+		var recvErr error
+		conn.Read(func(fd uintptr) bool {
+			_, oobn, _, _, recvErr = unix.Recvmsg(int(fd), buf, oob, 0)
+			return recvErr != unix.EAGAIN
+		})
+		if recvErr != nil || oobn == 0 {
+			return
+		}
+
+		messages, err := unix.ParseSocketControlMessage(oob[:oobn])
+		if err != nil || len(messages) == 0 {
+			return
+		}
+		received, err := unix.ParseUnixRights(&messages[0])
+		if err != nil || len(received) == 0 {
+			return
+		}
+		file := os.NewFile(uintptr(received[0]), "egress-listener")
+		defer file.Close()
+		if listener, err := net.FileListener(file); err == nil {
+			listeners <- listener
+		}
+	}()
+	return listeners, nil
+}
+
+// runSandboxInit 沙箱初始化进程的入口，搭建完成后 exec 函数进程，不会返回
+func runSandboxInit() {
+	runtime.LockOSThread()
+
+	fail := func(format string, args ...interface{}) {
+		fmt.Fprintf(os.Stderr, "沙箱初始化失败: "+format+"\n", args...)
+		os.Exit(sandboxInitExitCode)
+	}
+
+	if len(os.Args) < 2 {
+		fail("缺少沙箱配置")
+	}
+	var spec sandboxSpec
+	if err := json.Unmarshal([]byte(os.Args[1]), &spec); err != nil {
+		fail("解析沙箱配置失败: %v", err)
+	}
+	if err := setupSandbox(&spec); err != nil {
+		fail("%v", err)
+	}
+
+	// 没有要执行的程序时只检查沙箱能否创建
+	argv := os.Args[2:]
+	if spec.Path == "" || len(argv) == 0 {
+		os.Exit(0)
+	}
+	if err := syscall.Exec(spec.Path, argv, os.Environ()); err != nil {
+		fail("执行 %s 失败: %v", spec.Path, err)
+	}
+}
+
+// setupSandbox 在新的命名空间中搭建根文件系统和网络，并收紧进程权限
+func setupSandbox(spec *sandboxSpec) error {
+	if spec.Filesystem {
+		if err := setupFilesystem(spec); err != nil {
+			return err
+		}
+	}
+
+	switch spec.Network {
+	case NetworkLoopback, NetworkAllowlist:
+		if err := setLoopbackUp(); err != nil {
+			return fmt.Errorf("启用回环网卡失败: %v", err)
+		}
+	}
+	if spec.Network == NetworkAllowlist {
+		if err := sendEgressListener(spec.ProxyPort); err != nil {
+			return fmt.Errorf("创建出口代理监听失败: %v", err)
+		}
+	}
+
+	if err := dropCapabilities(); err != nil {
+		return fmt.Errorf("移除权限失败: %v", err)
+	}
+	if err := installSeccomp(); err != nil {
+		return fmt.Errorf("安装 seccomp 过滤器失败: %v", err)
+	}
+	return nil
+}
+
+// setupFilesystem 搭建只读的最小根文件系统并切换到函数目录
+func setupFilesystem(spec *sandboxSpec) error {
+	// 挂载事件不传播回宿主
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("设置挂载传播失败: %v", err)
+	}
+
+	root := spec.Root
+	if err := unix.Mount("tmpfs", root, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=0755,size=1m"); err != nil {
+		return fmt.Errorf("挂载根文件系统失败: %v", err)
+	}
+
+	// 私有的 /tmp
+	tmp := filepath.Join(root, "tmp")
+	if err := os.MkdirAll(tmp, 0755); err != nil {
+		return err
+	}
+	if err := unix.Mount("tmpfs", tmp, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, fmt.Sprintf("mode=1777,size=%dm", spec.TmpSize)); err != nil {
+		return fmt.Errorf("挂载 /tmp 失败: %v", err)
+	}
+
+	// 新 PID 命名空间的 /proc
+	proc := filepath.Join(root, "proc")
+	if err := os.MkdirAll(proc, 0755); err != nil {
+		return err
+	}
+	if err := unix.Mount("proc", proc, "proc", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, ""); err != nil {
+		return fmt.Errorf("挂载 /proc 失败: %v", err)
+	}
+
+	if err := setupSandboxDev(filepath.Join(root, "dev")); err != nil {
+		return err
+	}
+
+	for _, path := range spec.Mounts {
+		if err := bindReadOnly(root, path); err != nil {
+			return err
+		}
+	}
+	if err := bindReadOnly(root, spec.Dir); err != nil {
+		return err
+	}
+
+	if err := pivotRoot(root); err != nil {
+		return err
+	}
+	if err := unix.Mount("", "/", "", unix.MS_REMOUNT|unix.MS_BIND|unix.MS_RDONLY|unix.MS_NOSUID|unix.MS_NODEV, ""); err != nil {
+		return fmt.Errorf("设置根文件系统只读失败: %v", err)
+	}
+	if err := unix.Chdir(spec.WorkDir); err != nil {
+		return fmt.Errorf("切换到工作目录失败: %v", err)
+	}
+	return nil
+}
+
+// setupSandboxDev 创建只包含基本设备文件的 /dev
+func setupSandboxDev(dev string) error {
+	if err := os.MkdirAll(dev, 0755); err != nil {
+		return err
+	}
+	if err := unix.Mount("tmpfs", dev, "tmpfs", unix.MS_NOSUID|unix.MS_NOEXEC, "mode=0755,size=64k"); err != nil {
+		return fmt.Errorf("挂载 /dev 失败: %v", err)
+	}
+
+	for _, name := range sandboxDevices {
+		target := filepath.Join(dev, name)
+		if err := os.WriteFile(target, nil, 0644); err != nil {
+			return err
+		}
+		if err := unix.Mount(filepath.Join("/dev", name), target, "", unix.MS_BIND, ""); err != nil {
+			return fmt.Errorf("挂载 /dev/%s 失败: %v", name, err)
+		}
+	}
+
+	links := map[string]string{
+		"fd":     "/proc/self/fd",
+		"stdin":  "/proc/self/fd/0",
+		"stdout": "/proc/self/fd/1",
+		"stderr": "/proc/self/fd/2",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(dev, name)); err != nil {
+			return err
+		}
+	}
+
+	shm := filepath.Join(dev, "shm")
+	if err := os.MkdirAll(shm, 0755); err != nil {
+		return err
+	}
+	return unix.Mount("tmpfs", shm, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, "mode=1777,size=16m")
+}
+
+// bindReadOnly 将宿主路径以相同路径只读绑定到新根下；不存在的路径会被忽略，
+// 符号链接会在新根下重建并挂载其指向的目标
+func bindReadOnly(root, path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	target := filepath.Join(root, path)
+	if _, err := os.Lstat(target); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		link, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+		if err := os.Symlink(link, target); err != nil {
+			return err
+		}
+		resolved, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			return nil
+		}
+		return bindReadOnly(root, resolved)
+	}
+
+	if info.IsDir() {
+		err = os.Mkdir(target, 0755)
+	} else {
+		err = os.WriteFile(target, nil, 0644)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := unix.Mount(path, target, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return fmt.Errorf("挂载 %s 失败: %v", path, err)
+	}
+
+	// 重新挂载为只读时必须保留宿主上已锁定的挂载选项
+	var stat unix.Statfs_t
+	if err := unix.Statfs(target, &stat); err != nil {
+		return err
+	}
+	flags := uintptr(unix.MS_BIND | unix.MS_REMOUNT | unix.MS_RDONLY | unix.MS_NOSUID | unix.MS_NODEV)
+	for st, ms := range map[int64]uintptr{
+		unix.ST_NOEXEC:     unix.MS_NOEXEC,
+		unix.ST_NOATIME:    unix.MS_NOATIME,
+		unix.ST_NODIRATIME: unix.MS_NODIRATIME,
+		unix.ST_RELATIME:   unix.MS_RELATIME,
+	} {
+		if int64(stat.Flags)&st != 0 {
+			flags |= ms
+		}
+	}
+	if err := unix.Mount("", target, "", flags, ""); err != nil {
+		return fmt.Errorf("设置 %s 只读失败: %v", path, err)
+	}
+	return nil
+}
+
+// pivotRoot 切换到新根并卸载原根文件系统
+func pivotRoot(root string) error {
+	oldRoot := filepath.Join(root, ".old_root")
+	if err := os.Mkdir(oldRoot, 0700); err != nil {
+		return err
+	}
+	if err := unix.PivotRoot(root, oldRoot); err != nil {
+		return fmt.Errorf("切换根文件系统失败: %v", err)
+	}
+	if err := unix.Chdir("/"); err != nil {
+		return err
+	}
+	if err := unix.Unmount("/.old_root", unix.MNT_DETACH); err != nil {
+		return fmt.Errorf("卸载原根文件系统失败: %v", err)
+	}
+	return os.Remove("/.old_root")
+}
+
+// setLoopbackUp 启用网络命名空间中的回环网卡
+func setLoopbackUp() error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+
+	ifr, err := unix.NewIfreq("lo")
+	if err != nil {
+		return err
+	}
+	if err := unix.IoctlIfreq(fd, unix.SIOCGIFFLAGS, ifr); err != nil {
+		return err
+	}
+	ifr.SetUint16(ifr.Uint16() | unix.IFF_UP)
+	return unix.IoctlIfreq(fd, unix.SIOCSIFFLAGS, ifr)
+}
+
+// sendEgressListener 在函数的网络命名空间内监听出口代理端口，并把监听套接字交给服务进程。
+// 函数进程自身不持有该套接字
+func sendEgressListener(port int) error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+	defer unix.Close(egressListenerFd)
+
+	unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_REUSEADDR, 1)
+	if err := unix.Bind(fd, &unix.SockaddrInet4{Port: port, Addr: [4]byte{127, 0, 0, 1}}); err != nil {
+		return err
+	}
+	if err := unix.Listen(fd, 128); err != nil {
+		return err
+	}
+	return unix.Sendmsg(egressListenerFd, []byte{0}, unix.UnixRights(fd), nil, 0)
+}
+
+// dropCapabilities 清空能力边界集和当前能力，exec 后的进程在命名空间内也没有任何特权
+func dropCapabilities() error {
+	for capability := 0; ; capability++ {
+		if err := unix.Prctl(unix.PR_CAPBSET_DROP, uintptr(capability), 0, 0, 0); err != nil {
+			if err == unix.EINVAL {
+				break
+			}
+			return err
+		}
+	}
+	unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0)
+
+	header := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+	return unix.Capset(&header, &data[0])
+}
+
+// installSeccomp 安装 seccomp 过滤器，禁止挂载、命名空间、内核模块、ptrace 等系统调用
+func installSeccomp() error {
+	arch, ok := seccompArch[runtime.GOARCH]
+	if !ok {
+		return fmt.Errorf("不支持的架构: %s", runtime.GOARCH)
+	}
+
+	const (
+		offsetNr   = 0
+		offsetArch = 4
+		offsetArg0 = 16 // args[0] 的低32位（小端）
+	)
+	stmt := func(code uint16, k uint32) unix.SockFilter {
+		return unix.SockFilter{Code: code, K: k}
+	}
+	jump := func(code uint16, k uint32, jt, jf uint8) unix.SockFilter {
+		return unix.SockFilter{Code: code, Jt: jt, Jf: jf, K: k}
+	}
+	deny := stmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_ERRNO|uint32(unix.EPERM))
+
+	filter := []unix.SockFilter{
+		stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, offsetArch),
+		jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, arch, 1, 0),
+		stmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_KILL_PROCESS),
+		stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, offsetNr),
+	}
+	if runtime.GOARCH == "amd64" {
+		// 拒绝 x32 ABI 的系统调用号
+		filter = append(filter, jump(unix.BPF_JMP|unix.BPF_JGE|unix.BPF_K, 0x40000000, 0, 1), deny)
+	}
+	// clone3 的参数在用户内存中无法检查，返回 ENOSYS 使 libc 回退到 clone
+	filter = append(filter,
+		jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, unix.SYS_CLONE3, 0, 1),
+		stmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_ERRNO|uint32(unix.ENOSYS)),
+	)
+	for _, nr := range seccompDenied {
+		filter = append(filter, jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, nr, 0, 1), deny)
+	}
+	// clone 不允许创建新的命名空间
+	filter = append(filter,
+		jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, unix.SYS_CLONE, 0, 3),
+		stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, offsetArg0),
+		jump(unix.BPF_JMP|unix.BPF_JSET|unix.BPF_K, seccompCloneNamespaces, 0, 1),
+		deny,
+		stmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_ALLOW),
+	)
+
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return err
+	}
+	program := unix.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+	return unix.Prctl(unix.PR_SET_SECCOMP, unix.SECCOMP_MODE_FILTER, uintptr(unsafe.Pointer(&program)), 0, 0)
+}
@@ -0,0 +1,26 @@
+//go:build !linux
+
+package cloudfunction
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"runtime"
+)
+
+// SandboxAvailable 检查当前主机能否创建函数沙箱，沙箱依赖 Linux 命名空间
+func SandboxAvailable() error {
+	return fmt.Errorf("沙箱仅支持 Linux，当前系统: %s", runtime.GOOS)
+}
+
+// sandboxCommand 非 Linux 系统不支持沙箱
+func sandboxCommand(cmd *exec.Cmd, spec *sandboxSpec) error {
+	return SandboxAvailable()
+}
+
+// attachEgressListener 非 Linux 系统不支持网络隔离
+func attachEgressListener(ctx context.Context, cmd *exec.Cmd) (<-chan net.Listener, error) {
+	return nil, SandboxAvailable()
+}
@@ -0,0 +1,98 @@
+package cloudfunction
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestSandboxMounts(t *testing.T) {
+	mounts := sandboxMounts("python")
+	for _, path := range []string{"/usr", "/etc/passwd", "/etc/resolv.conf"} {
+		if !underSandboxPaths(path, mounts) {
+			t.Errorf("沙箱中缺少 %s", path)
+		}
+	}
+	for _, path := range []string{"/etc/shadow", "/etc", "/root", "/home", "/proc/1"} {
+		if underSandboxPaths(path, mounts) {
+			t.Errorf("%s 不应挂载到沙箱中", path)
+		}
+	}
+	if underSandboxPaths("/usrlocal/bin", []string{"/usr"}) {
+		t.Error("前缀相同的其他目录不应视为已挂载")
+	}
+}
+
+func TestSandboxIsolatesFunctionProcess(t *testing.T) {
+	requireTool(t, "python3")
+	if err := SandboxAvailable(); err != nil {
+		t.Skipf("当前主机不支持沙箱: %v", err)
+	}
+
+	workDir := t.TempDir()
+	secretFile := filepath.Join(filepath.Dir(workDir), "outside.txt")
+	if err := os.WriteFile(secretFile, []byte("host data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(secretFile)
+
+	p := NewPlatform(workDir)
+	t.Cleanup(func() { waitForBuilds(t, p) })
+	sandbox := true
+	fn := &Function{Name: "sandboxed", Runtime: "python", Handler: "handler", Timeout: 20, Memory: 128, Sandbox: &sandbox,
+		Code: `import os
+
+def probe(action):
+    try:
+        action()
+        return "ok"
+    except Exception as e:
+        return type(e).__name__
+
+def write(path):
+    with open(path, "w") as f:
+        f.write("x")
+
+def handler(event, context):
+    return {
+        "outside": probe(lambda: open(event["outside"]).read()),
+        "platform_data": probe(lambda: open(event["data"]).read()),
+        "write_code_dir": probe(lambda: write("written.txt")),
+        "write_tmp": probe(lambda: write("/tmp/scratch.txt")),
+        "pid": os.getpid(),
+    }
+`}
+	if err := p.CreateFunction(fn); err != nil {
+		t.Fatal(err)
+	}
+
+	waitForBuilds(t, p)
+	resp, err := p.ExecuteFunction(fn.ID, &ExecuteRequest{Event: map[string]interface{}{
+		"outside": secretFile,
+		"data":    filepath.Join(workDir, "functions.json"),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Success {
+		t.Fatalf("执行失败: %s", resp.Error)
+	}
+	data, _ := json.Marshal(resp.Result)
+	result := string(data)
+
+	for _, probe := range []string{"outside", "platform_data", "write_code_dir"} {
+		if strings.Contains(result, `"`+probe+`":"ok"`) {
+			t.Errorf("沙箱内的 %s 操作应失败: %s", probe, result)
+		}
+	}
+	if !strings.Contains(result, `"write_tmp":"ok"`) {
+		t.Errorf("沙箱内的 /tmp 应可写: %s", result)
+	}
+	// 函数进程在独立的 PID 命名空间中，PID 很小
+	if match := regexp.MustCompile(`"pid":(\d+)`).FindStringSubmatch(result); match == nil || len(match[1]) > 1 {
+		t.Errorf("函数进程不在独立的PID命名空间中: %s", result)
+	}
+}
@@ -0,0 +1,624 @@
+package cloudfunction
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// RedactedValue 密钥值在响应和日志中的替代文本
+const RedactedValue = "******"
+
+// ErrSecretsDisabled 未配置主密钥时密钥功能不可用
+var ErrSecretsDisabled = errors.New("未配置主密钥(SECRETS_MASTER_KEY)，密钥功能不可用")
+
+// ErrSecretInUse 密钥仍被函数引用
+var ErrSecretInUse = errors.New("密钥正在被函数使用")
+
+var (
+	secretNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]{0,127}$`)
+	// 环境变量值整体为 ${secret:NAME} 时表示引用密钥
+	secretRefPattern = regexp.MustCompile(`^\$\{secret:([A-Za-z_][A-Za-z0-9_.-]{0,127})\}$`)
+)
+
+// storedSecret 加密存储的密钥
+type storedSecret struct {
+	Name       string    `json:"name"`
+	KeyID      string    `json:"key_id"`
+	Nonce      string    `json:"nonce"`
+	Ciphertext string    `json:"ciphertext"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// secretsFileData 密钥文件的内容，Salt 是派生主密钥时使用的随机盐。
+// 之前版本的文件只有密钥数组，其中的密钥由未加盐的 SHA-256 派生的主密钥加密
+type secretsFileData struct {
+	Salt    string          `json:"salt"`
+	Secrets []*storedSecret `json:"secrets"`
+}
+
+// SecretInfo 密钥元数据，不包含密钥值
+type SecretInfo struct {
+	Name      string    `json:"name"`
+	KeyID     string    `json:"key_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SecretStore 使用主密钥(AES-256-GCM)加密保存的密钥存储
+type SecretStore struct {
+	file     string
+	keys     map[string][]byte // 密钥ID -> 主密钥，包含用于解密旧数据的历史主密钥
+	activeID string            // 当前用于加密的主密钥ID
+	salt     []byte
+	secrets  map[string]*storedSecret
+	mutex    sync.RWMutex
+}
+
+// NewSecretStore 创建密钥存储；masterKey 为空时密钥功能不可用，previousKeys 用于解密轮换前的数据
+func NewSecretStore(file, masterKey string, previousKeys []string) (*SecretStore, error) {
+	store := &SecretStore{
+		file:    file,
+		keys:    make(map[string][]byte),
+		secrets: make(map[string]*storedSecret),
+	}
+	if err := store.load(); err != nil {
+		return nil, err
+	}
+
+	// 旧的派生方式只用于解密升级前保存的密钥
+	legacy := make(map[string]bool)
+	for i, raw := range append([]string{masterKey}, previousKeys...) {
+		if raw == "" {
+			continue
+		}
+		id, key := deriveMasterKey(raw, store.salt)
+		store.keys[id] = key
+		if i == 0 {
+			store.activeID = id
+		}
+		legacyID, legacyKey := deriveLegacyMasterKey(raw)
+		store.keys[legacyID] = legacyKey
+		legacy[legacyID] = true
+	}
+
+	if store.Enabled() {
+		upgraded, err := store.reencrypt(func(secret *storedSecret) bool { return legacy[secret.KeyID] })
+		if err != nil {
+			Error("使用新的主密钥派生方式重新加密密钥失败: %v", err)
+		} else if upgraded > 0 {
+			Info("已使用新的主密钥派生方式重新加密 %d 个密钥", upgraded)
+		}
+	}
+	return store, nil
+}
+
+// secretsFile 返回密钥存储文件的路径。函数目录中的文件可能被函数进程读取，默认保存在函数目录旁
+func (p *Platform) secretsFile() string {
+	if p.options.SecretsFile != "" {
+		return p.options.SecretsFile
+	}
+	return filepath.Join(filepath.Dir(p.workDir), "secrets.json")
+}
+
+// migrateSecretsFile 将之前版本保存在函数目录中的 secrets.json 移动到 secretsFile，返回实际使用的文件
+func (p *Platform) migrateSecretsFile() string {
+	file := p.secretsFile()
+	legacy := filepath.Join(p.workDir, "secrets.json")
+	if !fileExists(legacy) || fileExists(file) {
+		return file
+	}
+	err := os.MkdirAll(filepath.Dir(file), 0755)
+	if err == nil {
+		err = os.Rename(legacy, file)
+	}
+	if err != nil {
+		// 移动失败时继续使用原文件，避免丢失已保存的密钥
+		Error("移动密钥文件 %s 到 %s 失败: %v", legacy, file, err)
+		return legacy
+	}
+	return file
+}
+
+// deriveMasterKey 使用 HKDF-SHA256 和密钥文件中的盐由配置的主密钥派生AES-256密钥及其ID
+func deriveMasterKey(masterKey string, salt []byte) (string, []byte) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, []byte(masterKey), salt, []byte("cloudfunction secrets")), key); err != nil {
+		// 输出长度远小于 HKDF 的上限，不会失败
+		panic(err)
+	}
+	fingerprint := sha256.Sum256(key)
+	return hex.EncodeToString(fingerprint[:6]), key
+}
+
+// deriveLegacyMasterKey 之前版本未加盐的派生方式
+func deriveLegacyMasterKey(masterKey string) (string, []byte) {
+	key := sha256.Sum256([]byte(masterKey))
+	fingerprint := sha256.Sum256(key[:])
+	return hex.EncodeToString(fingerprint[:6]), key[:]
+}
+
+// Enabled 是否配置了主密钥
+func (s *SecretStore) Enabled() bool {
+	return s.activeID != ""
+}
+
+// load 从文件加载密钥和盐，文件中没有盐时生成新的盐，在下次保存时写入文件
+func (s *SecretStore) load() error {
+	data, err := os.ReadFile(s.file)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("读取密钥文件失败: %v", err)
+	}
+
+	var content secretsFileData
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 {
+		var target interface{} = &content
+		if trimmed[0] == '[' {
+			target = &content.Secrets
+		}
+		if err := json.Unmarshal(data, target); err != nil {
+			return fmt.Errorf("解析密钥文件失败: %v", err)
+		}
+	}
+	for _, secret := range content.Secrets {
+		s.secrets[secret.Name] = secret
+	}
+
+	if content.Salt != "" {
+		if s.salt, err = base64.StdEncoding.DecodeString(content.Salt); err != nil {
+			return fmt.Errorf("密钥文件中的盐格式错误: %v", err)
+		}
+		return nil
+	}
+	s.salt = make([]byte, 32)
+	if _, err := rand.Read(s.salt); err != nil {
+		return fmt.Errorf("生成随机数失败: %v", err)
+	}
+	return nil
+}
+
+// save 将盐和密钥写入文件，调用方需持有写锁
+func (s *SecretStore) save() error {
+	content := secretsFileData{
+		Salt:    base64.StdEncoding.EncodeToString(s.salt),
+		Secrets: make([]*storedSecret, 0, len(s.secrets)),
+	}
+	for _, secret := range s.secrets {
+		content.Secrets = append(content.Secrets, secret)
+	}
+	sort.Slice(content.Secrets, func(i, j int) bool { return content.Secrets[i].Name < content.Secrets[j].Name })
+
+	data, err := json.MarshalIndent(content, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化密钥失败: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.file), 0755); err != nil {
+		return fmt.Errorf("创建密钥目录失败: %v", err)
+	}
+	if err := os.WriteFile(s.file, data, 0600); err != nil {
+		return fmt.Errorf("写入密钥文件失败: %v", err)
+	}
+	return nil
+}
+
+// Put 创建或更新密钥
+func (s *SecretStore) Put(name, value string) (*SecretInfo, error) {
+	if !s.Enabled() {
+		return nil, ErrSecretsDisabled
+	}
+	if !secretNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("无效的密钥名称: %s", name)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	secret := &storedSecret{Name: name, CreatedAt: now, UpdatedAt: now}
+	old, exists := s.secrets[name]
+	if exists {
+		secret.CreatedAt = old.CreatedAt
+	}
+	if err := s.encrypt(secret, value); err != nil {
+		return nil, err
+	}
+
+	s.secrets[name] = secret
+	if err := s.save(); err != nil {
+		if exists {
+			s.secrets[name] = old
+		} else {
+			delete(s.secrets, name)
+		}
+		return nil, err
+	}
+	return secret.info(), nil
+}
+
+// List 列出所有密钥的元数据
+func (s *SecretStore) List() []*SecretInfo {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	infos := make([]*SecretInfo, 0, len(s.secrets))
+	for _, secret := range s.secrets {
+		infos = append(infos, secret.info())
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// Exists 检查密钥是否存在
+func (s *SecretStore) Exists(name string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	_, exists := s.secrets[name]
+	return exists
+}
+
+// Delete 删除密钥
+func (s *SecretStore) Delete(name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	old, exists := s.secrets[name]
+	if !exists {
+		return fmt.Errorf("密钥不存在: %s", name)
+	}
+	delete(s.secrets, name)
+	if err := s.save(); err != nil {
+		s.secrets[name] = old
+		return err
+	}
+	return nil
+}
+
+// Get 解密并返回密钥值，只在函数执行时使用
+func (s *SecretStore) Get(name string) (string, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	secret, exists := s.secrets[name]
+	if !exists {
+		return "", fmt.Errorf("密钥不存在: %s", name)
+	}
+	return s.decrypt(secret)
+}
+
+// Rotate 使用当前主密钥重新加密所有由旧主密钥加密的密钥，返回重新加密的数量
+func (s *SecretStore) Rotate() (int, error) {
+	if !s.Enabled() {
+		return 0, ErrSecretsDisabled
+	}
+	return s.reencrypt(func(secret *storedSecret) bool { return secret.KeyID != s.activeID })
+}
+
+// reencrypt 使用当前主密钥重新加密满足条件的密钥，任何一个失败时保持原有数据不变
+func (s *SecretStore) reencrypt(match func(*storedSecret) bool) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	rotated := make(map[string]*storedSecret)
+	for name, secret := range s.secrets {
+		if !match(secret) {
+			continue
+		}
+		value, err := s.decrypt(secret)
+		if err != nil {
+			return 0, err
+		}
+		updated := *secret
+		if err := s.encrypt(&updated, value); err != nil {
+			return 0, err
+		}
+		rotated[name] = &updated
+	}
+	if len(rotated) == 0 {
+		return 0, nil
+	}
+
+	previous := make(map[string]*storedSecret, len(rotated))
+	for name, secret := range rotated {
+		previous[name] = s.secrets[name]
+		s.secrets[name] = secret
+	}
+	if err := s.save(); err != nil {
+		for name, secret := range previous {
+			s.secrets[name] = secret
+		}
+		return 0, err
+	}
+	return len(rotated), nil
+}
+
+// encrypt 使用当前主密钥加密，密钥名称作为附加认证数据
+func (s *SecretStore) encrypt(secret *storedSecret, value string) error {
+	gcm, err := newGCM(s.keys[s.activeID])
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("生成随机数失败: %v", err)
+	}
+
+	ciphertext := gcm.Seal(nil, nonce, []byte(value), []byte(secret.Name))
+	secret.KeyID = s.activeID
+	secret.Nonce = base64.StdEncoding.EncodeToString(nonce)
+	secret.Ciphertext = base64.StdEncoding.EncodeToString(ciphertext)
+	secret.UpdatedAt = time.Now()
+	return nil
+}
+
+// decrypt 使用密钥记录对应的主密钥解密
+func (s *SecretStore) decrypt(secret *storedSecret) (string, error) {
+	key, ok := s.keys[secret.KeyID]
+	if !ok {
+		return "", fmt.Errorf("密钥 %s 使用的主密钥 %s 未配置", secret.Name, secret.KeyID)
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce, err := base64.StdEncoding.DecodeString(secret.Nonce)
+	if err != nil {
+		return "", fmt.Errorf("密钥 %s 数据损坏", secret.Name)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(secret.Ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("密钥 %s 数据损坏", secret.Name)
+	}
+
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, []byte(secret.Name))
+	if err != nil {
+		return "", fmt.Errorf("解密密钥 %s 失败", secret.Name)
+	}
+	return string(plaintext), nil
+}
+
+// info 返回密钥元数据
+func (secret *storedSecret) info() *SecretInfo {
+	return &SecretInfo{
+		Name:      secret.Name,
+		KeyID:     secret.KeyID,
+		CreatedAt: secret.CreatedAt,
+		UpdatedAt: secret.UpdatedAt,
+	}
+}
+
+// newGCM 创建AES-GCM加密器
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("初始化加密器失败: %v", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// secretReference 解析环境变量值中的密钥引用
+func secretReference(value string) (string, bool) {
+	match := secretRefPattern.FindStringSubmatch(value)
+	if match == nil {
+		return "", false
+	}
+	return match[1], true
+}
+
+// validateSecretRefs 检查环境变量引用的密钥是否都存在
+func (p *Platform) validateSecretRefs(environment map[string]string) error {
+	for key, value := range environment {
+		name, ok := secretReference(value)
+		if !ok {
+			if strings.Contains(value, "${secret:") {
+				return newValidationError("环境变量 %s 的密钥引用格式错误，应为 ${secret:名称}", key)
+			}
+			continue
+		}
+		if !p.secrets.Enabled() {
+			return newValidationError("环境变量 %s 引用了密钥，但%v", key, ErrSecretsDisabled)
+		}
+		if !p.secrets.Exists(name) {
+			return newValidationError("环境变量 %s 引用的密钥不存在: %s", key, name)
+		}
+	}
+	return nil
+}
+
+// resolveEnvironment 在执行时将密钥引用替换为解密后的值，同时返回需要脱敏的密钥值
+func (p *Platform) resolveEnvironment(environment map[string]string) (map[string]string, []string, error) {
+	resolved := make(map[string]string, len(environment))
+	var secretValues []string
+
+	for key, value := range environment {
+		name, ok := secretReference(value)
+		if !ok {
+			resolved[key] = value
+			continue
+		}
+		secretValue, err := p.secrets.Get(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		resolved[key] = secretValue
+		if secretValue != "" {
+			secretValues = append(secretValues, secretValue)
+		}
+	}
+	return resolved, secretValues, nil
+}
+
+// secretInUse 检查密钥是否被函数当前代码或已发布版本引用，调用方需持有锁
+func (p *Platform) secretInUse(name string) (string, bool) {
+	references := func(environment map[string]string) bool {
+		for _, value := range environment {
+			if ref, ok := secretReference(value); ok && ref == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	functions := make([]*Function, 0, len(p.functions))
+	for _, fn := range p.functions {
+		functions = append(functions, fn)
+	}
+	sortFunctionsByCreated(functions)
+	for _, fn := range functions {
+		if references(fn.Environment) {
+			return fn.ID, true
+		}
+		for _, version := range fn.Versions {
+			if references(version.Environment) {
+				return fmt.Sprintf("%s:%d", fn.ID, version.Version), true
+			}
+		}
+	}
+	return "", false
+}
+
+// DeleteSecret 删除未被任何函数引用的密钥。
+// 检查引用和删除都在函数表的锁内进行，创建、更新函数时在同一把锁内重新检查引用的密钥是否存在
+func (p *Platform) DeleteSecret(name string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if ref, inUse := p.secretInUse(name); inUse {
+		return fmt.Errorf("%w: %s 被 %s 引用", ErrSecretInUse, name, ref)
+	}
+	return p.secrets.Delete(name)
+}
+
+// Secrets 返回平台的密钥存储
+func (p *Platform) Secrets() *SecretStore {
+	return p.secrets
+}
+
+// valueNames 返回密钥值到密钥名称的映射，无法解密的密钥和空值被忽略
+func (s *SecretStore) valueNames() map[string]string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	names := make(map[string]string, len(s.secrets))
+	for name, secret := range s.secrets {
+		if value, err := s.decrypt(secret); err == nil && value != "" {
+			names[value] = name
+		}
+	}
+	return names
+}
+
+// redactEnvironment 返回用于API响应的环境变量：值与某个已保存的密钥相同的环境变量替换为对该密钥的引用，
+// 其余值原样返回。引用在执行时解析为相同的值，客户端可以把获取到的配置原样提交回来
+func redactEnvironment(environment map[string]string, secretNames map[string]string) map[string]string {
+	if environment == nil {
+		return nil
+	}
+	redacted := make(map[string]string, len(environment))
+	for key, value := range environment {
+		if name, ok := secretNames[value]; ok {
+			redacted[key] = "${secret:" + name + "}"
+		} else {
+			redacted[key] = value
+		}
+	}
+	return redacted
+}
+
+// redactedFunction 返回用于API响应的函数副本，当前代码和已发布版本的环境变量都已脱敏
+func (p *Platform) redactedFunction(fn *Function) *Function {
+	return redactFunction(fn, p.secrets.valueNames())
+}
+
+// redactedFunctions 对函数列表逐个脱敏
+func (p *Platform) redactedFunctions(functions []*Function) []*Function {
+	secretNames := p.secrets.valueNames()
+	redacted := make([]*Function, len(functions))
+	for i, fn := range functions {
+		redacted[i] = redactFunction(fn, secretNames)
+	}
+	return redacted
+}
+
+// redactedVersion 返回用于API响应的版本副本，环境变量已脱敏
+func (p *Platform) redactedVersion(version *FunctionVersion) *FunctionVersion {
+	return redactVersion(version, p.secrets.valueNames())
+}
+
+// redactedVersions 对版本列表逐个脱敏
+func (p *Platform) redactedVersions(versions []*FunctionVersion) []*FunctionVersion {
+	secretNames := p.secrets.valueNames()
+	redacted := make([]*FunctionVersion, len(versions))
+	for i, version := range versions {
+		redacted[i] = redactVersion(version, secretNames)
+	}
+	return redacted
+}
+
+func redactFunction(fn *Function, secretNames map[string]string) *Function {
+	redacted := *fn
+	redacted.Environment = redactEnvironment(fn.Environment, secretNames)
+	if fn.Versions != nil {
+		redacted.Versions = make([]*FunctionVersion, len(fn.Versions))
+		for i, version := range fn.Versions {
+			redacted.Versions[i] = redactVersion(version, secretNames)
+		}
+	}
+	return &redacted
+}
+
+func redactVersion(version *FunctionVersion, secretNames map[string]string) *FunctionVersion {
+	redacted := *version
+	redacted.Environment = redactEnvironment(version.Environment, secretNames)
+	return &redacted
+}
+
+// redactString 将字符串中出现的密钥值替换为脱敏文本
+func redactString(s string, secretValues []string) string {
+	for _, value := range secretValues {
+		s = strings.ReplaceAll(s, value, RedactedValue)
+	}
+	return s
+}
+
+// redactValue 递归脱敏执行结果中的字符串
+func redactValue(v interface{}, secretValues []string) interface{} {
+	if len(secretValues) == 0 {
+		return v
+	}
+	switch value := v.(type) {
+	case string:
+		return redactString(value, secretValues)
+	case map[string]interface{}:
+		for k, item := range value {
+			value[k] = redactValue(item, secretValues)
+		}
+		return value
+	case []interface{}:
+		for i, item := range value {
+			value[i] = redactValue(item, secretValues)
+		}
+		return value
+	default:
+		return v
+	}
+}
@@ -0,0 +1,279 @@
+package cloudfunction
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSecretStoreRoundTrip(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "secrets.json")
+	store, err := NewSecretStore(file, "master-key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := map[string]string{
+		"DB_PASSWORD": "s3cret",
+		"EMPTY":       "",
+		"UNICODE":     "密钥 ✓ \n\x00",
+	}
+	for name, value := range values {
+		if _, err := store.Put(name, value); err != nil {
+			t.Fatalf("Put(%s): %v", name, err)
+		}
+	}
+
+	// 文件中只保存密文
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "s3cret") {
+		t.Fatal("密钥文件中包含明文")
+	}
+
+	// 重新加载后仍能解密
+	reloaded, err := NewSecretStore(file, "master-key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range values {
+		got, err := reloaded.Get(name)
+		if err != nil || got != value {
+			t.Fatalf("Get(%s) = %q, %v; want %q", name, got, err, value)
+		}
+	}
+}
+
+func TestSecretStoreMasterKeys(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "secrets.json")
+	store, err := NewSecretStore(file, "old-key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Put("TOKEN", "value"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		master   string
+		previous []string
+		wantErr  bool
+	}{
+		{name: "相同主密钥", master: "old-key"},
+		{name: "错误的主密钥", master: "wrong-key", wantErr: true},
+		{name: "旧主密钥在历史列表中", master: "new-key", previous: []string{"old-key"}},
+		{name: "历史列表中没有旧主密钥", master: "new-key", previous: []string{"other-key"}, wantErr: true},
+		{name: "未配置主密钥", master: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := NewSecretStore(file, tt.master, tt.previous)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := store.Get("TOKEN")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Get 应返回错误, got %q", got)
+				}
+				return
+			}
+			if err != nil || got != "value" {
+				t.Fatalf("Get = %q, %v", got, err)
+			}
+		})
+	}
+}
+
+func TestSecretStoreDisabled(t *testing.T) {
+	store, err := NewSecretStore(filepath.Join(t.TempDir(), "secrets.json"), "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Put("TOKEN", "value"); !errors.Is(err, ErrSecretsDisabled) {
+		t.Fatalf("Put err = %v, want ErrSecretsDisabled", err)
+	}
+}
+
+func TestRedactValue(t *testing.T) {
+	secrets := []string{"s3cret", "token-123"}
+	tests := []struct {
+		name  string
+		value interface{}
+		want  interface{}
+	}{
+		{"字符串", "password is s3cret", "password is " + RedactedValue},
+		{"多次出现", "s3cret/s3cret", RedactedValue + "/" + RedactedValue},
+		{"无关字符串", "hello", "hello"},
+		{"嵌套对象", map[string]interface{}{
+			"a": "token-123",
+			"b": []interface{}{"x s3cret", 1.0, true},
+		}, map[string]interface{}{
+			"a": RedactedValue,
+			"b": []interface{}{"x " + RedactedValue, 1.0, true},
+		}},
+		{"数字", 42.0, 42.0},
+		{"空值", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactValue(tt.value, secrets); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("redactValue = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSecretsInjectedAtExecutionAndRedacted(t *testing.T) {
+	requireTool(t, "python3")
+	options := DefaultOptions()
+	options.SecretsMasterKey = "test-master-key"
+	p := newTestPlatformWithOptions(t, options)
+	if _, err := p.Secrets().Put("API_TOKEN", "tok-9f8e7d"); err != nil {
+		t.Fatal(err)
+	}
+
+	missing := &Function{Name: "missing", Runtime: "python", Handler: "handler", Timeout: 10, Memory: 128,
+		Code:        "def handler(event, context):\n    return 1\n",
+		Environment: map[string]string{"TOKEN": "${secret:NOT_THERE}"}}
+	if err := p.CreateFunction(missing); err == nil {
+		t.Fatal("引用不存在的密钥时应拒绝部署")
+	}
+
+	fn := &Function{Name: "leaky", Runtime: "python", Handler: "handler", Timeout: 10, Memory: 128,
+		Code:        "import os\n\ndef handler(event, context):\n    return {'token': os.environ['TOKEN'], 'length': len(os.environ['TOKEN'])}\n",
+		Environment: map[string]string{"TOKEN": "${secret:API_TOKEN}"}}
+	if err := p.CreateFunction(fn); err != nil {
+		t.Fatal(err)
+	}
+
+	// 文件中只保存引用
+	saved, err := os.ReadFile(p.dataFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(saved), "tok-9f8e7d") {
+		t.Fatal("函数数据中包含密钥明文")
+	}
+
+	waitForBuilds(t, p)
+	resp, err := p.ExecuteFunction(fn.ID, &ExecuteRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Success {
+		t.Fatalf("执行失败: %s", resp.Error)
+	}
+	result, _ := json.Marshal(resp.Result)
+	if strings.Contains(string(result), "tok-9f8e7d") || !strings.Contains(string(result), RedactedValue) {
+		t.Fatalf("执行结果没有脱敏: %s", result)
+	}
+	// 函数拿到的是解密后的值
+	if !strings.Contains(string(result), `"length":10`) {
+		t.Fatalf("函数没有拿到解密后的密钥: %s", result)
+	}
+
+	if err := p.DeleteSecret("API_TOKEN"); !errors.Is(err, ErrSecretInUse) {
+		t.Fatalf("删除被引用的密钥: err = %v, want ErrSecretInUse", err)
+	}
+}
+
+func TestRedactEnvironment(t *testing.T) {
+	options := DefaultOptions()
+	options.SecretsMasterKey = "test-master-key"
+	p := newTestPlatformWithOptions(t, options)
+	if _, err := p.Secrets().Put("DB_PASSWORD", "s3cret"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 直接写入的密钥值替换为引用，其余值原样返回
+	environment := map[string]string{
+		"PLAIN":    "hello",
+		"EMPTY":    "",
+		"SECRET":   "${secret:DB_PASSWORD}",
+		"INLINED":  "s3cret",
+		"CONTAINS": "s3cret-suffix",
+	}
+	fn := &Function{
+		Environment: environment,
+		Versions:    []*FunctionVersion{{Version: 1, Environment: map[string]string{"V": "s3cret"}}},
+	}
+	copied := p.redactedFunction(fn)
+	want := map[string]string{
+		"PLAIN":    "hello",
+		"EMPTY":    "",
+		"SECRET":   "${secret:DB_PASSWORD}",
+		"INLINED":  "${secret:DB_PASSWORD}",
+		"CONTAINS": "s3cret-suffix",
+	}
+	if !reflect.DeepEqual(copied.Environment, want) {
+		t.Fatalf("Environment = %v, want %v", copied.Environment, want)
+	}
+	if copied.Versions[0].Environment["V"] != "${secret:DB_PASSWORD}" {
+		t.Fatalf("版本没有脱敏: %v", copied.Versions[0].Environment)
+	}
+	if environment["INLINED"] != "s3cret" || fn.Versions[0].Environment["V"] != "s3cret" {
+		t.Fatal("redactedFunction 修改了原始函数")
+	}
+
+	// 把响应中的配置提交回来，执行时得到相同的值
+	resolved, _, err := p.resolveEnvironment(copied.Environment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(resolved, map[string]string{
+		"PLAIN": "hello", "EMPTY": "", "SECRET": "s3cret", "INLINED": "s3cret", "CONTAINS": "s3cret-suffix",
+	}) {
+		t.Fatalf("resolveEnvironment = %v", resolved)
+	}
+}
+
+func TestSecretStoreUpgradesLegacyFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "secrets.json")
+
+	// 之前版本的文件：只有密钥数组，主密钥未加盐派生
+	id, key := deriveLegacyMasterKey("master-key")
+	legacy := &SecretStore{file: file, keys: map[string][]byte{id: key}, activeID: id, secrets: map[string]*storedSecret{}}
+	secret := &storedSecret{Name: "TOKEN"}
+	if err := legacy.encrypt(secret, "value"); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal([]*storedSecret{secret})
+	if err := os.WriteFile(file, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewSecretStore(file, "master-key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := store.Get("TOKEN"); err != nil || got != "value" {
+		t.Fatalf("Get = %q, %v", got, err)
+	}
+
+	// 加载时使用加盐派生的主密钥重新加密并写入盐
+	var content secretsFileData
+	data, _ = os.ReadFile(file)
+	if err := json.Unmarshal(data, &content); err != nil {
+		t.Fatal(err)
+	}
+	if content.Salt == "" || len(content.Secrets) != 1 || content.Secrets[0].KeyID == id || content.Secrets[0].KeyID != store.activeID {
+		t.Fatalf("密钥文件 = %s", data)
+	}
+
+	// 相同主密钥在不同的文件中派生出不同的密钥
+	other, err := NewSecretStore(filepath.Join(t.TempDir(), "secrets.json"), "master-key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.activeID == store.activeID {
+		t.Fatal("不同的盐派生出了相同的主密钥")
+	}
+}
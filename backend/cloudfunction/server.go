@@ -1,13 +1,19 @@
 package cloudfunction
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
+// functionIDKey 解析后的函数ID在gin上下文中的键
+const functionIDKey = "functionID"
+
 // Server 云函数HTTP服务器
 type Server struct {
 	platform *Platform
@@ -45,12 +51,48 @@ func (s *Server) setupRoutes() {
 		// 函数管理
 		api.POST("/functions", s.createFunction)
 		api.GET("/functions", s.listFunctions)
-		api.GET("/functions/:id", s.getFunction)
-		api.PUT("/functions/:id", s.updateFunction)
-		api.DELETE("/functions/:id", s.deleteFunction)
-
-		// 函数执行
-		api.POST("/functions/:id/invoke", s.invokeFunction)
+		api.POST("/functions/validate", s.validateFunction)
+
+		// 以下路由的 :id 可以是函数ID或函数名称（通过 ?namespace= 指定命名空间）
+		fn := api.Group("/functions/:id", s.resolveFunctionRef)
+		fn.GET("", s.getFunction)
+		fn.PUT("", s.updateFunction)
+		fn.DELETE("", s.deleteFunction)
+
+		// 版本与别名
+		fn.POST("/versions", s.publishVersion)
+		fn.GET("/versions", s.listVersions)
+		fn.GET("/versions/:version", s.getVersion)
+		fn.GET("/aliases", s.listAliases)
+		fn.PUT("/aliases/:alias", s.setAlias)
+		fn.DELETE("/aliases/:alias", s.deleteAlias)
+		fn.POST("/aliases/:alias/rollback", s.rollbackAlias)
+		fn.GET("/aliases/:alias/stats", s.aliasStats)
+
+		// 函数执行（可带限定符，如 /functions/fn_xxx:prod/invoke、/functions/my-func:2/invoke）
+		fn.POST("/invoke", s.invokeFunction)
+		fn.POST("/versions/:version/invoke", s.invokeVersion)
+
+		// 构建状态与构建日志
+		fn.GET("/builds", s.listBuilds)
+		fn.GET("/builds/:buildId", s.getBuild)
+
+		// 多文件代码包
+		fn.PUT("/package", s.uploadPackage)
+		fn.GET("/package", s.downloadPackage)
+
+		// 层：可被多个函数共享的公共代码、依赖和数据文件
+		api.GET("/layers", s.listLayers)
+		api.GET("/layers/:name", s.getLayer)
+		api.POST("/layers/:name/versions", s.publishLayerVersion)
+		api.DELETE("/layers/:name", s.deleteLayer)
+		api.DELETE("/layers/:name/versions/:version", s.deleteLayerVersion)
+
+		// 密钥管理（只返回元数据，不返回密钥值）
+		api.GET("/secrets", s.listSecrets)
+		api.PUT("/secrets/:name", s.putSecret)
+		api.DELETE("/secrets/:name", s.deleteSecret)
+		api.POST("/secrets/rotate", s.rotateSecrets)
 
 		// 健康检查
 		api.GET("/health", s.healthCheck)
@@ -61,15 +103,25 @@ func (s *Server) setupRoutes() {
 func (s *Server) createFunction(c *gin.Context) {
 	var req struct {
 		Name        string            `json:"name" binding:"required"`
+		Namespace   string            `json:"namespace"`
 		Runtime     string            `json:"runtime" binding:"required"`
-		Code        string            `json:"code" binding:"required"`
+		Code        string            `json:"code"`
+		Package     []byte            `json:"package"` // base64 编码的 zip/tar.gz 代码包、WebAssembly 模块或 Linux 可执行文件，与 code 二选一
+		Layers      []LayerRef        `json:"layers"`
 		Handler     string            `json:"handler" binding:"required"`
 		Environment map[string]string `json:"environment"`
+		Labels      map[string]string `json:"labels"`
 		Timeout     int               `json:"timeout"`
 		Memory      int               `json:"memory"`
+		Sandbox     *bool             `json:"sandbox"`
+		Network     *NetworkPolicy    `json:"network"`
 	}
 
+	s.limitInlinePackageBody(c)
 	if err := c.ShouldBindJSON(&req); err != nil {
+		if s.packageTooLarge(c, err) {
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
 		return
 	}
@@ -84,61 +136,192 @@ func (s *Server) createFunction(c *gin.Context) {
 	if req.Environment == nil {
 		req.Environment = make(map[string]string)
 	}
+	if req.Namespace == "" {
+		req.Namespace = DefaultNamespace
+	}
+	if err := validateNamespace(req.Namespace); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateFunctionName(req.Name); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateLabels(req.Labels); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	fn := &Function{
 		Name:        req.Name,
+		Namespace:   req.Namespace,
 		Runtime:     req.Runtime,
 		Code:        req.Code,
+		Layers:      req.Layers,
 		Handler:     req.Handler,
 		Environment: req.Environment,
+		Labels:      req.Labels,
 		Timeout:     req.Timeout,
 		Memory:      req.Memory,
+		Sandbox:     req.Sandbox,
+		Network:     req.Network,
+	}
+	if len(req.Package) > 0 {
+		pkg, err := s.platform.StorePackage(req.Package)
+		if err != nil {
+			c.JSON(errorResponse("创建函数失败", err))
+			return
+		}
+		fn.Package = pkg
 	}
 
 	if err := s.platform.CreateFunction(fn); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建函数失败: " + err.Error()})
+		c.JSON(errorResponse("创建函数失败", err))
 		return
 	}
 
 	c.JSON(http.StatusCreated, gin.H{
 		"message":  "函数创建成功",
-		"function": fn,
+		"function": s.platform.redactedFunction(fn),
 	})
 }
 
-// listFunctions 列出所有函数
+// validateFunction 只校验函数配置和代码而不部署，返回诊断信息
+func (s *Server) validateFunction(c *gin.Context) {
+	var req struct {
+		Runtime     string            `json:"runtime" binding:"required"`
+		Code        string            `json:"code"`
+		Package     []byte            `json:"package"`
+		Layers      []LayerRef        `json:"layers"`
+		Handler     string            `json:"handler" binding:"required"`
+		Environment map[string]string `json:"environment"`
+		Timeout     int               `json:"timeout"`
+		Memory      int               `json:"memory"`
+		Sandbox     *bool             `json:"sandbox"`
+		Network     *NetworkPolicy    `json:"network"`
+	}
+
+	s.limitInlinePackageBody(c)
+	if err := c.ShouldBindJSON(&req); err != nil {
+		if s.packageTooLarge(c, err) {
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+	if req.Timeout == 0 {
+		req.Timeout = 30
+	}
+	if req.Memory == 0 {
+		req.Memory = 128
+	}
+
+	fn := &Function{
+		Runtime:     req.Runtime,
+		Code:        req.Code,
+		Layers:      req.Layers,
+		Handler:     req.Handler,
+		Environment: req.Environment,
+		Timeout:     req.Timeout,
+		Memory:      req.Memory,
+		Sandbox:     req.Sandbox,
+		Network:     req.Network,
+	}
+	if len(req.Package) > 0 {
+		// 试运行不保存代码包
+		pkg, err := s.platform.InspectPackage(req.Package)
+		if err != nil {
+			c.JSON(errorResponse("校验失败", err))
+			return
+		}
+		fn.Package = pkg
+	}
+
+	diagnostics, err := s.platform.ValidateFunction(fn)
+	if err != nil {
+		c.JSON(errorResponse("校验失败", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"valid":       true,
+		"diagnostics": diagnostics,
+	})
+}
+
+// listFunctions 列出函数，支持过滤、排序和游标分页：
+// ?namespace=&runtime=&name_prefix=&label=env=prod&sort=name|created|updated&order=asc|desc&limit=&cursor=
 func (s *Server) listFunctions(c *gin.Context) {
-	functions := s.platform.ListFunctions()
+	filters := map[string]interface{}{
+		FilterNamespace:  c.Query("namespace"),
+		FilterRuntime:    c.Query("runtime"),
+		FilterNamePrefix: c.Query("name_prefix"),
+		FilterSort:       c.Query("sort"),
+		FilterOrder:      c.Query("order"),
+		FilterCursor:     c.Query("cursor"),
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的每页数量: " + limit})
+			return
+		}
+		filters[FilterLimit] = value
+	}
+
+	// 标签过滤：label=key=value 或 label=key（只要求存在），可重复
+	if values := c.QueryArray("label"); len(values) > 0 {
+		labels := make(map[string]string, len(values))
+		for _, value := range values {
+			key, val, _ := strings.Cut(value, "=")
+			labels[key] = val
+		}
+		filters[FilterLabels] = labels
+	}
+
+	page, err := s.platform.QueryFunctions(filters)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"functions": functions,
-		"count":     len(functions),
+		"functions":   s.platform.redactedFunctions(page.Functions),
+		"count":       len(page.Functions),
+		"total":       page.Total,
+		"next_cursor": page.NextCursor,
 	})
 }
 
 // getFunction 获取函数详情
 func (s *Server) getFunction(c *gin.Context) {
-	id := c.Param("id")
+	id := functionID(c)
 	fn, err := s.platform.GetFunction(id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"function": fn})
+	c.JSON(http.StatusOK, gin.H{"function": s.platform.redactedFunction(fn)})
 }
 
 // updateFunction 更新函数
 func (s *Server) updateFunction(c *gin.Context) {
-	id := c.Param("id")
+	id := functionID(c)
 
 	var req struct {
 		Name        string            `json:"name"`
 		Runtime     string            `json:"runtime"`
 		Code        string            `json:"code"`
+		Layers      []LayerRef        `json:"layers"` // 设置为空数组时取消引用所有层
 		Handler     string            `json:"handler"`
 		Environment map[string]string `json:"environment"`
+		Labels      map[string]string `json:"labels"`
 		Timeout     int               `json:"timeout"`
 		Memory      int               `json:"memory"`
+		Sandbox     *bool             `json:"sandbox"`
+		Network     *NetworkPolicy    `json:"network"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -155,14 +338,23 @@ func (s *Server) updateFunction(c *gin.Context) {
 
 	// 更新字段（只更新非空字段）
 	fn := *existing
-	if req.Name != "" {
+	if req.Name != "" && req.Name != existing.Name {
+		if err := validateFunctionName(req.Name); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		fn.Name = req.Name
 	}
 	if req.Runtime != "" {
 		fn.Runtime = req.Runtime
 	}
 	if req.Code != "" {
+		// 设置代码后不再使用代码包
 		fn.Code = req.Code
+		fn.Package = nil
+	}
+	if req.Layers != nil {
+		fn.Layers = req.Layers
 	}
 	if req.Handler != "" {
 		fn.Handler = req.Handler
@@ -170,27 +362,40 @@ func (s *Server) updateFunction(c *gin.Context) {
 	if req.Environment != nil {
 		fn.Environment = req.Environment
 	}
+	if req.Labels != nil {
+		if err := validateLabels(req.Labels); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		fn.Labels = req.Labels
+	}
 	if req.Timeout > 0 {
 		fn.Timeout = req.Timeout
 	}
 	if req.Memory > 0 {
 		fn.Memory = req.Memory
 	}
+	if req.Sandbox != nil {
+		fn.Sandbox = req.Sandbox
+	}
+	if req.Network != nil {
+		fn.Network = req.Network
+	}
 
 	if err := s.platform.UpdateFunction(id, &fn); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新函数失败: " + err.Error()})
+		c.JSON(errorResponse("更新函数失败", err))
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"message":  "函数更新成功",
-		"function": &fn,
+		"function": s.platform.redactedFunction(&fn),
 	})
 }
 
 // deleteFunction 删除函数
 func (s *Server) deleteFunction(c *gin.Context) {
-	id := c.Param("id")
+	id := functionID(c)
 
 	if err := s.platform.DeleteFunction(id); err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
@@ -202,8 +407,11 @@ func (s *Server) deleteFunction(c *gin.Context) {
 
 // invokeFunction 调用函数
 func (s *Server) invokeFunction(c *gin.Context) {
-	id := c.Param("id")
+	s.invoke(c, functionID(c))
+}
 
+// invoke 执行带限定符的函数引用并返回结果
+func (s *Server) invoke(c *gin.Context, id string) {
 	var req ExecuteRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
@@ -212,7 +420,11 @@ func (s *Server) invokeFunction(c *gin.Context) {
 
 	response, err := s.platform.ExecuteFunction(id, &req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "函数执行失败: " + err.Error()})
+		status, body := errorResponse("函数执行失败", err)
+		if status == http.StatusServiceUnavailable {
+			c.Header("Retry-After", "1")
+		}
+		c.JSON(status, body)
 		return
 	}
 
@@ -223,6 +435,34 @@ func (s *Server) invokeFunction(c *gin.Context) {
 	}
 }
 
+// qualifiedRoutes 路径中的函数引用可以带限定符（版本号或别名）的路由
+var qualifiedRoutes = map[string]bool{
+	"/api/v1/functions/:id/invoke": true,
+}
+
+// resolveFunctionRef 将路径中的函数名称或ID解析为函数ID；只有调用接口接受带限定符的引用，
+// 其他接口操作的是函数本身，带限定符时返回 400
+func (s *Server) resolveFunctionRef(c *gin.Context) {
+	namespace := c.DefaultQuery("namespace", DefaultNamespace)
+	if _, qualifier := splitQualifier(c.Param("id")); qualifier != "" && !qualifiedRoutes[c.FullPath()] {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("该接口不支持限定符 :%s，请使用函数ID或名称", qualifier)})
+		return
+	}
+
+	id, renamedTo, err := s.platform.ResolveFunctionID(namespace, c.Param("id"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if renamedTo != "" {
+		// 旧名称仍在宽限期内，提示调用方改用新名称
+		c.Header("X-Function-Renamed-To", renamedTo)
+	}
+
+	c.Set(functionIDKey, id)
+	c.Next()
+}
+
 // healthCheck 健康检查
 func (s *Server) healthCheck(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
@@ -243,3 +483,43 @@ func (s *Server) Run(port int) error {
 	fmt.Printf("云函数平台启动在端口 %d\n", port)
 	return s.router.Run(addr)
 }
+
+// functionID 获取由 resolveFunctionRef 解析出的函数ID（只有调用接口可能带限定符）
+func functionID(c *gin.Context) string {
+	return c.GetString(functionIDKey)
+}
+
+// bindOptionalJSON 解析可选的JSON请求体，没有请求体（包括分块传输的空请求体）时保留默认值
+func bindOptionalJSON(c *gin.Context, obj interface{}) error {
+	if err := c.ShouldBindJSON(obj); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// errorResponse 根据平台错误生成HTTP状态码和响应体，校验错误附带诊断信息
+func errorResponse(prefix string, err error) (int, gin.H) {
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		return http.StatusUnprocessableEntity, gin.H{
+			"error":       prefix + ": " + validationErr.Message,
+			"diagnostics": validationErr.Diagnostics,
+		}
+	}
+	// 构建未完成时稍后重试，构建失败时需要重新部署
+	var notReady *BuildNotReadyError
+	if errors.As(err, &notReady) {
+		status := http.StatusServiceUnavailable
+		if notReady.Build.State == BuildFailed {
+			status = http.StatusConflict
+		}
+		return status, gin.H{"error": prefix + ": " + err.Error(), "build": notReady.Build}
+	}
+	if errors.Is(err, ErrNameTaken) || errors.Is(err, ErrSecretInUse) || errors.Is(err, ErrLayerInUse) || errors.Is(err, ErrFunctionModified) {
+		return http.StatusConflict, gin.H{"error": prefix + ": " + err.Error()}
+	}
+	if errors.Is(err, ErrSecretsDisabled) {
+		return http.StatusServiceUnavailable, gin.H{"error": prefix + ": " + err.Error()}
+	}
+	return http.StatusInternalServerError, gin.H{"error": prefix + ": " + err.Error()}
+}
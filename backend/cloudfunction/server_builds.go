@@ -0,0 +1,35 @@
+package cloudfunction
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// listBuilds 按时间倒序列出函数的构建记录（不含构建日志）
+func (s *Server) listBuilds(c *gin.Context) {
+	id := functionID(c)
+	fn, err := s.platform.GetFunction(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	builds := s.platform.ListBuilds(id)
+	c.JSON(http.StatusOK, gin.H{
+		"builds":        builds,
+		"count":         len(builds),
+		"current_build": fn.BuildID,
+	})
+}
+
+// getBuild 获取构建状态和完整的构建日志
+func (s *Server) getBuild(c *gin.Context) {
+	build, err := s.platform.GetBuild(functionID(c), c.Param("buildId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"build": build})
+}
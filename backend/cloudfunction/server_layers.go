@@ -0,0 +1,96 @@
+package cloudfunction
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// listLayers 列出所有层
+func (s *Server) listLayers(c *gin.Context) {
+	layers := s.platform.ListLayers()
+	c.JSON(http.StatusOK, gin.H{
+		"layers": layers,
+		"count":  len(layers),
+	})
+}
+
+// getLayer 获取层的所有版本及引用各版本的函数
+func (s *Server) getLayer(c *gin.Context) {
+	layer, err := s.platform.GetLayer(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"layer": layer,
+		"usage": s.platform.LayerUsage(layer.Name),
+	})
+}
+
+// publishLayerVersion 上传压缩包（zip 或 tar.gz）作为层的新版本，层不存在时自动创建。
+// 请求体格式与函数代码包相同，?description= 为版本说明
+func (s *Server) publishLayerVersion(c *gin.Context) {
+	data, err := s.readPackageBody(c)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error": fmt.Sprintf("层超过大小限制 %dMB", s.platform.options.MaxPackageSize),
+			})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "读取层失败: " + err.Error()})
+		return
+	}
+
+	version, err := s.platform.PublishLayerVersion(c.Param("name"), c.Query("description"), data)
+	if err != nil {
+		c.JSON(errorResponse("发布层版本失败", err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "层版本发布成功",
+		"layer":   c.Param("name"),
+		"version": version,
+	})
+}
+
+// deleteLayerVersion 删除层版本，仍被函数或已发布版本引用时拒绝
+func (s *Server) deleteLayerVersion(c *gin.Context) {
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的版本号: " + c.Param("version")})
+		return
+	}
+
+	if err := s.platform.DeleteLayerVersion(c.Param("name"), version); err != nil {
+		status, body := errorResponse("删除层版本失败", err)
+		if status == http.StatusInternalServerError {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, body)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "层版本删除成功"})
+}
+
+// deleteLayer 删除层及其所有版本，任一版本仍被引用时拒绝
+func (s *Server) deleteLayer(c *gin.Context) {
+	if err := s.platform.DeleteLayer(c.Param("name")); err != nil {
+		status, body := errorResponse("删除层失败", err)
+		if status == http.StatusInternalServerError {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, body)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "层删除成功"})
+}
@@ -0,0 +1,97 @@
+package cloudfunction
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// uploadPackage 上传函数的代码包（zip 或 tar.gz），替换函数当前的代码。
+// 请求体可以是压缩包本身，也可以是 multipart 表单中的 package 文件；?handler= 可同时修改入口
+func (s *Server) uploadPackage(c *gin.Context) {
+	id := functionID(c)
+	if _, err := s.platform.GetFunction(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	data, err := s.readPackageBody(c)
+	if err != nil {
+		if s.packageTooLarge(c, err) {
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "读取代码包失败: " + err.Error()})
+		return
+	}
+
+	fn, err := s.platform.UploadPackage(id, data, c.Query("handler"))
+	if err != nil {
+		c.JSON(errorResponse("上传代码包失败", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "代码包上传成功",
+		"function": s.platform.redactedFunction(fn),
+	})
+}
+
+// downloadPackage 下载函数当前的代码包
+func (s *Server) downloadPackage(c *gin.Context) {
+	path, pkg, err := s.platform.PackageArchive(functionID(c))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.FileAttachment(path, functionID(c)+"."+pkg.Format)
+}
+
+// limitInlinePackageBody 限制内联 base64 代码包的JSON请求体大小，在解码代码包之前拒绝过大的请求：
+// base64 编码后为原大小的 4/3，JSON 转义后的代码最多为原大小的 6 倍，其余字段另外留出余量
+func (s *Server) limitInlinePackageBody(c *gin.Context) {
+	options := s.platform.options
+	if options.MaxPackageSize <= 0 {
+		return
+	}
+	limit := (options.MaxPackageSize*1024*1024+2)/3*4 + options.MaxCodeSize*1024*6 + 64*1024
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+}
+
+// packageTooLarge 请求体超过大小限制时返回 413，返回是否已响应
+func (s *Server) packageTooLarge(c *gin.Context, err error) bool {
+	var maxErr *http.MaxBytesError
+	if !errors.As(err, &maxErr) {
+		return false
+	}
+	c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+		"error": fmt.Sprintf("代码包超过大小限制 %dMB", s.platform.options.MaxPackageSize),
+	})
+	return true
+}
+
+// readPackageBody 读取请求中的代码包，超过大小限制时返回 *http.MaxBytesError
+func (s *Server) readPackageBody(c *gin.Context) ([]byte, error) {
+	if limit := s.platform.options.MaxPackageSize * 1024 * 1024; limit > 0 {
+		// multipart 表单的边界和字段另外留出余量
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit+64*1024)
+	}
+
+	if !strings.HasPrefix(c.ContentType(), "multipart/") {
+		return io.ReadAll(c.Request.Body)
+	}
+
+	header, err := c.FormFile("package")
+	if err != nil {
+		return nil, err
+	}
+	file, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
@@ -0,0 +1,71 @@
+package cloudfunction
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// listSecrets 列出所有密钥（不含密钥值）
+func (s *Server) listSecrets(c *gin.Context) {
+	secrets := s.platform.Secrets().List()
+	c.JSON(http.StatusOK, gin.H{
+		"secrets": secrets,
+		"count":   len(secrets),
+		"enabled": s.platform.Secrets().Enabled(),
+	})
+}
+
+// putSecret 创建或更新密钥
+func (s *Server) putSecret(c *gin.Context) {
+	var req struct {
+		Value string `json:"value" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+
+	info, err := s.platform.Secrets().Put(c.Param("name"), req.Value)
+	if err != nil {
+		status, body := errorResponse("保存密钥失败", err)
+		if status == http.StatusInternalServerError {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, body)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "密钥保存成功",
+		"secret":  info,
+	})
+}
+
+// deleteSecret 删除密钥，仍被函数引用时拒绝
+func (s *Server) deleteSecret(c *gin.Context) {
+	if err := s.platform.DeleteSecret(c.Param("name")); err != nil {
+		status, body := errorResponse("删除密钥失败", err)
+		if status == http.StatusInternalServerError {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, body)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "密钥删除成功"})
+}
+
+// rotateSecrets 使用当前主密钥重新加密所有密钥
+func (s *Server) rotateSecrets(c *gin.Context) {
+	count, err := s.platform.Secrets().Rotate()
+	if err != nil {
+		c.JSON(errorResponse("轮换主密钥失败", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "主密钥轮换完成",
+		"rotated": count,
+	})
+}
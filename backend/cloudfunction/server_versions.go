@@ -0,0 +1,163 @@
+package cloudfunction
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// publishVersion 发布函数的新版本
+func (s *Server) publishVersion(c *gin.Context) {
+	id := functionID(c)
+
+	var req struct {
+		Description string `json:"description"`
+	}
+	// 请求体可选
+	if err := bindOptionalJSON(c, &req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+
+	version, err := s.platform.PublishVersion(id, req.Description)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "发布版本失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "版本发布成功",
+		"version": s.platform.redactedVersion(version),
+	})
+}
+
+// listVersions 列出函数的所有版本
+func (s *Server) listVersions(c *gin.Context) {
+	versions, err := s.platform.ListVersions(functionID(c))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"versions": s.platform.redactedVersions(versions),
+		"count":    len(versions),
+	})
+}
+
+// getVersion 获取函数的指定版本
+func (s *Server) getVersion(c *gin.Context) {
+	number, ok := parseVersionParam(c)
+	if !ok {
+		return
+	}
+
+	version, err := s.platform.GetVersion(functionID(c), number)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"version": s.platform.redactedVersion(version)})
+}
+
+// invokeVersion 调用函数的指定版本
+func (s *Server) invokeVersion(c *gin.Context) {
+	number, ok := parseVersionParam(c)
+	if !ok {
+		return
+	}
+	s.invoke(c, functionID(c)+":"+strconv.Itoa(number))
+}
+
+// listAliases 列出函数的所有别名
+func (s *Server) listAliases(c *gin.Context) {
+	aliases, err := s.platform.ListAliases(functionID(c))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"aliases": aliases,
+		"count":   len(aliases),
+	})
+}
+
+// setAlias 创建或更新别名
+func (s *Server) setAlias(c *gin.Context) {
+	var req struct {
+		Version     int           `json:"version" binding:"required"`
+		Description string        `json:"description"`
+		Routing     *AliasRouting `json:"routing"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+
+	alias, err := s.platform.SetAlias(functionID(c), c.Param("alias"), req.Version, req.Description, req.Routing)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "设置别名失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "别名设置成功",
+		"alias":   alias,
+	})
+}
+
+// rollbackAlias 将别名回滚到之前的版本
+func (s *Server) rollbackAlias(c *gin.Context) {
+	var req struct {
+		Version int `json:"version"` // 为空时回退到上一次指向的版本
+	}
+	if err := bindOptionalJSON(c, &req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+
+	alias, err := s.platform.RollbackAlias(functionID(c), c.Param("alias"), req.Version)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "回滚别名失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "别名回滚成功",
+		"alias":   alias,
+	})
+}
+
+// aliasStats 获取别名各版本的成功率和延迟统计
+func (s *Server) aliasStats(c *gin.Context) {
+	stats, err := s.platform.AliasStats(functionID(c), c.Param("alias"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"revisions": stats})
+}
+
+// deleteAlias 删除别名
+func (s *Server) deleteAlias(c *gin.Context) {
+	if err := s.platform.DeleteAlias(functionID(c), c.Param("alias")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "别名删除成功"})
+}
+
+// parseVersionParam 解析路径中的版本号，失败时直接写入错误响应
+func parseVersionParam(c *gin.Context) (int, bool) {
+	number, err := strconv.Atoi(c.Param("version"))
+	if err != nil || number < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的版本号: " + c.Param("version")})
+		return 0, false
+	}
+	return number, true
+}
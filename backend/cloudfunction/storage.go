@@ -2,6 +2,8 @@ package cloudfunction
 
 import (
 	"context"
+	"fmt"
+	"os"
 	"time"
 )
 
@@ -12,7 +14,7 @@ type Storage interface {
 	GetFunction(ctx context.Context, id string) (*Function, error)
 	UpdateFunction(ctx context.Context, fn *Function) error
 	DeleteFunction(ctx context.Context, id string) error
-	ListFunctions(ctx context.Context, filters map[string]interface{}) ([]*Function, error)
+	ListFunctions(ctx context.Context, filters map[string]interface{}) (*FunctionPage, error)
 
 	// 代码存储
 	SaveFunctionCode(ctx context.Context, functionID string, runtime string, code []byte) error
@@ -90,8 +92,21 @@ func (f *FileStorage) DeleteFunction(ctx context.Context, id string) error {
 	return nil
 }
 
-func (f *FileStorage) ListFunctions(ctx context.Context, filters map[string]interface{}) ([]*Function, error) {
-	return nil, nil
+// ListFunctions 从数据文件读取函数并按 filters 过滤、排序和分页（支持的键见 listing.go 中的 Filter* 常量），
+// 返回的分页结果包含总数和下一页的游标
+func (f *FileStorage) ListFunctions(ctx context.Context, filters map[string]interface{}) (*FunctionPage, error) {
+	data, err := os.ReadFile(f.dataFile)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("读取数据文件失败: %v", err)
+	}
+
+	var functions []*Function
+	if len(data) > 0 {
+		if functions, err = decodeFunctions(data); err != nil {
+			return nil, err
+		}
+	}
+	return queryFunctions(functions, filters)
 }
 
 func (f *FileStorage) SaveFunctionCode(ctx context.Context, functionID string, runtime string, code []byte) error {
@@ -0,0 +1,154 @@
+package cloudfunction
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// 金丝雀自动回滚的默认参数
+const (
+	defaultCanaryWindow         = 60 // 秒
+	defaultCanaryMinInvocations = 10
+)
+
+// AliasRouting 别名的加权流量分配，将部分调用路由到第二个版本
+type AliasRouting struct {
+	AdditionalVersion int           `json:"additional_version"`
+	Weight            float64       `json:"weight"` // 分配给 AdditionalVersion 的流量百分比(0-100)
+	AutoRollback      *CanaryPolicy `json:"auto_rollback,omitempty"`
+}
+
+// CanaryPolicy 金丝雀版本的自动回滚策略
+type CanaryPolicy struct {
+	ErrorThreshold float64 `json:"error_threshold"` // 错误率阈值(百分比)，超过则回滚
+	Window         int     `json:"window"`          // 统计窗口(秒)
+	MinInvocations int     `json:"min_invocations"` // 窗口内至少需要的调用次数
+}
+
+// CanaryRollback 自动回滚记录
+type CanaryRollback struct {
+	Version     int       `json:"version"`
+	ErrorRate   float64   `json:"error_rate_percent"`
+	Invocations int       `json:"invocations"`
+	Reason      string    `json:"reason"`
+	At          time.Time `json:"at"`
+}
+
+// validateRouting 校验并补全别名的流量分配配置
+func validateRouting(fn *Function, version int, routing *AliasRouting) error {
+	if routing == nil {
+		return nil
+	}
+	if routing.AdditionalVersion == version {
+		return fmt.Errorf("流量分配的版本不能与别名主版本相同: %d", version)
+	}
+	if _, err := fn.findVersion(routing.AdditionalVersion); err != nil {
+		return err
+	}
+	if routing.Weight < 0 || routing.Weight > 100 {
+		return fmt.Errorf("流量权重必须在0-100之间: %v", routing.Weight)
+	}
+
+	if policy := routing.AutoRollback; policy != nil {
+		if policy.ErrorThreshold <= 0 || policy.ErrorThreshold > 100 {
+			return fmt.Errorf("错误率阈值必须在0-100之间: %v", policy.ErrorThreshold)
+		}
+		if policy.Window < 0 || policy.MinInvocations < 0 {
+			return fmt.Errorf("统计窗口和最小调用次数不能为负数")
+		}
+		if policy.Window == 0 {
+			policy.Window = defaultCanaryWindow
+		}
+		if policy.MinInvocations == 0 {
+			policy.MinInvocations = defaultCanaryMinInvocations
+		}
+	}
+
+	return nil
+}
+
+// pickVersion 按权重选择本次调用的版本
+func (a *Alias) pickVersion() int {
+	if a.Routing == nil || a.Routing.Weight <= 0 {
+		return a.Version
+	}
+	if rand.Float64()*100 < a.Routing.Weight {
+		return a.Routing.AdditionalVersion
+	}
+	return a.Version
+}
+
+// checkCanary 在金丝雀版本执行后检查错误率，超过阈值时自动回滚到稳定版本。
+// 只统计通过该别名路由到金丝雀版本的调用，直接按版本号调用不影响判断
+func (p *Platform) checkCanary(id, aliasName string, version int) {
+	fn, err := p.GetFunction(id)
+	if err != nil {
+		return
+	}
+	alias, ok := fn.Aliases[aliasName]
+	if !ok || alias.Routing == nil || alias.Routing.AutoRollback == nil || alias.Routing.AdditionalVersion != version {
+		return
+	}
+
+	policy := alias.Routing.AutoRollback
+	window := time.Duration(policy.Window) * time.Second
+	rate, count := GlobalMetrics.AliasErrorRate(id, aliasName, version, window)
+	if count < policy.MinInvocations || rate <= policy.ErrorThreshold {
+		return
+	}
+
+	rollback := &CanaryRollback{
+		Version:     version,
+		ErrorRate:   rate,
+		Invocations: count,
+		Reason:      fmt.Sprintf("%d秒内错误率 %.1f%% 超过阈值 %.1f%%", policy.Window, rate, policy.ErrorThreshold),
+		At:          time.Now(),
+	}
+	if err := p.rollbackCanary(id, aliasName, version, rollback); err != nil {
+		Error("金丝雀回滚失败: 函数 %s 别名 %s: %v", id, aliasName, err)
+		return
+	}
+	Warn("金丝雀自动回滚: 函数 %s 别名 %s 停止向版本 %d 分配流量，%s", id, aliasName, version, rollback.Reason)
+}
+
+// rollbackCanary 清除别名的流量分配，只保留稳定版本
+func (p *Platform) rollbackCanary(id, aliasName string, version int, rollback *CanaryRollback) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	existing, exists := p.functions[id]
+	if !exists {
+		return fmt.Errorf("函数不存在: %s", id)
+	}
+	old, ok := existing.Aliases[aliasName]
+	// 并发调用可能已经完成回滚
+	if !ok || old.Routing == nil || old.Routing.AdditionalVersion != version {
+		return nil
+	}
+
+	alias := *old
+	alias.Routing = nil
+	alias.LastRollback = rollback
+	alias.UpdatedAt = time.Now()
+
+	return p.storeAlias(existing, &alias)
+}
+
+// AliasStats 获取别名涉及的各版本执行统计
+func (p *Platform) AliasStats(id, aliasName string) ([]RevisionSnapshot, error) {
+	fn, err := p.GetFunction(id)
+	if err != nil {
+		return nil, err
+	}
+	alias, ok := fn.Aliases[aliasName]
+	if !ok {
+		return nil, fmt.Errorf("别名不存在: %s", aliasName)
+	}
+
+	stats := []RevisionSnapshot{GlobalMetrics.GetRevisionSnapshot(id, alias.Version)}
+	if alias.Routing != nil {
+		stats = append(stats, GlobalMetrics.GetRevisionSnapshot(id, alias.Routing.AdditionalVersion))
+	}
+	return stats, nil
+}
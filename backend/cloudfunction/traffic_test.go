@@ -0,0 +1,220 @@
+package cloudfunction
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPickVersionWeights(t *testing.T) {
+	for _, weight := range []float64{0, 10, 50, 100} {
+		alias := &Alias{Version: 1, Routing: &AliasRouting{AdditionalVersion: 2, Weight: weight}}
+		const n = 20000
+		canary := 0
+		for i := 0; i < n; i++ {
+			if alias.pickVersion() == 2 {
+				canary++
+			}
+		}
+		got := float64(canary) * 100 / n
+		if math.Abs(got-weight) > 2 {
+			t.Errorf("权重 %v%% 时实际分配 %.1f%%", weight, got)
+		}
+	}
+
+	if (&Alias{Version: 3}).pickVersion() != 3 {
+		t.Error("没有流量分配时应始终选择主版本")
+	}
+}
+
+func TestValidateRouting(t *testing.T) {
+	fn := &Function{ID: "fn_routing", Versions: []*FunctionVersion{{Version: 1}, {Version: 2}}}
+
+	invalid := map[string]*AliasRouting{
+		"与主版本相同":  {AdditionalVersion: 1, Weight: 10},
+		"版本不存在":   {AdditionalVersion: 3, Weight: 10},
+		"负权重":     {AdditionalVersion: 2, Weight: -1},
+		"权重超过100": {AdditionalVersion: 2, Weight: 101},
+		"阈值为0":    {AdditionalVersion: 2, Weight: 10, AutoRollback: &CanaryPolicy{}},
+		"负窗口":     {AdditionalVersion: 2, Weight: 10, AutoRollback: &CanaryPolicy{ErrorThreshold: 5, Window: -1}},
+	}
+	for name, routing := range invalid {
+		if err := validateRouting(fn, 1, routing); err == nil {
+			t.Errorf("%s: validateRouting 应返回错误", name)
+		}
+	}
+
+	routing := &AliasRouting{AdditionalVersion: 2, Weight: 10, AutoRollback: &CanaryPolicy{ErrorThreshold: 5}}
+	if err := validateRouting(fn, 1, routing); err != nil {
+		t.Fatal(err)
+	}
+	if routing.AutoRollback.Window != defaultCanaryWindow || routing.AutoRollback.MinInvocations != defaultCanaryMinInvocations {
+		t.Fatalf("未设置的回滚参数应使用默认值: %+v", routing.AutoRollback)
+	}
+}
+
+func TestCanaryRollback(t *testing.T) {
+	p := newTestPlatform(t)
+	fn := newNodeFunction("canary", "function handler() { return 1; }")
+	if err := p.CreateFunction(fn); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.PublishVersion(fn.ID, "稳定版本"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.UpdateFunction(fn.ID, newNodeFunction("canary", "function handler() { throw new Error('broken'); }")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.PublishVersion(fn.ID, "有问题的版本"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 所有流量都分配给金丝雀版本，4次调用中失败超过一半时回滚
+	routing := &AliasRouting{
+		AdditionalVersion: 2,
+		Weight:            100,
+		AutoRollback:      &CanaryPolicy{ErrorThreshold: 50, Window: 60, MinInvocations: 4},
+	}
+	if _, err := p.SetAlias(fn.ID, "prod", 1, "", routing); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 4; i++ {
+		waitForBuilds(t, p)
+		resp, err := p.ExecuteFunction(fn.ID+":prod", &ExecuteRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Success || resp.Version != 2 {
+			t.Fatalf("第%d次调用: success=%v version=%d, want 金丝雀版本失败", i, resp.Success, resp.Version)
+		}
+
+		alias := p.functions[fn.ID].Aliases["prod"]
+		if i < 4 && alias.Routing == nil {
+			t.Fatalf("调用次数不足 %d 次时不应回滚", i)
+		}
+	}
+
+	alias := p.functions[fn.ID].Aliases["prod"]
+	if alias.Routing != nil || alias.LastRollback == nil {
+		t.Fatalf("金丝雀版本应被回滚: %+v", alias)
+	}
+	if alias.LastRollback.Version != 2 || alias.LastRollback.Invocations != 4 || alias.LastRollback.ErrorRate != 100 {
+		t.Fatalf("回滚记录 = %+v", alias.LastRollback)
+	}
+
+	waitForBuilds(t, p)
+	resp, err := p.ExecuteFunction(fn.ID+":prod", &ExecuteRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Success || resp.Version != 1 {
+		t.Fatalf("回滚后应执行稳定版本: %+v", resp)
+	}
+}
+
+func TestCanaryIgnoresDirectVersionCalls(t *testing.T) {
+	p := newTestPlatform(t)
+	fn := newNodeFunction("canary-direct", "function handler() { return 1; }")
+	if err := p.CreateFunction(fn); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.PublishVersion(fn.ID, "稳定版本"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.UpdateFunction(fn.ID, newNodeFunction("canary-direct", "function handler(event) { if (event.fail) throw new Error('broken'); return 2; }")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.PublishVersion(fn.ID, "金丝雀版本"); err != nil {
+		t.Fatal(err)
+	}
+	routing := &AliasRouting{
+		AdditionalVersion: 2,
+		Weight:            100,
+		AutoRollback:      &CanaryPolicy{ErrorThreshold: 50, Window: 60, MinInvocations: 2},
+	}
+	if _, err := p.SetAlias(fn.ID, "prod", 1, "", routing); err != nil {
+		t.Fatal(err)
+	}
+
+	execute := func(ref string, fail bool) {
+		t.Helper()
+		waitForBuilds(t, p)
+		if _, err := p.ExecuteFunction(ref, &ExecuteRequest{Event: map[string]interface{}{"fail": fail}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 直接调用版本2失败，不计入别名的金丝雀统计
+	for i := 0; i < 4; i++ {
+		execute(fn.ID+":2", true)
+	}
+	for i := 0; i < 2; i++ {
+		execute(fn.ID+":prod", false)
+	}
+	if alias := p.functions[fn.ID].Aliases["prod"]; alias.Routing == nil {
+		t.Fatalf("直接调用版本的失败触发了回滚: %+v", alias.LastRollback)
+	}
+	if rate, count := GlobalMetrics.AliasErrorRate(fn.ID, "prod", 2, time.Minute); rate != 0 || count != 2 {
+		t.Fatalf("别名统计 = %v%%, %d次", rate, count)
+	}
+
+	// 别名路由的调用错误率超过50%时回滚
+	for i := 0; i < 3; i++ {
+		execute(fn.ID+":prod", true)
+	}
+	alias := p.functions[fn.ID].Aliases["prod"]
+	if alias.Routing != nil || alias.LastRollback == nil || alias.LastRollback.Invocations != 5 {
+		t.Fatalf("金丝雀版本应被回滚: %+v", alias)
+	}
+
+	// 重新配置流量分配后之前的调用不再参与判断
+	if _, err := p.SetAlias(fn.ID, "prod", 1, "", routing); err != nil {
+		t.Fatal(err)
+	}
+	if _, count := GlobalMetrics.AliasErrorRate(fn.ID, "prod", 2, time.Minute); count != 0 {
+		t.Fatalf("重新配置后仍保留 %d 次调用的统计", count)
+	}
+	execute(fn.ID+":prod", false)
+	if alias := p.functions[fn.ID].Aliases["prod"]; alias.Routing == nil {
+		t.Fatal("重新配置后立即被回滚")
+	}
+}
+
+func TestRevisionStatsForgottenWithFunction(t *testing.T) {
+	p := newTestPlatform(t)
+	fn := newNodeFunction("forget-stats", "function handler() { return 1; }")
+	if err := p.CreateFunction(fn); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.PublishVersion(fn.ID, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.SetAlias(fn.ID, "prod", 1, "", nil); err != nil {
+		t.Fatal(err)
+	}
+	waitForBuilds(t, p)
+	if _, err := p.ExecuteFunction(fn.ID+":prod", &ExecuteRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if GlobalMetrics.GetRevisionSnapshot(fn.ID, 1).Invocations != 1 {
+		t.Fatal("没有记录版本统计")
+	}
+
+	if err := p.DeleteFunction(fn.ID); err != nil {
+		t.Fatal(err)
+	}
+	GlobalMetrics.mu.RLock()
+	defer GlobalMetrics.mu.RUnlock()
+	for key := range GlobalMetrics.revisions {
+		if strings.HasPrefix(key, fn.ID+":") {
+			t.Fatalf("删除函数后仍保留版本统计 %s", key)
+		}
+	}
+	for key := range GlobalMetrics.aliasRevisions {
+		if strings.HasPrefix(key, fn.ID+":") {
+			t.Fatalf("删除函数后仍保留别名统计 %s", key)
+		}
+	}
+}
@@ -0,0 +1,456 @@
+package cloudfunction
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// codeCheckTimeout 部署时编译/语法检查的超时时间
+const codeCheckTimeout = 60 * time.Second
+
+// 诊断信息的严重级别
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+var (
+	goIdentifierPattern     = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	jsIdentifierPattern     = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+	nodeESMPattern          = regexp.MustCompile(`(?m)^\s*(import\s*[\w{*'"]|export\s)`)
+	envNamePattern          = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	goDiagnosticPattern     = regexp.MustCompile(`^(?:\./)?([^:\s]+\.go):(\d+):(?:(\d+):)?\s*(.*)$`)
+	nodeDiagnosticPosition  = regexp.MustCompile(`^(.+):(\d+)$`)
+	pythonReservedWords     = map[string]bool{"False": true, "None": true, "True": true, "and": true, "as": true, "assert": true, "async": true, "await": true, "break": true, "class": true, "continue": true, "def": true, "del": true, "elif": true, "else": true, "except": true, "finally": true, "for": true, "from": true, "global": true, "if": true, "import": true, "in": true, "is": true, "lambda": true, "nonlocal": true, "not": true, "or": true, "pass": true, "raise": true, "return": true, "try": true, "while": true, "with": true, "yield": true}
+	javascriptReservedWords = map[string]bool{"break": true, "case": true, "catch": true, "class": true, "const": true, "continue": true, "debugger": true, "default": true, "delete": true, "do": true, "else": true, "export": true, "extends": true, "finally": true, "for": true, "function": true, "if": true, "import": true, "in": true, "instanceof": true, "new": true, "return": true, "super": true, "switch": true, "this": true, "throw": true, "try": true, "typeof": true, "var": true, "void": true, "while": true, "with": true, "yield": true, "let": true, "await": true}
+)
+
+// Diagnostic 校验或编译产生的诊断信息，行列号均相对于用户代码
+type Diagnostic struct {
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// ValidationError 函数配置或代码校验失败
+type ValidationError struct {
+	Message     string       `json:"error"`
+	Diagnostics []Diagnostic `json:"diagnostics,omitempty"`
+}
+
+func (e *ValidationError) Error() string {
+	if len(e.Diagnostics) == 0 {
+		return e.Message
+	}
+	d := e.Diagnostics[0]
+	if d.Line > 0 {
+		return fmt.Sprintf("%s: %s:%d:%d: %s", e.Message, d.File, d.Line, d.Column, d.Message)
+	}
+	return fmt.Sprintf("%s: %s", e.Message, d.Message)
+}
+
+// newValidationError 创建只包含一条错误的校验错误
+func newValidationError(format string, args ...interface{}) *ValidationError {
+	message := fmt.Sprintf(format, args...)
+	return &ValidationError{
+		Message:     "函数校验失败",
+		Diagnostics: []Diagnostic{{Severity: SeverityError, Message: message}},
+	}
+}
+
+// ValidateFunction 校验函数配置并对代码做编译/语法检查，用于不部署的校验；
+// 存在错误时返回 *ValidationError，否则返回警告级别的诊断信息
+func (p *Platform) ValidateFunction(fn *Function) ([]Diagnostic, error) {
+	return p.validateFunction(fn, true)
+}
+
+// validateDeployment 部署前的校验：Go函数只检查语法和入口函数签名，
+// 编译在异步构建中进行，编译错误记录在构建记录中
+func (p *Platform) validateDeployment(fn *Function) error {
+	_, err := p.validateFunction(fn, false)
+	return err
+}
+
+// validateFunction 校验函数配置并检查代码，compile 为 false 时不编译Go代码
+func (p *Platform) validateFunction(fn *Function, compile bool) ([]Diagnostic, error) {
+	if err := p.validateConfig(fn); err != nil {
+		return nil, err
+	}
+
+	diagnostics, err := p.checkCode(fn, compile)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, d := range diagnostics {
+		if d.Severity == SeverityError {
+			return nil, &ValidationError{Message: "代码检查失败", Diagnostics: diagnostics}
+		}
+	}
+	return diagnostics, nil
+}
+
+// validateConfig 校验运行时、代码大小、超时、内存、入口函数、环境变量和引用的层
+func (p *Platform) validateConfig(fn *Function) error {
+	if !p.runtimeEnabled(fn.Runtime) {
+		return newValidationError("不支持或未启用的运行时: %s（可用: %s）", fn.Runtime, strings.Join(p.options.EnabledRuntimes, ", "))
+	}
+
+	if fn.Package == nil {
+		switch fn.Runtime {
+		case "wasm":
+			return newValidationError("wasm 运行时需要上传 WebAssembly 模块或包含模块的代码包")
+		case "custom":
+			return newValidationError("custom 运行时需要上传根目录包含可执行文件 %s 的代码包", customBootstrapFile)
+		}
+	}
+	if fn.Package != nil {
+		// 代码包在上传时已校验大小和路径
+		if fn.Code != "" {
+			return newValidationError("代码包函数不能同时设置 code")
+		}
+	} else {
+		if strings.TrimSpace(fn.Code) == "" {
+			return newValidationError("函数代码不能为空")
+		}
+		if maxSize := p.options.MaxCodeSize * 1024; maxSize > 0 && int64(len(fn.Code)) > maxSize {
+			return newValidationError("函数代码大小 %d 字节超过限制 %dKB", len(fn.Code), p.options.MaxCodeSize)
+		}
+	}
+
+	if fn.Timeout < 1 || (p.options.MaxTimeout > 0 && fn.Timeout > p.options.MaxTimeout) {
+		return newValidationError("超时时间必须在1-%d秒之间: %d", p.options.MaxTimeout, fn.Timeout)
+	}
+	if fn.Memory < p.options.MinMemory || (p.options.MaxMemory > 0 && fn.Memory > p.options.MaxMemory) {
+		return newValidationError("内存限制必须在%d-%dMB之间: %d", p.options.MinMemory, p.options.MaxMemory, fn.Memory)
+	}
+
+	switch {
+	case fn.Runtime == "js-embedded" && (fn.Package != nil || len(fn.Layers) > 0):
+		return newValidationError("%s 运行时在平台进程内执行，只支持单文件代码，不能使用代码包和层", fn.Runtime)
+	case fn.Runtime == "wasm" && len(fn.Layers) > 0:
+		return newValidationError("wasm 运行时不能使用层")
+	case fn.Package != nil && fn.Package.Format == PackageFormatBinary && fn.Runtime != "go":
+		return newValidationError("上传的可执行文件只能用于 go 运行时，%s 运行时请上传代码包", fn.Runtime)
+	case prebuiltBinary(fn) && len(fn.Layers) > 0:
+		return newValidationError("预编译的Go函数不能使用层")
+	}
+	if prebuiltBinary(fn) {
+		// 可执行文件自行处理调用，入口只通过 FC_HANDLER 传入
+		if !customHandlerPattern.MatchString(fn.Handler) {
+			return newValidationError("无效的入口: %q", fn.Handler)
+		}
+	} else if fn.Package != nil {
+		if err := validatePackageHandler(fn.Runtime, fn.Handler); err != nil {
+			return err
+		}
+	} else if err := validateHandler(fn.Runtime, fn.Handler); err != nil {
+		return err
+	}
+
+	for key := range fn.Environment {
+		if !envNamePattern.MatchString(key) {
+			return newValidationError("无效的环境变量名: %s", key)
+		}
+		if isReservedEnv(key) {
+			return newValidationError("环境变量 %s 为平台保留，不能在函数中设置", key)
+		}
+	}
+
+	if err := p.validateLayerRefs(fn.Layers); err != nil {
+		return err
+	}
+
+	if err := validateNetworkPolicy(fn.Network); err != nil {
+		return err
+	}
+	// 嵌入式运行时不使用沙箱，网络策略由平台在 fetch 中检查
+	if !embeddedRuntime(fn.Runtime) && (p.sandboxEnabled(fn) || p.networkMode(fn) != NetworkUnrestricted) {
+		if err := SandboxAvailable(); err != nil {
+			return newValidationError("当前主机不支持函数沙箱和网络隔离: %v", err)
+		}
+	}
+
+	return p.validateSecretRefs(fn.Environment)
+}
+
+// runtimeEnabled 检查运行时是否已实现并在配置中启用
+func (p *Platform) runtimeEnabled(runtime string) bool {
+	switch runtime {
+	case "go", "nodejs", "python", "js-embedded", "wasm", "custom":
+	default:
+		return false
+	}
+	for _, enabled := range p.options.EnabledRuntimes {
+		if enabled == runtime {
+			return true
+		}
+	}
+	return false
+}
+
+// validateHandler 按运行时校验入口函数名的标识符语法
+func validateHandler(runtime, handler string) error {
+	var valid bool
+	switch runtime {
+	case "go":
+		valid = goIdentifierPattern.MatchString(handler) && handler != "main" && handler != "init"
+	case "nodejs", "js-embedded":
+		valid = jsIdentifierPattern.MatchString(handler) && !javascriptReservedWords[handler]
+	case "python":
+		// 可以是 handler.py 中对象的属性，如 service.handle
+		for _, part := range strings.Split(handler, ".") {
+			valid = goIdentifierPattern.MatchString(part) && !pythonReservedWords[part]
+			if !valid {
+				break
+			}
+		}
+	}
+	if !valid {
+		return newValidationError("无效的入口函数名: %q（%s运行时）", handler, runtime)
+	}
+	return nil
+}
+
+// checkCode 在临时目录中对代码或代码包的入口做编译或语法检查
+func (p *Platform) checkCode(fn *Function, compile bool) ([]Diagnostic, error) {
+	if err := os.MkdirAll(p.workDir, 0755); err != nil {
+		return nil, fmt.Errorf("创建工作目录失败: %v", err)
+	}
+	// 在工作目录下检查，保证与执行时使用相同的模块和工具链环境
+	dir, err := os.MkdirTemp(p.workDir, ".check-")
+	if err != nil {
+		return nil, fmt.Errorf("创建检查目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), codeCheckTimeout)
+	defer cancel()
+
+	// Go代码可能导入层中的模块，检查前解压引用的层
+	layers, err := p.prepareLayers(fn, "")
+	if err != nil {
+		return nil, newValidationError("%s", classifyError(err).Message)
+	}
+
+	if fn.Package != nil {
+		return p.checkPackage(ctx, dir, fn, layers, compile)
+	}
+
+	switch fn.Runtime {
+	case "go":
+		return p.checkGoCode(ctx, dir, fn, layers, compile)
+	case "nodejs":
+		return checkNodeJSCode(ctx, dir, fn)
+	case "python":
+		return checkPythonCode(ctx, dir, fn)
+	case "js-embedded":
+		return checkEmbeddedJSCode(fn)
+	}
+	return nil, nil
+}
+
+// checkGoCode 解析用户代码并检查入口函数签名，compile 为 true 时再使用 go build 和 go vet 检查生成的Go程序
+func (p *Platform) checkGoCode(ctx context.Context, dir string, fn *Function, layers []*preparedLayer, compile bool) ([]Diagnostic, error) {
+	source, err := goMainSource(fn)
+	if err != nil {
+		return nil, err
+	}
+	if !compile {
+		return nil, nil
+	}
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte(source), 0644); err != nil {
+		return nil, fmt.Errorf("写入main.go失败: %v", err)
+	}
+
+	if _, err := exec.LookPath("go"); err != nil {
+		return []Diagnostic{toolchainMissing("go")}, nil
+	}
+	if err := p.useGoLayers(ctx, dir, layers); err != nil {
+		return nil, newValidationError("%s", classifyError(err).Message)
+	}
+
+	buildCmd := exec.CommandContext(ctx, "go", "build", "-o", os.DevNull, "main.go")
+	buildCmd.Dir = dir
+	buildCmd.Env = p.goBuildEnv(dir)
+	if output, err := combinedOutput(buildCmd); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("编译检查超时")
+		}
+		return parseGoDiagnostics(output, SeverityError), nil
+	}
+
+	vetCmd := exec.CommandContext(ctx, "go", "vet", "main.go")
+	vetCmd.Dir = dir
+	vetCmd.Env = p.goBuildEnv(dir)
+	if output, err := combinedOutput(vetCmd); err != nil {
+		return parseGoDiagnostics(output, SeverityWarning), nil
+	}
+	return nil, nil
+}
+
+// checkNodeJSCode 使用 node --check 检查语法
+func checkNodeJSCode(ctx context.Context, dir string, fn *Function) ([]Diagnostic, error) {
+	name := nodeModuleFile(fn.Code)
+	file := filepath.Join(dir, name)
+	if err := os.WriteFile(file, []byte(fn.Code), 0644); err != nil {
+		return nil, fmt.Errorf("写入%s失败: %v", name, err)
+	}
+
+	return checkNodeJSFile(ctx, file, name)
+}
+
+// checkNodeJSFile 使用 node --check 检查文件语法，name 为诊断信息中显示的文件名
+func checkNodeJSFile(ctx context.Context, file, name string) ([]Diagnostic, error) {
+	if _, err := exec.LookPath("node"); err != nil {
+		return []Diagnostic{toolchainMissing("node")}, nil
+	}
+
+	cmd := exec.CommandContext(ctx, "node", "--check", file)
+	output, err := combinedOutput(cmd)
+	if err == nil {
+		return nil, nil
+	}
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("语法检查超时")
+	}
+	return []Diagnostic{parseNodeDiagnostic(output, name)}, nil
+}
+
+// pythonCheckScript 调用 py_compile 并以JSON输出语法错误位置
+const pythonCheckScript = `
+import json, py_compile, sys
+try:
+    py_compile.compile(sys.argv[1], doraise=True)
+except py_compile.PyCompileError as e:
+    err = e.exc_value
+    print(json.dumps({
+        "line": getattr(err, "lineno", 0) or 0,
+        "column": getattr(err, "offset", 0) or 0,
+        "message": "%s: %s" % (type(err).__name__, getattr(err, "msg", None) or str(err)),
+    }))
+    sys.exit(1)
+`
+
+// checkPythonCode 使用 py_compile 检查语法
+func checkPythonCode(ctx context.Context, dir string, fn *Function) ([]Diagnostic, error) {
+	file := filepath.Join(dir, "handler.py")
+	if err := os.WriteFile(file, []byte(fn.Code), 0644); err != nil {
+		return nil, fmt.Errorf("写入handler.py失败: %v", err)
+	}
+
+	return checkPythonFile(ctx, dir, file, "handler.py")
+}
+
+// checkPythonFile 使用 py_compile 检查文件语法，name 为诊断信息中显示的文件名
+func checkPythonFile(ctx context.Context, dir, file, name string) ([]Diagnostic, error) {
+	if _, err := exec.LookPath("python3"); err != nil {
+		return []Diagnostic{toolchainMissing("python3")}, nil
+	}
+
+	cmd := exec.CommandContext(ctx, "python3", "-c", pythonCheckScript, file)
+	cmd.Dir = dir
+	output, _, err := runCommand(ctx, cmd, 0)
+	if err == nil {
+		return nil, nil
+	}
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("语法检查超时")
+	}
+
+	var result struct {
+		Line    int    `json:"line"`
+		Column  int    `json:"column"`
+		Message string `json:"message"`
+	}
+	if jsonErr := json.Unmarshal(bytes.TrimSpace(output), &result); jsonErr != nil {
+		return []Diagnostic{{Severity: SeverityError, Message: fmt.Sprintf("语法检查失败: %v", err)}}, nil
+	}
+	return []Diagnostic{{
+		File:     name,
+		Line:     result.Line,
+		Column:   result.Column,
+		Severity: SeverityError,
+		Message:  result.Message,
+	}}, nil
+}
+
+// parseGoDiagnostics 解析 go build / go vet 的输出，只保留用户代码中的位置
+func parseGoDiagnostics(output []byte, severity string) []Diagnostic {
+	var diagnostics []Diagnostic
+	var extra []string
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		match := goDiagnosticPattern.FindStringSubmatch(line)
+		if match == nil {
+			extra = append(extra, line)
+			continue
+		}
+		lineNo, _ := strconv.Atoi(match[2])
+		column, _ := strconv.Atoi(match[3])
+		diagnostics = append(diagnostics, Diagnostic{
+			File:     filepath.Base(match[1]),
+			Line:     lineNo,
+			Column:   column,
+			Severity: severity,
+			Message:  match[4],
+		})
+	}
+
+	if len(diagnostics) == 0 {
+		message := strings.Join(extra, "\n")
+		if message == "" {
+			message = "编译失败"
+		}
+		diagnostics = append(diagnostics, Diagnostic{Severity: severity, Message: message})
+	}
+	return diagnostics
+}
+
+// parseNodeDiagnostic 解析 node --check 的输出：
+// 第一行为 "文件:行号"，随后是源码行和标记列位置的 ^ 行，最后是错误信息
+func parseNodeDiagnostic(output []byte, name string) Diagnostic {
+	diagnostic := Diagnostic{File: name, Severity: SeverityError, Message: "语法错误"}
+	lines := strings.Split(string(output), "\n")
+
+	if len(lines) > 0 {
+		if match := nodeDiagnosticPosition.FindStringSubmatch(lines[0]); match != nil {
+			diagnostic.Line, _ = strconv.Atoi(match[2])
+		}
+	}
+	for i, line := range lines {
+		if i > 0 && i <= 3 && strings.Contains(line, "^") && strings.Trim(line, " ^~\t") == "" {
+			diagnostic.Column = strings.Index(line, "^") + 1
+		}
+		if strings.Contains(line, "Error:") && !strings.HasPrefix(strings.TrimSpace(line), "at ") {
+			diagnostic.Message = strings.TrimSpace(line)
+			break
+		}
+	}
+	return diagnostic
+}
+
+// toolchainMissing 运行时工具链不可用时的警告
+func toolchainMissing(tool string) Diagnostic {
+	return Diagnostic{
+		Severity: SeverityWarning,
+		Message:  fmt.Sprintf("未找到 %s，跳过编译检查", tool),
+	}
+}
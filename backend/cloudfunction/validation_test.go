@@ -0,0 +1,159 @@
+package cloudfunction
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// requireTool 本机没有运行时工具链时跳过测试
+func requireTool(t *testing.T, name string) {
+	t.Helper()
+	if _, err := exec.LookPath(name); err != nil {
+		t.Skipf("未安装 %s", name)
+	}
+}
+
+func TestValidateFunctionReportsUserCodePositions(t *testing.T) {
+	tests := []struct {
+		runtime string
+		handler string
+		code    string
+		line    int
+		message string
+	}{
+		{
+			runtime: "go",
+			handler: "Handler",
+			code:    "func Handler(ctx context.Context, event interface{}) interface{} {\n\tvar n int = \"text\"\n\treturn n\n}\n",
+			line:    2,
+			message: "cannot use",
+		},
+		{
+			runtime: "nodejs",
+			handler: "handler",
+			code:    "function handler(event) {\n  return {;\n}\n",
+			line:    2,
+			message: "SyntaxError",
+		},
+		{
+			runtime: "python",
+			handler: "handler",
+			code:    "def handler(event, context):\n    return 1\n\ndef broken(:\n    pass\n",
+			line:    4,
+			message: "SyntaxError",
+		},
+	}
+
+	p := newTestPlatform(t)
+	for _, tt := range tests {
+		t.Run(tt.runtime, func(t *testing.T) {
+			requireTool(t, map[string]string{"go": "go", "nodejs": "node", "python": "python3"}[tt.runtime])
+
+			fn := &Function{Name: "check", Runtime: tt.runtime, Handler: tt.handler, Code: tt.code, Timeout: 10, Memory: 128}
+			_, err := p.ValidateFunction(fn)
+			var validation *ValidationError
+			if !errors.As(err, &validation) {
+				t.Fatalf("err = %v, want *ValidationError", err)
+			}
+			d := validation.Diagnostics[0]
+			if d.Line != tt.line || d.Severity != SeverityError || !strings.Contains(d.Message, tt.message) {
+				t.Fatalf("诊断 = %+v, want 第%d行包含 %q", d, tt.line, tt.message)
+			}
+		})
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	valid := func() *Function {
+		return &Function{Name: "config", Runtime: "python", Handler: "handler", Code: "def handler(e, c):\n    return 1\n", Timeout: 10, Memory: 128}
+	}
+	tests := map[string]func(fn *Function){
+		"未知运行时":   func(fn *Function) { fn.Runtime = "ruby" },
+		"空代码":     func(fn *Function) { fn.Code = "  \n" },
+		"超时为0":    func(fn *Function) { fn.Timeout = 0 },
+		"超时过长":    func(fn *Function) { fn.Timeout = 901 },
+		"内存过小":    func(fn *Function) { fn.Memory = 8 },
+		"入口是关键字":  func(fn *Function) { fn.Handler = "lambda" },
+		"入口不是标识符": func(fn *Function) { fn.Handler = "my-handler" },
+		"环境变量名无效": func(fn *Function) { fn.Environment = map[string]string{"1BAD": "x"} },
+	}
+
+	p := newTestPlatform(t)
+	if err := p.validateConfig(valid()); err != nil {
+		t.Fatalf("有效的配置: %v", err)
+	}
+	for name, mutate := range tests {
+		fn := valid()
+		mutate(fn)
+		var validation *ValidationError
+		if err := p.validateConfig(fn); !errors.As(err, &validation) {
+			t.Errorf("%s: err = %v, want *ValidationError", name, err)
+		}
+	}
+}
+
+func TestCreateFunctionRejectsSyntaxErrors(t *testing.T) {
+	requireTool(t, "node")
+	p := newTestPlatform(t)
+
+	fn := newNodeFunction("broken", "function handler( {")
+	if err := p.CreateFunction(fn); err == nil {
+		t.Fatal("语法错误的函数不应部署成功")
+	}
+	if len(p.ListFunctions()) != 0 {
+		t.Fatal("校验失败的函数不应被保存")
+	}
+}
+
+func TestDeployReportsGoCompileErrorsInBuild(t *testing.T) {
+	requireTool(t, "go")
+	p := newTestPlatform(t)
+
+	// 部署时只检查语法和入口签名，类型错误由异步构建报告
+	fn := &Function{Name: "typed", Runtime: "go", Handler: "Handler", Timeout: 10, Memory: 128,
+		Code: "func Handler(ctx context.Context, event interface{}) interface{} {\n\tvar n int = \"text\"\n\treturn n\n}\n"}
+	if err := p.CreateFunction(fn); err != nil {
+		t.Fatal(err)
+	}
+	waitForBuilds(t, p)
+
+	build, err := p.GetBuild(fn.ID, fn.BuildID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if build.State != BuildFailed || len(build.Diagnostics) == 0 {
+		t.Fatalf("build = %+v", build)
+	}
+	if d := build.Diagnostics[0]; d.File != goSourceFile || d.Line != 2 || !strings.Contains(d.Message, "cannot use") {
+		t.Fatalf("诊断 = %+v, want handler.go 第2行", d)
+	}
+
+	// 调用被拒绝，错误中带有同样的诊断
+	_, err = p.ExecuteFunction(fn.ID, &ExecuteRequest{})
+	var notReady *BuildNotReadyError
+	if !errors.As(err, &notReady) || len(notReady.Build.Diagnostics) == 0 || notReady.Build.Diagnostics[0].Line != 2 {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestParseGoDiagnostics(t *testing.T) {
+	output := []byte("# command-line-arguments\n./main.go:12:5: undefined: foo\nhandler.go:3: missing return\nnote: module requires Go 1.22\n")
+	diagnostics := parseGoDiagnostics(output, SeverityError)
+	if len(diagnostics) != 2 {
+		t.Fatalf("diagnostics = %+v", diagnostics)
+	}
+	if d := diagnostics[0]; d.File != "main.go" || d.Line != 12 || d.Column != 5 || d.Message != "undefined: foo" {
+		t.Errorf("diagnostics[0] = %+v", d)
+	}
+	if d := diagnostics[1]; d.File != "handler.go" || d.Line != 3 || d.Column != 0 {
+		t.Errorf("diagnostics[1] = %+v", d)
+	}
+
+	// 没有位置信息时保留整段输出
+	diagnostics = parseGoDiagnostics([]byte("go: cannot find main module\n"), SeverityError)
+	if len(diagnostics) != 1 || diagnostics[0].Message != "go: cannot find main module" {
+		t.Fatalf("diagnostics = %+v", diagnostics)
+	}
+}
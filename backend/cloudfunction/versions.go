@@ -0,0 +1,370 @@
+package cloudfunction
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LatestQualifier 指向函数当前（未发布）代码的限定符
+const LatestQualifier = "$LATEST"
+
+// maxAliasHistory 别名保留的历史指向数量
+const maxAliasHistory = 20
+
+var aliasNamePattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_-]{0,63}$`)
+
+// FunctionVersion 函数的不可变版本快照
+type FunctionVersion struct {
+	Version     int               `json:"version"`
+	Description string            `json:"description,omitempty"`
+	Runtime     string            `json:"runtime"`
+	Code        string            `json:"code"`
+	Package     *CodePackage      `json:"package,omitempty"`
+	Layers      []LayerRef        `json:"layers,omitempty"`
+	BuildID     string            `json:"build_id,omitempty"`
+	Handler     string            `json:"handler"`
+	Environment map[string]string `json:"environment"`
+	Timeout     int               `json:"timeout"`
+	Memory      int               `json:"memory"`
+	Sandbox     *bool             `json:"sandbox,omitempty"`
+	Network     *NetworkPolicy    `json:"network,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+}
+
+// Alias 指向某个函数版本的命名别名（如 prod、staging）
+type Alias struct {
+	Name        string    `json:"name"`
+	Version     int       `json:"version"`
+	Description string    `json:"description,omitempty"`
+	History     []int     `json:"history,omitempty"` // 之前指向的版本，最近的在末尾
+	UpdatedAt   time.Time `json:"updated_at"`
+
+	Routing      *AliasRouting   `json:"routing,omitempty"`       // 加权流量分配
+	LastRollback *CanaryRollback `json:"last_rollback,omitempty"` // 最近一次金丝雀自动回滚
+}
+
+// PublishVersion 将函数当前代码和配置发布为新的不可变版本
+func (p *Platform) PublishVersion(id, description string) (*FunctionVersion, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	existing, exists := p.functions[id]
+	if !exists {
+		return nil, fmt.Errorf("函数不存在: %s", id)
+	}
+
+	version := &FunctionVersion{
+		Version:     len(existing.Versions) + 1,
+		Description: description,
+		Runtime:     existing.Runtime,
+		Code:        existing.Code,
+		Package:     existing.Package,
+		Layers:      existing.Layers,
+		Handler:     existing.Handler,
+		Environment: copyStringMap(existing.Environment),
+		Timeout:     existing.Timeout,
+		Memory:      existing.Memory,
+		Sandbox:     existing.Sandbox,
+		Network:     existing.Network,
+		CreatedAt:   time.Now(),
+	}
+
+	// 每个版本在自己的目录中单独构建
+	build := newBuild(existing.atVersion(version))
+	version.BuildID = build.ID
+
+	// 写时复制，避免影响正在使用旧指针的执行
+	updated := *existing
+	updated.Versions = append(append([]*FunctionVersion(nil), existing.Versions...), version)
+
+	if err := p.replaceFunction(existing, &updated); err != nil {
+		return nil, err
+	}
+
+	p.startBuild(updated.atVersion(version), build)
+	return version, nil
+}
+
+// ListVersions 列出函数的所有已发布版本
+func (p *Platform) ListVersions(id string) ([]*FunctionVersion, error) {
+	fn, err := p.GetFunction(id)
+	if err != nil {
+		return nil, err
+	}
+	return fn.Versions, nil
+}
+
+// GetVersion 获取函数的指定版本
+func (p *Platform) GetVersion(id string, version int) (*FunctionVersion, error) {
+	fn, err := p.GetFunction(id)
+	if err != nil {
+		return nil, err
+	}
+	return fn.findVersion(version)
+}
+
+// ListAliases 列出函数的所有别名
+func (p *Platform) ListAliases(id string) ([]*Alias, error) {
+	fn, err := p.GetFunction(id)
+	if err != nil {
+		return nil, err
+	}
+
+	aliases := make([]*Alias, 0, len(fn.Aliases))
+	for _, alias := range fn.Aliases {
+		aliases = append(aliases, alias)
+	}
+	sort.Slice(aliases, func(i, j int) bool { return aliases[i].Name < aliases[j].Name })
+	return aliases, nil
+}
+
+// SetAlias 创建别名或将已有别名指向新的版本，routing 不为空时按权重向第二个版本分配流量
+func (p *Platform) SetAlias(id, name string, version int, description string, routing *AliasRouting) (*Alias, error) {
+	if err := validateAliasName(name); err != nil {
+		return nil, err
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	existing, exists := p.functions[id]
+	if !exists {
+		return nil, fmt.Errorf("函数不存在: %s", id)
+	}
+	if _, err := existing.findVersion(version); err != nil {
+		return nil, err
+	}
+	if err := validateRouting(existing, version, routing); err != nil {
+		return nil, err
+	}
+
+	alias := &Alias{
+		Name:        name,
+		Version:     version,
+		Description: description,
+		UpdatedAt:   time.Now(),
+		Routing:     routing,
+	}
+	if old, ok := existing.Aliases[name]; ok {
+		if description == "" {
+			alias.Description = old.Description
+		}
+		alias.History = old.History
+		if old.Version != version {
+			alias.History = appendAliasHistory(old.History, old.Version)
+		}
+	}
+
+	if err := p.storeAlias(existing, alias); err != nil {
+		return nil, err
+	}
+	// 新的流量分配重新开始统计金丝雀错误率
+	GlobalMetrics.ForgetAlias(id, name)
+	return alias, nil
+}
+
+// RollbackAlias 将别名指回之前的版本；version 为0时回退到上一次指向的版本
+func (p *Platform) RollbackAlias(id, name string, version int) (*Alias, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	existing, exists := p.functions[id]
+	if !exists {
+		return nil, fmt.Errorf("函数不存在: %s", id)
+	}
+	old, ok := existing.Aliases[name]
+	if !ok {
+		return nil, fmt.Errorf("别名不存在: %s", name)
+	}
+
+	alias := *old
+	alias.UpdatedAt = time.Now()
+	// 回滚时停止向第二个版本分配流量
+	alias.Routing = nil
+
+	if version == 0 {
+		if len(old.History) == 0 {
+			return nil, fmt.Errorf("别名 %s 没有可回滚的历史版本", name)
+		}
+		alias.Version = old.History[len(old.History)-1]
+		alias.History = append([]int(nil), old.History[:len(old.History)-1]...)
+	} else {
+		if _, err := existing.findVersion(version); err != nil {
+			return nil, err
+		}
+		if version == old.Version {
+			return nil, fmt.Errorf("别名 %s 已指向版本 %d", name, version)
+		}
+		alias.Version = version
+		alias.History = appendAliasHistory(old.History, old.Version)
+	}
+
+	if err := p.storeAlias(existing, &alias); err != nil {
+		return nil, err
+	}
+	return &alias, nil
+}
+
+// DeleteAlias 删除别名
+func (p *Platform) DeleteAlias(id, name string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	existing, exists := p.functions[id]
+	if !exists {
+		return fmt.Errorf("函数不存在: %s", id)
+	}
+	if _, ok := existing.Aliases[name]; !ok {
+		return fmt.Errorf("别名不存在: %s", name)
+	}
+
+	updated := *existing
+	updated.Aliases = make(map[string]*Alias, len(existing.Aliases))
+	for k, v := range existing.Aliases {
+		if k != name {
+			updated.Aliases[k] = v
+		}
+	}
+
+	if err := p.replaceFunction(existing, &updated); err != nil {
+		return err
+	}
+	GlobalMetrics.ForgetAlias(id, name)
+	return nil
+}
+
+// storeAlias 以写时复制的方式保存别名，调用方需持有写锁
+func (p *Platform) storeAlias(existing *Function, alias *Alias) error {
+	updated := *existing
+	updated.Aliases = make(map[string]*Alias, len(existing.Aliases)+1)
+	for k, v := range existing.Aliases {
+		updated.Aliases[k] = v
+	}
+	updated.Aliases[alias.Name] = alias
+
+	return p.replaceFunction(existing, &updated)
+}
+
+// replaceFunction 替换内存中的函数并持久化，失败时回滚；调用方需持有写锁
+func (p *Platform) replaceFunction(existing, updated *Function) error {
+	p.functions[existing.ID] = updated
+	p.indexNames()
+	if err := p.saveToFile(); err != nil {
+		p.functions[existing.ID] = existing
+		p.indexNames()
+		return fmt.Errorf("持久化函数失败: %v", err)
+	}
+	return nil
+}
+
+// resolveFunction 解析带限定符的函数引用（id、id:版本号、id:别名），返回可执行的函数快照
+func (p *Platform) resolveFunction(ref string) (*Function, error) {
+	id, qualifier := splitQualifier(ref)
+
+	fn, err := p.GetFunction(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if qualifier == "" || qualifier == LatestQualifier {
+		return fn, nil
+	}
+
+	if version, err := strconv.Atoi(qualifier); err == nil {
+		v, err := fn.findVersion(version)
+		if err != nil {
+			return nil, err
+		}
+		return fn.atVersion(v), nil
+	}
+
+	alias, ok := fn.Aliases[qualifier]
+	if !ok {
+		return nil, fmt.Errorf("别名不存在: %s", qualifier)
+	}
+	v, err := fn.findVersion(alias.pickVersion())
+	if err != nil {
+		return nil, err
+	}
+	snapshot := fn.atVersion(v)
+	snapshot.alias = alias.Name
+	return snapshot, nil
+}
+
+// findVersion 查找指定版本
+func (fn *Function) findVersion(version int) (*FunctionVersion, error) {
+	if version < 1 || version > len(fn.Versions) {
+		return nil, fmt.Errorf("函数 %s 不存在版本: %d", fn.ID, version)
+	}
+	return fn.Versions[version-1], nil
+}
+
+// atVersion 生成以指定版本代码和配置执行的函数副本
+func (fn *Function) atVersion(v *FunctionVersion) *Function {
+	snapshot := *fn
+	snapshot.Runtime = v.Runtime
+	snapshot.Code = v.Code
+	snapshot.Package = v.Package
+	snapshot.Layers = v.Layers
+	snapshot.BuildID = v.BuildID
+	snapshot.Handler = v.Handler
+	snapshot.Environment = v.Environment
+	snapshot.Timeout = v.Timeout
+	snapshot.Memory = v.Memory
+	snapshot.Sandbox = v.Sandbox
+	snapshot.Network = v.Network
+	snapshot.version = v.Version
+	return &snapshot
+}
+
+// versionQualifier 返回执行的版本号，当前代码为 $LATEST
+func (fn *Function) versionQualifier() string {
+	if fn.version > 0 {
+		return strconv.Itoa(fn.version)
+	}
+	return LatestQualifier
+}
+
+// splitQualifier 拆分 "id:qualifier" 形式的函数引用
+func splitQualifier(ref string) (string, string) {
+	if idx := strings.LastIndex(ref, ":"); idx >= 0 {
+		return ref[:idx], ref[idx+1:]
+	}
+	return ref, ""
+}
+
+// validateAliasName 校验别名名称
+func validateAliasName(name string) error {
+	if !aliasNamePattern.MatchString(name) {
+		return fmt.Errorf("无效的别名: %s（需以字母开头，只能包含字母、数字、-和_）", name)
+	}
+	if strings.EqualFold(name, "latest") {
+		return fmt.Errorf("别名 %s 为保留名称", name)
+	}
+	return nil
+}
+
+// appendAliasHistory 追加别名历史并限制长度
+func appendAliasHistory(history []int, version int) []int {
+	result := append(append([]int(nil), history...), version)
+	if len(result) > maxAliasHistory {
+		result = result[len(result)-maxAliasHistory:]
+	}
+	return result
+}
+
+// copyStringMap 复制字符串映射
+func copyStringMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	result := make(map[string]string, len(m))
+	for k, v := range m {
+		result[k] = v
+	}
+	return result
+}
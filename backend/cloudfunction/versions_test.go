@@ -0,0 +1,145 @@
+package cloudfunction
+
+import (
+	"strings"
+	"testing"
+)
+
+func newNodeFunction(name, code string) *Function {
+	return &Function{
+		Name:    name,
+		Runtime: "nodejs",
+		Handler: "handler",
+		Code:    code,
+		Timeout: 10,
+		Memory:  128,
+	}
+}
+
+func TestPublishedVersionsAreImmutable(t *testing.T) {
+	p := newTestPlatform(t)
+	fn := newNodeFunction("versions", "function handler() { return 1; }")
+	fn.Environment = map[string]string{"STAGE": "one"}
+	if err := p.CreateFunction(fn); err != nil {
+		t.Fatal(err)
+	}
+	v1, err := p.PublishVersion(fn.ID, "第一版")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	update := newNodeFunction("versions", "function handler() { return 2; }")
+	update.Environment = map[string]string{"STAGE": "two"}
+	if err := p.UpdateFunction(fn.ID, update); err != nil {
+		t.Fatal(err)
+	}
+	v2, err := p.PublishVersion(fn.ID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v1.Version != 1 || v2.Version != 2 {
+		t.Fatalf("版本号 = %d, %d; want 1, 2", v1.Version, v2.Version)
+	}
+
+	for ref, want := range map[string]string{
+		fn.ID:              "return 2",
+		fn.ID + ":$LATEST": "return 2",
+		fn.ID + ":1":       "return 1",
+		fn.ID + ":2":       "return 2",
+	} {
+		resolved, err := p.resolveFunction(ref)
+		if err != nil {
+			t.Fatalf("resolveFunction(%s): %v", ref, err)
+		}
+		if !strings.Contains(resolved.Code, want) {
+			t.Errorf("resolveFunction(%s) 的代码 = %q, want %q", ref, resolved.Code, want)
+		}
+	}
+
+	first, err := p.resolveFunction(fn.ID + ":1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Environment["STAGE"] != "one" || first.version != 1 {
+		t.Fatalf("版本1的配置被修改: env=%v version=%d", first.Environment, first.version)
+	}
+	if p.functionDir(first) == p.functionDir(fn) {
+		t.Fatal("已发布版本应使用独立的目录")
+	}
+
+	if _, err := p.resolveFunction(fn.ID + ":3"); err == nil {
+		t.Fatal("不存在的版本应返回错误")
+	}
+}
+
+func TestAliasHistoryAndRollback(t *testing.T) {
+	p := newTestPlatform(t)
+	fn := newNodeFunction("aliases", "function handler() { return 1; }")
+	if err := p.CreateFunction(fn); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := p.PublishVersion(fn.ID, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := p.SetAlias(fn.ID, "prod", 1, "线上", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.SetAlias(fn.ID, "prod", 2, "", nil); err != nil {
+		t.Fatal(err)
+	}
+	alias, err := p.SetAlias(fn.ID, "prod", 3, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alias.Description != "线上" || len(alias.History) != 2 || alias.History[1] != 2 {
+		t.Fatalf("alias = %+v, want 保留描述且历史为 [1 2]", alias)
+	}
+
+	resolved, err := p.resolveFunction(fn.ID + ":prod")
+	if err != nil || resolved.version != 3 {
+		t.Fatalf("prod 指向 %v, %v; want 版本3", resolved, err)
+	}
+
+	// 不指定版本时回退到上一次指向的版本
+	alias, err = p.RollbackAlias(fn.ID, "prod", 0)
+	if err != nil || alias.Version != 2 {
+		t.Fatalf("RollbackAlias = %+v, %v; want 版本2", alias, err)
+	}
+	alias, err = p.RollbackAlias(fn.ID, "prod", 1)
+	if err != nil || alias.Version != 1 {
+		t.Fatalf("RollbackAlias(1) = %+v, %v", alias, err)
+	}
+	if _, err := p.RollbackAlias(fn.ID, "prod", 1); err == nil {
+		t.Fatal("回滚到当前版本应返回错误")
+	}
+
+	if err := p.DeleteAlias(fn.ID, "prod"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.resolveFunction(fn.ID + ":prod"); err == nil {
+		t.Fatal("删除后的别名不应能解析")
+	}
+}
+
+func TestSetAliasValidation(t *testing.T) {
+	p := newTestPlatform(t)
+	fn := newNodeFunction("alias-names", "function handler() { return 1; }")
+	if err := p.CreateFunction(fn); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.PublishVersion(fn.ID, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"latest", "LATEST", "1prod", "prod:1", ""} {
+		if _, err := p.SetAlias(fn.ID, name, 1, "", nil); err == nil {
+			t.Errorf("SetAlias(%q) 应返回错误", name)
+		}
+	}
+	if _, err := p.SetAlias(fn.ID, "prod", 2, "", nil); err == nil {
+		t.Error("指向不存在的版本应返回错误")
+	}
+}
@@ -0,0 +1,353 @@
+package cloudfunction
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// warmReapInterval 检查空闲常驻实例是否过期的间隔
+const warmReapInterval = 30 * time.Second
+
+// warmRequest 发给常驻实例（以及 custom 运行时的 bootstrap）的一次调用，按行写入进程的标准输入
+type warmRequest struct {
+	Event      interface{}        `json:"event,omitempty"`
+	Context    map[string]string  `json:"context,omitempty"`
+	Invocation *InvocationContext `json:"invocation"`
+}
+
+// warmWorker 常驻的函数进程：入口模块只在启动后的第一次调用时加载，
+// 之后从标准输入逐行读取调用请求，结果按行写到标准输出；同一时间只处理一个调用
+type warmWorker struct {
+	key        string
+	fnID       string
+	generation int
+	cmd        *exec.Cmd
+	cancel     context.CancelFunc
+	stdin      interface{ Write([]byte) (int, error) }
+	stdout     *lineWriter
+	stderr     *tailBuffer
+	exited     chan struct{}
+	waitErr    error
+	lastUsed   time.Time
+}
+
+// warmPool 按函数、版本、构建和环境区分的空闲常驻实例
+type warmPool struct {
+	mutex       sync.Mutex
+	idle        map[string][]*warmWorker
+	generations map[string]int // 函数更新或删除时递增，之前启动的实例不再复用
+	reaper      sync.Once
+}
+
+func newWarmPool() *warmPool {
+	return &warmPool{
+		idle:        make(map[string][]*warmWorker),
+		generations: make(map[string]int),
+	}
+}
+
+// lineWriter 将写入的数据按行发送给正在处理的调用，实例空闲时输出的行被丢弃
+type lineWriter struct {
+	buf   []byte
+	mutex sync.Mutex
+	lines chan<- []byte   // 当前调用接收输出的通道，空闲时为 nil
+	done  <-chan struct{} // 当前调用结束时关闭，阻塞的发送随之放弃
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		idx := bytes.IndexByte(w.buf, '\n')
+		if idx < 0 {
+			break
+		}
+		line := append([]byte(nil), w.buf[:idx]...)
+		w.buf = w.buf[idx+1:]
+
+		w.mutex.Lock()
+		lines, done := w.lines, w.done
+		w.mutex.Unlock()
+		if lines != nil {
+			select {
+			case lines <- line:
+			case <-done:
+			}
+		}
+	}
+	return len(p), nil
+}
+
+// attach 开始把输出发送给一次调用，返回接收输出的通道和结束调用的函数
+func (w *lineWriter) attach() (<-chan []byte, func()) {
+	lines := make(chan []byte, 1)
+	done := make(chan struct{})
+	w.mutex.Lock()
+	w.lines, w.done = lines, done
+	w.mutex.Unlock()
+
+	return lines, func() {
+		w.mutex.Lock()
+		w.lines, w.done = nil, nil
+		w.mutex.Unlock()
+		close(done)
+	}
+}
+
+// warmEnabled 判断函数是否使用常驻实例。沙箱和网络策略按调用配置，使用它们的函数每次调用启动新进程
+func (p *Platform) warmEnabled(fn *Function) bool {
+	return p.options.WarmIdleTimeout > 0 && !p.sandboxEnabled(fn) && p.networkMode(fn) == NetworkUnrestricted
+}
+
+// invokeWarm 在常驻实例中执行一次调用，没有空闲实例时启动新实例；
+// 超时或进程异常退出的实例被丢弃，其余实例放回空闲池
+func (p *Platform) invokeWarm(ctx context.Context, fn *Function, inv *invocation, timeout time.Duration, name string, args ...string) (interface{}, error) {
+	env := workerEnv(p.functionEnv(fn, inv))
+	key := warmKey(fn, env, name, args)
+
+	worker := p.warm.acquire(key)
+	if worker == nil {
+		var err error
+		if worker, err = p.startWorker(fn, inv, key, env, name, args...); err != nil {
+			return nil, newExecutionError(ErrorTypePlatform, "启动函数进程失败: %v", err)
+		}
+	}
+
+	output, err := worker.invoke(ctx, &warmRequest{Event: inv.req.Event, Context: inv.req.Context, Invocation: inv.context})
+	if err != nil {
+		worker.close()
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, &ExecutionError{Type: ErrorTypeTimeout, Message: fmt.Sprintf("执行超时（%v）", timeout)}
+		}
+		return nil, err
+	}
+	p.releaseWorker(worker)
+	return parseFunctionOutput(output, nil, nil)
+}
+
+// startWorker 启动常驻实例，进程的生命周期与单次调用无关
+func (p *Platform) startWorker(fn *Function, inv *invocation, key string, env []string, name string, args ...string) (*warmWorker, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd, err := p.newCommand(ctx, fn, inv, name, args...)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	cmd.Env = append(env, EnvWorker+"=1")
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	worker := &warmWorker{
+		key:        key,
+		fnID:       fn.ID,
+		generation: p.warm.generation(fn.ID),
+		cmd:        cmd,
+		cancel:     cancel,
+		stdin:      stdin,
+		stdout:     &lineWriter{},
+		stderr:     &tailBuffer{limit: maxStderrSize},
+		exited:     make(chan struct{}),
+	}
+	cmd.Stdout = worker.stdout
+	cmd.Stderr = worker.stderr
+
+	wait, err := startCommand(cmd)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	go func() {
+		worker.waitErr = wait()
+		close(worker.exited)
+	}()
+	return worker, nil
+}
+
+// invoke 发送调用请求并等待一行结果，不是结果信封的行视为误写到标准输出的日志并丢弃。
+// 只接收本次调用期间的输出，之前的调用结束后输出的行不会被当作结果
+func (w *warmWorker) invoke(ctx context.Context, req *warmRequest) ([]byte, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, newExecutionError(ErrorTypeValidation, "序列化调用请求失败: %v", err)
+	}
+	lines, finish := w.stdout.attach()
+	defer finish()
+	// 实例卡住时写入可能阻塞，写入失败意味着进程已退出，由 exited 报告
+	go w.stdin.Write(append(data, '\n'))
+
+	for {
+		select {
+		case line := <-lines:
+			if _, found := parseEnvelope(line); found {
+				return line, nil
+			}
+		case <-w.exited:
+			// 进程输出结果后立即退出时，结果可能仍在通道中
+			select {
+			case line := <-lines:
+				if _, found := parseEnvelope(line); found {
+					return line, nil
+				}
+			default:
+			}
+			return nil, w.exitError()
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// exitError 对处理调用时退出的实例分类
+func (w *warmWorker) exitError() error {
+	var exitErr *exec.ExitError
+	if errors.As(w.waitErr, &exitErr) {
+		return classifyExit(exitErr, w.stderr.data)
+	}
+	return &ExecutionError{Type: ErrorTypeHandler, Message: "函数进程意外退出", Stack: truncateStack(string(w.stderr.data))}
+}
+
+// alive 判断实例进程是否仍在运行
+func (w *warmWorker) alive() bool {
+	select {
+	case <-w.exited:
+		return false
+	default:
+		return true
+	}
+}
+
+// close 终止实例的进程组
+func (w *warmWorker) close() {
+	w.cancel()
+}
+
+// acquire 取出一个空闲实例
+func (pool *warmPool) acquire(key string) *warmWorker {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	workers := pool.idle[key]
+	for len(workers) > 0 {
+		worker := workers[len(workers)-1]
+		workers = workers[:len(workers)-1]
+		if worker.alive() {
+			pool.idle[key] = workers
+			return worker
+		}
+	}
+	delete(pool.idle, key)
+	return nil
+}
+
+// releaseWorker 将处理完调用的实例放回空闲池；函数已更新或空闲实例已满时终止实例
+func (p *Platform) releaseWorker(worker *warmWorker) {
+	pool := p.warm
+	pool.reaper.Do(func() { go p.reapWorkers() })
+
+	pool.mutex.Lock()
+	if pool.generations[worker.fnID] != worker.generation || len(pool.idle[worker.key]) >= p.options.WarmMaxIdle {
+		pool.mutex.Unlock()
+		worker.close()
+		return
+	}
+	worker.lastUsed = time.Now()
+	pool.idle[worker.key] = append(pool.idle[worker.key], worker)
+	pool.mutex.Unlock()
+}
+
+// generation 返回函数当前的实例代数
+func (pool *warmPool) generation(fnID string) int {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	return pool.generations[fnID]
+}
+
+// evict 终止函数的所有空闲实例，正在处理调用的实例结束后不再放回空闲池
+func (pool *warmPool) evict(fnID string) {
+	pool.mutex.Lock()
+	pool.generations[fnID]++
+	var evicted []*warmWorker
+	for key, workers := range pool.idle {
+		if len(workers) > 0 && workers[0].fnID == fnID {
+			evicted = append(evicted, workers...)
+			delete(pool.idle, key)
+		}
+	}
+	pool.mutex.Unlock()
+
+	for _, worker := range evicted {
+		worker.close()
+	}
+}
+
+// reapWorkers 定期终止空闲超过 WarmIdleTimeout 的实例
+func (p *Platform) reapWorkers() {
+	idleTimeout := time.Duration(p.options.WarmIdleTimeout) * time.Second
+	ticker := time.NewTicker(min(warmReapInterval, idleTimeout))
+	defer ticker.Stop()
+
+	for range ticker.C {
+		pool := p.warm
+		var expired []*warmWorker
+		pool.mutex.Lock()
+		for key, workers := range pool.idle {
+			kept := workers[:0]
+			for _, worker := range workers {
+				if time.Since(worker.lastUsed) > idleTimeout || !worker.alive() {
+					expired = append(expired, worker)
+				} else {
+					kept = append(kept, worker)
+				}
+			}
+			if len(kept) == 0 {
+				delete(pool.idle, key)
+			} else {
+				pool.idle[key] = kept
+			}
+		}
+		pool.mutex.Unlock()
+
+		for _, worker := range expired {
+			worker.close()
+		}
+	}
+}
+
+// workerEnv 去掉函数环境中每次调用不同的变量，这些变量由实例在处理调用时设置
+func workerEnv(env []string) []string {
+	perInvocation := map[string]bool{EnvRequestID: true, EnvInvocationContext: true, EnvFunctionEvent: true, EnvFunctionContext: true}
+	filtered := make([]string, 0, len(env))
+	for _, entry := range env {
+		key, _, _ := strings.Cut(entry, "=")
+		if !perInvocation[key] {
+			filtered = append(filtered, entry)
+		}
+	}
+	return filtered
+}
+
+// warmKey 计算实例的复用键：函数、版本、构建、启动命令和环境都相同的调用才能复用实例
+func warmKey(fn *Function, env []string, name string, args []string) string {
+	hash := sha256.New()
+	for _, part := range append([]string{fn.ID, strconv.Itoa(fn.version), fn.BuildID, name}, args...) {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	for _, entry := range env {
+		hash.Write([]byte(entry))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
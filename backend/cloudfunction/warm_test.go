@@ -0,0 +1,101 @@
+package cloudfunction
+
+import (
+	"testing"
+	"time"
+)
+
+// noisyBootstrap 在结果之后继续向标准输出写入的 bootstrap
+const noisyBootstrap = `#!/usr/bin/env python3
+import json, sys
+
+calls = 0
+for line in sys.stdin:
+    calls += 1
+    mode = json.loads(line)["event"].get("mode")
+    if mode == "crash":
+        for i in range(100):
+            print("line", i, flush=True)
+        sys.exit(4)
+    print(json.dumps({"success": True, "result": calls}), flush=True)
+    if mode == "stale":
+        print(json.dumps({"success": True, "result": "stale"}), flush=True)
+    elif mode == "flood":
+        for i in range(100):
+            print("line", i, flush=True)
+        sys.exit(0)
+`
+
+func createNoisyFunction(t *testing.T, p *Platform) *Function {
+	t.Helper()
+	pkg, err := p.StorePackage(buildZip(t, []packageEntry{{name: customBootstrapFile, body: noisyBootstrap, mode: 0755}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := &Function{Name: "noisy", Runtime: "custom", Handler: "noisy", Package: pkg, Timeout: 10, Memory: 128}
+	if err := p.CreateFunction(fn); err != nil {
+		t.Fatal(err)
+	}
+	waitForBuilds(t, p)
+	return fn
+}
+
+func executeNoisy(t *testing.T, p *Platform, fn *Function, mode string) *ExecuteResponse {
+	t.Helper()
+	resp, err := p.ExecuteFunction(fn.ID, &ExecuteRequest{Event: map[string]interface{}{"mode": mode}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestWarmWorkerDiscardsStaleLines(t *testing.T) {
+	requireTool(t, "python3")
+	p := newTestPlatform(t)
+	fn := createNoisyFunction(t, p)
+
+	if resp := executeNoisy(t, p, fn, "stale"); !resp.Success || resp.Result != 1.0 {
+		t.Fatalf("resp = %+v", resp)
+	}
+	// 等待结果之后的那一行进入通道
+	time.Sleep(200 * time.Millisecond)
+	if resp := executeNoisy(t, p, fn, ""); !resp.Success || resp.Result != 2.0 {
+		t.Fatalf("上次调用之后输出的行被当作了结果: %+v", resp)
+	}
+}
+
+func TestWarmWorkerExitsWithBufferedLines(t *testing.T) {
+	requireTool(t, "python3")
+	p := newTestPlatform(t)
+	fn := createNoisyFunction(t, p)
+
+	// 实例放回空闲池后继续输出并退出，没有调用读取这些行
+	if resp := executeNoisy(t, p, fn, "flood"); !resp.Success || resp.Result != 1.0 {
+		t.Fatalf("resp = %+v", resp)
+	}
+	p.warm.mutex.Lock()
+	var workers []*warmWorker
+	for _, idle := range p.warm.idle {
+		workers = append(workers, idle...)
+	}
+	p.warm.mutex.Unlock()
+	if len(workers) != 1 {
+		t.Fatalf("空闲实例数 = %d", len(workers))
+	}
+	select {
+	case <-workers[0].exited:
+	case <-time.After(2*processGracePeriod + 5*time.Second):
+		t.Fatal("输出阻塞的实例退出后没有被回收")
+	}
+
+	// 退出的实例不再复用
+	if resp := executeNoisy(t, p, fn, ""); !resp.Success || resp.Result != 1.0 {
+		t.Fatalf("resp = %+v", resp)
+	}
+
+	// 处理调用时输出大量的行后退出
+	resp := executeNoisy(t, p, fn, "crash")
+	if resp.Success || resp.ErrorType != ErrorTypeHandler {
+		t.Fatalf("resp = %+v", resp)
+	}
+}
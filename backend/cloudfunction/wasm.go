@@ -0,0 +1,224 @@
+package cloudfunction
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+// wasm 运行时：在平台进程内用纯Go实现的 WebAssembly 引擎（wazero）执行 WASI 模块。
+// 事件的JSON从标准输入传入，模块写到标准输出的JSON为返回值；以非0状态退出表示调用失败，
+// 标准错误的内容作为错误信息。每次调用实例化新的模块，编译结果缓存在 workDir/wasm-cache 下
+
+// wasmModuleFile 直接上传的 WebAssembly 模块在代码包中的文件名
+const wasmModuleFile = "function.wasm"
+
+// wasmPageSize WebAssembly 内存页的大小
+const wasmPageSize = 64 * 1024
+
+// maxWasmOutputSize 模块标准输出（返回值）的大小上限
+const maxWasmOutputSize = 6 << 20
+
+var wasmHandlerPattern = regexp.MustCompile(`^[A-Za-z0-9_.@-]+(/[A-Za-z0-9_.@-]+)*\.wasm$`)
+
+// newWasmCompilationCache 创建模块编译结果的缓存，目录不可用时只缓存在内存中
+func newWasmCompilationCache(workDir string) wazero.CompilationCache {
+	cache, err := wazero.NewCompilationCacheWithDir(filepath.Join(workDir, "wasm-cache"))
+	if err != nil {
+		Warn("创建WebAssembly编译缓存目录失败，只使用内存缓存: %v", err)
+		return wazero.NewCompilationCache()
+	}
+	return cache
+}
+
+// wasmMemoryPages 将函数的内存限制(MB)换算为模块可使用的最大内存页数
+func wasmMemoryPages(memoryMB int) uint32 {
+	return uint32(memoryMB * (1 << 20) / wasmPageSize)
+}
+
+// newWasmRuntime 创建内存页数受限、ctx 结束时终止模块执行的引擎，并注册 WASI 接口
+func (p *Platform) newWasmRuntime(ctx context.Context, fn *Function) (wazero.Runtime, error) {
+	config := wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(wasmMemoryPages(fn.Memory)).
+		WithCloseOnContextDone(true).
+		WithCompilationCache(p.wasmCache)
+	runtime := wazero.NewRuntimeWithConfig(ctx, config)
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, runtime); err != nil {
+		runtime.Close(ctx)
+		return nil, err
+	}
+	return runtime, nil
+}
+
+// executeWasmFunction 执行 wasm 函数：代码包目录只读挂载为模块的根目录，
+// 环境变量与其他运行时相同，调用上下文在 FUNCTION_CONTEXT 和 FC_INVOCATION_CONTEXT 中
+func (p *Platform) executeWasmFunction(fn *Function, inv *invocation) (interface{}, error) {
+	timeout := time.Duration(fn.Timeout) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	dir, err := p.prepareCode(ctx, fn, inv)
+	if err != nil {
+		return nil, err
+	}
+	module, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(fn.Handler)))
+	if err != nil {
+		return nil, newExecutionError(ErrorTypeValidation, "代码包中找不到入口模块: %s", fn.Handler)
+	}
+	event, err := json.Marshal(inv.req.Event)
+	if err != nil {
+		return nil, newExecutionError(ErrorTypeValidation, "序列化事件失败: %v", err)
+	}
+
+	runtime, err := p.newWasmRuntime(ctx, fn)
+	if err != nil {
+		return nil, newExecutionError(ErrorTypePlatform, "初始化WebAssembly运行时失败: %v", err)
+	}
+	defer runtime.Close(context.Background())
+
+	compiled, err := runtime.CompileModule(ctx, module)
+	if err != nil {
+		return nil, wasmCompileError(err, fn.Memory)
+	}
+
+	stdout := &cappedBuffer{limit: maxWasmOutputSize}
+	stderr := &tailBuffer{limit: maxStderrSize}
+	config := wazero.NewModuleConfig().
+		WithName("function").
+		WithArgs("function").
+		WithStdin(bytes.NewReader(event)).
+		WithStdout(stdout).
+		WithStderr(stderr).
+		WithSysWalltime().
+		WithSysNanotime().
+		WithRandSource(rand.Reader).
+		WithFSConfig(wazero.NewFSConfig().WithReadOnlyDirMount(dir, "/"))
+	for _, entry := range p.functionEnv(fn, inv) {
+		if key, value, ok := strings.Cut(entry, "="); ok {
+			config = config.WithEnv(key, value)
+		}
+	}
+
+	instance, err := runtime.InstantiateModule(ctx, compiled, config)
+	if instance != nil {
+		instance.Close(context.Background())
+	}
+	if err := wasmExitError(err, stderr.data, timeout); err != nil {
+		return nil, err
+	}
+
+	if stdout.overflow {
+		return nil, newExecutionError(ErrorTypeBadOutput, "模块输出超过 %dMB", maxWasmOutputSize>>20)
+	}
+	output := bytes.TrimSpace(stdout.data.Bytes())
+	if len(output) == 0 {
+		return nil, nil
+	}
+	var result interface{}
+	if err := json.Unmarshal(output, &result); err != nil {
+		return nil, &ExecutionError{
+			Type:    ErrorTypeBadOutput,
+			Message: fmt.Sprintf("模块的标准输出不是有效的JSON: %v", err),
+			Stack:   truncateStack(string(output)),
+		}
+	}
+	return result, nil
+}
+
+// wasmExitError 对模块实例化（执行 _start）的结果分类，正常退出时返回 nil
+func wasmExitError(err error, stderr []byte, timeout time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	stack := truncateStack(string(stderr))
+
+	var exitErr *sys.ExitError
+	if errors.As(err, &exitErr) {
+		switch exitErr.ExitCode() {
+		case 0:
+			return nil
+		case sys.ExitCodeDeadlineExceeded:
+			return &ExecutionError{Type: ErrorTypeTimeout, Message: fmt.Sprintf("执行超时（%v）", timeout)}
+		}
+	}
+
+	// 内存页数达到上限后 memory.grow 失败，由模块自己报告内存不足
+	for _, marker := range []string{"out of memory", "memory allocation of"} {
+		if bytes.Contains(stderr, []byte(marker)) {
+			return &ExecutionError{Type: ErrorTypeOOM, Message: "函数内存不足: " + marker, Stack: stack}
+		}
+	}
+	if exitErr != nil {
+		return &ExecutionError{Type: ErrorTypeHandler, Message: fmt.Sprintf("模块异常退出: exit status %d", exitErr.ExitCode()), Stack: stack}
+	}
+	// 执行陷阱（unreachable、越界访问等），错误信息中带 wasm 调用栈
+	message, trace, _ := strings.Cut(err.Error(), "\n")
+	if stack == "" {
+		stack = truncateStack(trace)
+	}
+	return &ExecutionError{Type: ErrorTypeHandler, Message: message, Stack: stack}
+}
+
+// wasmCompileError 区分模块声明的初始内存超过限制和其他编译错误
+func wasmCompileError(err error, memoryMB int) error {
+	if strings.Contains(err.Error(), "over limit") {
+		return newExecutionError(ErrorTypeOOM, "模块声明的初始内存超过函数的内存限制 %dMB: %v", memoryMB, err)
+	}
+	return newExecutionError(ErrorTypeValidation, "编译WebAssembly模块失败: %v", err)
+}
+
+// checkWasmModule 编译模块并检查：只导入 WASI 接口、导出 _start、初始内存不超过函数的内存限制
+func (p *Platform) checkWasmModule(ctx context.Context, fn *Function, file string) ([]Diagnostic, error) {
+	module, err := os.ReadFile(file)
+	if err != nil {
+		return nil, newValidationError("读取入口模块失败: %v", err)
+	}
+
+	runtime, err := p.newWasmRuntime(ctx, fn)
+	if err != nil {
+		return nil, fmt.Errorf("初始化WebAssembly运行时失败: %v", err)
+	}
+	defer runtime.Close(context.Background())
+
+	compiled, err := runtime.CompileModule(ctx, module)
+	if err != nil {
+		return wasmDiagnostics(fn.Handler, "编译模块失败: %v", err), nil
+	}
+	defer compiled.Close(context.Background())
+
+	for _, def := range compiled.ImportedFunctions() {
+		if moduleName, name, _ := def.Import(); moduleName != wasi_snapshot_preview1.ModuleName {
+			return wasmDiagnostics(fn.Handler, "模块导入了平台不提供的函数 %s.%s，只支持 %s", moduleName, name, wasi_snapshot_preview1.ModuleName), nil
+		}
+	}
+	for _, def := range compiled.ImportedMemories() {
+		moduleName, name, _ := def.Import()
+		return wasmDiagnostics(fn.Handler, "模块导入了平台不提供的内存 %s.%s", moduleName, name), nil
+	}
+	if start, ok := compiled.ExportedFunctions()["_start"]; !ok || len(start.ParamTypes()) > 0 || len(start.ResultTypes()) > 0 {
+		return wasmDiagnostics(fn.Handler, "模块没有导出 WASI 命令入口 _start，请按 wasm32-wasi(p1) 命令程序编译"), nil
+	}
+	for name, def := range compiled.ExportedMemories() {
+		if def.Min() > wasmMemoryPages(fn.Memory) {
+			return wasmDiagnostics(fn.Handler, "模块内存 %s 的初始大小 %dMB 超过函数的内存限制 %dMB", name, int(def.Min())*wasmPageSize>>20, fn.Memory), nil
+		}
+	}
+	return nil, nil
+}
+
+// wasmDiagnostics 创建指向入口模块的错误诊断
+func wasmDiagnostics(file, format string, args ...interface{}) []Diagnostic {
+	return []Diagnostic{{File: file, Severity: SeverityError, Message: fmt.Sprintf(format, args...)}}
+}
@@ -0,0 +1,200 @@
+package cloudfunction
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// wasmTestProgram 按事件中的 mode 演示模块的各种结束方式
+const wasmTestProgram = `package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+var sink [][]byte
+
+func main() {
+	var event struct{ Mode, Name string }
+	json.NewDecoder(os.Stdin).Decode(&event)
+	switch event.Mode {
+	case "loop":
+		for {
+		}
+	case "alloc":
+		for {
+			sink = append(sink, make([]byte, 1<<20))
+		}
+	case "fail":
+		fmt.Fprintln(os.Stderr, "invalid order")
+		os.Exit(3)
+	case "file":
+		data, err := os.ReadFile("/data/greeting.txt")
+		if err != nil {
+			panic(err)
+		}
+		json.NewEncoder(os.Stdout).Encode(string(data))
+	default:
+		json.NewEncoder(os.Stdout).Encode(map[string]string{"hello": event.Name, "fn": os.Getenv("FC_FUNCTION_NAME")})
+	}
+}
+`
+
+var (
+	wasmTestModuleOnce sync.Once
+	wasmTestModule     []byte
+	wasmTestModuleErr  error
+)
+
+// buildWasmTestModule 用本机的 Go 工具链把测试程序编译为 WASI 模块，所有测试共用一次编译结果
+func buildWasmTestModule(t *testing.T) []byte {
+	t.Helper()
+	requireTool(t, "go")
+	wasmTestModuleOnce.Do(func() {
+		dir, err := os.MkdirTemp("", "fc-wasm-test-")
+		if err != nil {
+			wasmTestModuleErr = err
+			return
+		}
+		defer os.RemoveAll(dir)
+		os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module wasmtest\n\ngo 1.21\n"), 0644)
+		os.WriteFile(filepath.Join(dir, "main.go"), []byte(wasmTestProgram), 0644)
+
+		cmd := exec.Command("go", "build", "-o", "function.wasm", ".")
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+		if output, err := cmd.CombinedOutput(); err != nil {
+			wasmTestModuleErr = err
+			wasmTestModule = output
+			return
+		}
+		wasmTestModule, wasmTestModuleErr = os.ReadFile(filepath.Join(dir, "function.wasm"))
+	})
+	if wasmTestModuleErr != nil {
+		t.Skipf("无法编译 WASI 模块: %v %s", wasmTestModuleErr, wasmTestModule)
+	}
+	return wasmTestModule
+}
+
+// createWasmFunction 以代码包部署 wasm 函数
+func createWasmFunction(t *testing.T, p *Platform, name string, data []byte, handler string) *Function {
+	t.Helper()
+	pkg, err := p.StorePackage(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := &Function{Name: name, Runtime: "wasm", Handler: handler, Package: pkg, Timeout: 10, Memory: 64}
+	if err := p.CreateFunction(fn); err != nil {
+		t.Fatal(err)
+	}
+	waitForBuilds(t, p)
+	return fn
+}
+
+func TestWasmModuleProtocol(t *testing.T) {
+	module := buildWasmTestModule(t)
+	p := newTestPlatform(t)
+	fn := createWasmFunction(t, p, "wasm-echo", module, wasmModuleFile)
+
+	tests := []struct {
+		event     map[string]interface{}
+		want      string
+		errorType string
+	}{
+		{event: map[string]interface{}{"name": "wasm"}, want: `{"fn":"wasm-echo","hello":"wasm"}`},
+		{event: map[string]interface{}{"mode": "fail"}, errorType: ErrorTypeHandler, want: "invalid order"},
+	}
+	for _, tt := range tests {
+		resp, err := p.ExecuteFunction(fn.ID, &ExecuteRequest{Event: tt.event})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.errorType != "" {
+			if resp.Success || resp.ErrorType != tt.errorType || !strings.Contains(resp.Stack, tt.want) {
+				t.Errorf("event %v: resp = %+v", tt.event, resp)
+			}
+			continue
+		}
+		if got, _ := json.Marshal(resp.Result); !resp.Success || string(got) != tt.want {
+			t.Errorf("event %v: resp = %+v, result = %s", tt.event, resp, got)
+		}
+	}
+
+	// 代码包目录只读挂载为模块的根目录
+	data := buildZip(t, []packageEntry{
+		{name: "bin/app.wasm", body: string(module)},
+		{name: "data/greeting.txt", body: "from package"},
+	})
+	packaged := createWasmFunction(t, p, "wasm-package", data, "bin/app.wasm")
+	resp, err := p.ExecuteFunction(packaged.ID, &ExecuteRequest{Event: map[string]interface{}{"mode": "file"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Success || resp.Result != "from package" {
+		t.Fatalf("resp = %+v", resp)
+	}
+}
+
+func TestWasmLimits(t *testing.T) {
+	module := buildWasmTestModule(t)
+	p := newTestPlatform(t)
+	fn := createWasmFunction(t, p, "wasm-limits", module, wasmModuleFile)
+	update := *fn
+	update.Timeout = 1
+	if err := p.UpdateFunction(fn.ID, &update); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	resp, err := p.ExecuteFunction(fn.ID, &ExecuteRequest{Event: map[string]interface{}{"mode": "loop"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ErrorType != ErrorTypeTimeout || time.Since(start) > 3*time.Second {
+		t.Fatalf("resp = %+v, 耗时 %v; want 1秒后 timeout", resp, time.Since(start))
+	}
+
+	// 线性内存达到 64MB 上限后模块自己报告内存不足
+	resp, err = p.ExecuteFunction(fn.ID, &ExecuteRequest{Event: map[string]interface{}{"mode": "alloc"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ErrorType != ErrorTypeOOM {
+		t.Fatalf("resp = %+v, want oom", resp)
+	}
+}
+
+func TestCheckWasmModuleRejectsForeignImports(t *testing.T) {
+	p := newTestPlatform(t)
+	// (module (import "env" "log" (func)) (func (export "_start")))
+	module := []byte{
+		0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+		0x01, 0x04, 0x01, 0x60, 0x00, 0x00,
+		0x02, 0x0b, 0x01, 0x03, 'e', 'n', 'v', 0x03, 'l', 'o', 'g', 0x00, 0x00,
+		0x03, 0x02, 0x01, 0x00,
+		0x07, 0x0a, 0x01, 0x06, '_', 's', 't', 'a', 'r', 't', 0x00, 0x01,
+		0x0a, 0x04, 0x01, 0x02, 0x00, 0x0b,
+	}
+	file := filepath.Join(t.TempDir(), wasmModuleFile)
+	if err := os.WriteFile(file, module, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fn := &Function{Runtime: "wasm", Handler: wasmModuleFile, Memory: 64}
+	diagnostics, err := p.checkWasmModule(context.Background(), fn, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diagnostics) != 1 || !strings.Contains(diagnostics[0].Message, "env.log") {
+		t.Fatalf("diagnostics = %+v", diagnostics)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 )
 
 // Config 应用配置
@@ -35,12 +36,27 @@ type StorageConfig struct {
 
 // RuntimeConfig 运行时配置
 type RuntimeConfig struct {
-	WorkDir         string
-	MaxConcurrent   int
-	DefaultTimeout  int
-	DefaultMemory   int
-	EnabledRuntimes []string
-	MaxCodeSize     int64 // KB
+	WorkDir          string
+	MaxConcurrent    int
+	DefaultTimeout   int
+	DefaultMemory    int
+	EnabledRuntimes  []string
+	MaxCodeSize      int64  // KB
+	MaxTimeout       int    // 秒
+	MinMemory        int    // MB
+	MaxMemory        int    // MB
+	Sandbox          bool   // 默认在命名空间沙箱中运行函数
+	MaxPackageSize   int64  // 代码包压缩包大小上限(MB)
+	MaxUnpackedSize  int64  // 代码包解压后大小上限(MB)
+	MaxPackageFiles  int    // 代码包内的文件数上限
+	GoProxy          string // Go 模块代理，离线时为 file:// 目录或 off
+	GoModCache       string // Go 模块缓存目录
+	NpmCache         string // npm 离线缓存目录
+	PythonWheelhouse string // Python wheel 目录
+	BuildTimeout     int    // 构建超时时间(秒)
+	BuildConcurrency int    // 同时执行的构建数
+	WarmIdleTimeout  int    // 空闲常驻实例保留时间(秒)，0 表示不保留
+	WarmMaxIdle      int    // 每个函数保留的空闲常驻实例数
 }
 
 // SecurityConfig 安全配置
@@ -64,8 +80,8 @@ type MonitorConfig struct {
 	EnableTracing   bool
 }
 
-// Load 加载配置
-func Load() *Config {
+// Load 加载配置，配置无效时返回错误
+func Load() (*Config, error) {
 	config := &Config{
 		Server: ServerConfig{
 			Host:         GetEnv("SERVER_HOST", "0.0.0.0"),
@@ -82,12 +98,27 @@ func Load() *Config {
 			MaxIdleTime: 300,
 		},
 		Runtime: RuntimeConfig{
-			WorkDir:         GetEnv("FUNCTIONS_DIR", "./functions"),
-			MaxConcurrent:   GetEnvInt("MAX_CONCURRENT", 10),
-			DefaultTimeout:  GetEnvInt("DEFAULT_TIMEOUT", 30),
-			DefaultMemory:   GetEnvInt("DEFAULT_MEMORY", 128),
-			EnabledRuntimes: []string{"go", "nodejs", "python"},
-			MaxCodeSize:     1024, // 1MB
+			WorkDir:          GetEnv("FUNCTIONS_DIR", "./functions"),
+			MaxConcurrent:    GetEnvInt("MAX_CONCURRENT", 10),
+			DefaultTimeout:   GetEnvInt("DEFAULT_TIMEOUT", 30),
+			DefaultMemory:    GetEnvInt("DEFAULT_MEMORY", 128),
+			EnabledRuntimes:  GetEnvList("ENABLED_RUNTIMES", []string{"go", "nodejs", "python", "js-embedded", "wasm", "custom"}),
+			MaxCodeSize:      int64(GetEnvInt("MAX_CODE_SIZE", 1024)), // 1MB
+			MaxTimeout:       GetEnvInt("MAX_TIMEOUT", 900),
+			MinMemory:        64,
+			MaxMemory:        GetEnvInt("MAX_MEMORY", 3072),
+			Sandbox:          GetEnvBool("FUNCTION_SANDBOX", false),
+			MaxPackageSize:   int64(GetEnvInt("MAX_PACKAGE_SIZE", 50)),   // 50MB
+			MaxUnpackedSize:  int64(GetEnvInt("MAX_UNPACKED_SIZE", 250)), // 250MB
+			MaxPackageFiles:  GetEnvInt("MAX_PACKAGE_FILES", 10000),
+			GoProxy:          GetEnv("FUNCTION_GOPROXY", ""),
+			GoModCache:       GetEnv("FUNCTION_GOMODCACHE", ""),
+			NpmCache:         GetEnv("FUNCTION_NPM_CACHE", ""),
+			PythonWheelhouse: GetEnv("FUNCTION_WHEELHOUSE", ""),
+			BuildTimeout:     GetEnvInt("BUILD_TIMEOUT", 300),
+			BuildConcurrency: GetEnvInt("BUILD_CONCURRENCY", 2),
+			WarmIdleTimeout:  GetEnvInt("WARM_IDLE_TIMEOUT", 300),
+			WarmMaxIdle:      GetEnvInt("WARM_MAX_IDLE", 4),
 		},
 		Security: SecurityConfig{
 			EnableAuth:     GetEnvBool("ENABLE_AUTH", false),
@@ -110,11 +141,10 @@ func Load() *Config {
 
 	// 验证配置
 	if err := validate(config); err != nil {
-		fmt.Printf("配置验证失败: %v\n", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("配置验证失败: %v", err)
 	}
 
-	return config
+	return config, nil
 }
 
 func validate(config *Config) error {
@@ -131,6 +161,26 @@ func validate(config *Config) error {
 		return fmt.Errorf("默认超时时间必须大于0")
 	}
 
+	if config.Runtime.DefaultTimeout > config.Runtime.MaxTimeout {
+		return fmt.Errorf("默认超时时间 %d 超过上限 %d", config.Runtime.DefaultTimeout, config.Runtime.MaxTimeout)
+	}
+
+	if config.Runtime.DefaultMemory < config.Runtime.MinMemory || config.Runtime.DefaultMemory > config.Runtime.MaxMemory {
+		return fmt.Errorf("默认内存 %dMB 不在 %d-%dMB 范围内", config.Runtime.DefaultMemory, config.Runtime.MinMemory, config.Runtime.MaxMemory)
+	}
+
+	if config.Runtime.BuildTimeout <= 0 || config.Runtime.BuildConcurrency <= 0 {
+		return fmt.Errorf("构建超时时间和构建并发数必须大于0")
+	}
+
+	if config.Runtime.WarmIdleTimeout < 0 || config.Runtime.WarmMaxIdle < 0 {
+		return fmt.Errorf("常驻实例的空闲时间和数量不能为负数")
+	}
+
+	if len(config.Runtime.EnabledRuntimes) == 0 {
+		return fmt.Errorf("至少需要启用一个运行时")
+	}
+
 	// 验证日志级别
 	validLogLevels := []string{"debug", "info", "warn", "error"}
 	found := false
@@ -144,17 +194,6 @@ func validate(config *Config) error {
 		return fmt.Errorf("无效的日志级别: %s", config.Monitor.LogLevel)
 	}
 
-	// 创建必要的目录
-	dirs := []string{
-		config.Storage.DataDir,
-		config.Runtime.WorkDir,
-	}
-	for _, dir := range dirs {
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			return fmt.Errorf("创建目录 %s 失败: %v", dir, err)
-		}
-	}
-
 	return nil
 }
 
@@ -176,6 +215,22 @@ func GetEnvInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+// GetEnvList 获取逗号分隔的列表类型环境变量
+func GetEnvList(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
 // GetEnvBool 获取布尔类型的环境变量
 func GetEnvBool(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
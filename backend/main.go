@@ -3,11 +3,14 @@ package main
 import (
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"testChat/backend/cloudfunction"
+	"testChat/backend/config"
 )
 
 func main() {
@@ -37,14 +40,55 @@ func initializeSystem() {
 
 // createPlatform 创建云函数平台
 func createPlatform() *cloudfunction.Platform {
+	cfg, err := config.Load()
+	if err != nil {
+		cloudfunction.GlobalLogger.Fatal("加载配置失败: %v", err)
+	}
+
 	// 设置云函数工作目录
-	functionsDir := getEnv("FUNCTIONS_DIR", "./functions")
+	functionsDir := cfg.Runtime.WorkDir
 	if err := os.MkdirAll(functionsDir, 0755); err != nil {
 		cloudfunction.GlobalLogger.Fatal("创建云函数目录失败: %v", err)
 	}
 
+	// 平台配置
+	options := cloudfunction.DefaultOptions()
+	options.NameRedirectTTL = getEnvDuration("NAME_REDIRECT_TTL", options.NameRedirectTTL)
+	options.EnabledRuntimes = cfg.Runtime.EnabledRuntimes
+	options.MaxCodeSize = cfg.Runtime.MaxCodeSize
+	options.MaxTimeout = cfg.Runtime.MaxTimeout
+	options.MinMemory = cfg.Runtime.MinMemory
+	options.MaxMemory = cfg.Runtime.MaxMemory
+	options.Sandbox = cfg.Runtime.Sandbox
+	options.MaxPackageSize = cfg.Runtime.MaxPackageSize
+	options.MaxUnpackedSize = cfg.Runtime.MaxUnpackedSize
+	options.MaxPackageFiles = cfg.Runtime.MaxPackageFiles
+	options.GoProxy = cfg.Runtime.GoProxy
+	options.GoModCache = cfg.Runtime.GoModCache
+	options.NpmCache = cfg.Runtime.NpmCache
+	options.PythonWheelhouse = cfg.Runtime.PythonWheelhouse
+	options.BuildTimeout = cfg.Runtime.BuildTimeout
+	options.BuildConcurrency = cfg.Runtime.BuildConcurrency
+	options.WarmIdleTimeout = cfg.Runtime.WarmIdleTimeout
+	options.WarmMaxIdle = cfg.Runtime.WarmMaxIdle
+	options.SecretsMasterKey = os.Getenv("SECRETS_MASTER_KEY")
+	options.SecretsPreviousKeys = strings.Split(os.Getenv("SECRETS_PREVIOUS_KEYS"), ",")
+	options.SecretsFile = filepath.Join(cfg.Storage.DataDir, "secrets.json")
+	// 主密钥只保存在平台配置中，从进程环境中清除，避免被子进程继承
+	os.Unsetenv("SECRETS_MASTER_KEY")
+	os.Unsetenv("SECRETS_PREVIOUS_KEYS")
+	if allowlist := os.Getenv("FUNCTION_ENV_ALLOWLIST"); allowlist != "" {
+		options.HostEnvAllowlist = strings.Split(allowlist, ",")
+	}
+
+	if options.Sandbox {
+		if err := cloudfunction.SandboxAvailable(); err != nil {
+			cloudfunction.GlobalLogger.Fatal("已启用函数沙箱，但当前主机不支持: %v", err)
+		}
+	}
+
 	// 创建云函数平台
-	platform := cloudfunction.NewPlatform(functionsDir)
+	platform := cloudfunction.NewPlatformWithOptions(functionsDir, options)
 	cloudfunction.GlobalLogger.Info("云函数平台初始化完成")
 
 	return platform
@@ -103,3 +147,13 @@ func getEnvInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+// getEnvDuration 获取时间间隔类型的环境变量，格式如 "72h"、"30m"
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if duration, err := time.ParseDuration(value); err == nil {
+			return duration
+		}
+	}
+	return defaultValue
+}